@@ -0,0 +1,290 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AggregateOp is an aggregation computed by Aggregate.
+type AggregateOp int
+
+const (
+	// AggregateCount counts the matching documents. It does not use a field.
+	AggregateCount AggregateOp = iota
+	// AggregateSum sums a numeric field over the matching documents.
+	AggregateSum
+	// AggregateAvg averages a numeric field over the matching documents.
+	AggregateAvg
+)
+
+// AggregateSpec describes one aggregation of an Aggregate call. Its result is returned under Alias.
+type AggregateSpec struct {
+	Op    AggregateOp
+	Field string
+	Alias string
+}
+
+// Aggregate computes all specs over the documents matching queries with a single aggregation query,
+// and returns the results keyed by alias. Counts are returned as int64. Sums are int64 when every summed
+// value is an integer and float64 otherwise; averages are float64, or nil when no document has the field.
+func (db *DB) Aggregate(ctx context.Context, queries []Query, specs []AggregateSpec) (results map[string]interface{}, err error) {
+	defer recoverError("Aggregate", &err)
+	ctx, db = db.prepare(ctx)
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("at least one aggregate spec is required")
+	}
+
+	q, err := db.buildQuery(ctx, db.scoped(queries))
+	if err != nil {
+		return nil, err
+	}
+
+	aq := q.NewAggregationQuery()
+	aliases := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if spec.Alias == "" {
+			return nil, fmt.Errorf("aggregate alias cannot be empty")
+		}
+		if aliases[spec.Alias] {
+			return nil, fmt.Errorf("duplicate aggregate alias %s", spec.Alias)
+		}
+		aliases[spec.Alias] = true
+
+		switch spec.Op {
+		case AggregateCount:
+			aq = aq.WithCount(spec.Alias)
+		case AggregateSum, AggregateAvg:
+			if spec.Field == "" {
+				return nil, fmt.Errorf("aggregate %s requires a field", spec.Alias)
+			}
+			if spec.Op == AggregateSum {
+				aq = aq.WithSum(spec.Field, spec.Alias)
+			} else {
+				aq = aq.WithAvg(spec.Field, spec.Alias)
+			}
+		default:
+			return nil, fmt.Errorf("unknown aggregate op %d for %s", spec.Op, spec.Alias)
+		}
+	}
+	if db.GetConnection().HasTransaction() {
+		if err := db.checkTransactionRead(); err != nil {
+			return nil, err
+		}
+		aq = aq.Transaction(db.GetConnection().GetTransaction())
+	} else if !db.options.readTime.IsZero() {
+		return nil, ErrReadTimeQuery
+	}
+
+	result, err := aq.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run aggregation query: %v", err)
+	}
+	results = make(map[string]interface{}, len(result))
+	for alias, value := range result {
+		results[alias] = aggregateValue(value)
+	}
+	return results, nil
+}
+
+// RunAggregations runs Aggregate with specs for each labeled set of queries, with up to GetConcurrency()
+// aggregation queries in flight at once, and returns the results keyed by label. If some aggregations fail,
+// the results of the others are still returned and the errors are returned joined together.
+func (db *DB) RunAggregations(ctx context.Context, queries map[string][]Query, specs []AggregateSpec) (results map[string]map[string]interface{}, err error) {
+	defer recoverError("RunAggregations", &err)
+	ctx, db = db.prepare(ctx)
+
+	var mu sync.Mutex
+	var errs []error
+	results = make(map[string]map[string]interface{}, len(queries))
+	concurrency := db.GetConcurrency()
+	if db.GetConnection().HasTransaction() {
+		// Transaction reads are issued one at a time
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for label, labelQueries := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(label string, labelQueries []Query) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Aggregate recovers its own panics
+			result, err := db.Aggregate(ctx, labelQueries, specs)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("aggregation %s: %v", label, err))
+				return
+			}
+			results[label] = result
+		}(label, labelQueries)
+	}
+	wg.Wait()
+	return results, errors.Join(errs...)
+}
+
+// CountUpTo counts the documents matching queries, reading at most upTo of them, and returns
+// min(actual count, upTo). It is a cheaper way to check whether at least upTo documents match.
+// A smaller limit given in queries is kept.
+func (db *DB) CountUpTo(ctx context.Context, queries []Query, upTo int64) (count int64, err error) {
+	defer recoverError("CountUpTo", &err)
+	if upTo <= 0 {
+		return 0, fmt.Errorf("upTo must be positive, got %d", upTo)
+	}
+
+	limit := upTo
+	if l := queryLimit(queries); l > 0 && int64(l) < limit {
+		limit = int64(l)
+	}
+	limited := append(queries[:len(queries):len(queries)], Query{Limit: int(limit)})
+	results, err := db.Aggregate(ctx, limited, []AggregateSpec{{Op: AggregateCount, Alias: "count"}})
+	if err != nil {
+		return 0, err
+	}
+	count, _ = results["count"].(int64)
+	return count, nil
+}
+
+// WithDistinctLimit returns a new DB instance whose CountDistinct calls hold at most limit distinct values in
+// memory, failing with ErrDistinctLimit beyond. A limit of zero or less removes the bound, which is the default.
+func (db *DB) WithDistinctLimit(limit int) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.distinctLimit = limit
+	return newInstance
+}
+
+// CountDistinct returns the number of distinct values of field, a dot-separated path as in WhereClause.Field,
+// among the documents matching queries. Firestore has no distinct aggregation, so this is a full scan reading
+// every matching document, with only field projected, and collecting the values in memory: bound it with
+// WithDistinctLimit, in which case the limit is returned with ErrDistinctLimit once exceeded. Documents without
+// the field are not counted, while null is a value. Values are compared by type, so 1 and 1.0 are distinct.
+func (db *DB) CountDistinct(ctx context.Context, field string, queries []Query) (count int64, err error) {
+	defer recoverError("CountDistinct", &err)
+	ctx, db = db.prepare(ctx)
+	if field == "" {
+		return 0, fmt.Errorf("field cannot be empty")
+	}
+	if db.GetModelType() == nil {
+		return 0, fmt.Errorf("no model set, call db.Model(&Model{}) first")
+	}
+
+	q, err := db.buildQuery(ctx, db.scoped(queries))
+	if err != nil {
+		return 0, err
+	}
+	iter, err := db.documentIterator(ctx, q.Select(field))
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Stop()
+
+	seen := make(map[interface{}]struct{})
+	for {
+		doc, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			return int64(len(seen)), nil
+		}
+		if indexErr, ok := ParseIndexRequired(err, queries); ok {
+			return 0, indexErr
+		}
+		if err != nil {
+			return 0, err
+		}
+		value, err := doc.DataAt(field)
+		if err != nil {
+			continue
+		}
+		seen[distinctKey(value)] = struct{}{}
+		if limit := db.options.distinctLimit; limit > 0 && len(seen) > limit {
+			return int64(limit), ErrDistinctLimit
+		}
+	}
+}
+
+// printedValue is the distinctKey of values that are not comparable, by type and printed form.
+type printedValue struct {
+	typ     string
+	printed string
+}
+
+// distinctKey returns a map key identifying value: the value itself when comparable, the path of a document
+// reference, or else its type and printed form, which prints maps with sorted keys and the targets of pointers.
+func distinctKey(value interface{}) interface{} {
+	if ref, ok := value.(*firestore.DocumentRef); ok {
+		return printedValue{typ: "ref", printed: ref.Path}
+	}
+	if value == nil || reflect.TypeOf(value).Comparable() && reflect.TypeOf(value).Kind() != reflect.Ptr {
+		return value
+	}
+	return printedValue{typ: fmt.Sprintf("%T", value), printed: fmt.Sprintf("%v", value)}
+}
+
+// CountByTimeBucket counts the documents matching extra whose timeField falls in each bucket of the range
+// [start, end), and returns the counts keyed by bucket start. Buckets are consecutive ranges of the given
+// duration starting at start, the last one being cut at end, and are counted with one count aggregation
+// each, run concurrently like RunAggregations. Every bucket has an entry, including empty ones.
+func (db *DB) CountByTimeBucket(ctx context.Context, timeField string, start, end time.Time, bucket time.Duration, extra []Query) (counts map[time.Time]int64, err error) {
+	defer recoverError("CountByTimeBucket", &err)
+	if timeField == "" {
+		return nil, fmt.Errorf("time field cannot be empty")
+	}
+	if bucket <= 0 {
+		return nil, fmt.Errorf("bucket duration must be positive, got %s", bucket)
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("end %s must be after start %s", end, start)
+	}
+
+	var starts []time.Time
+	queries := make(map[string][]Query)
+	for bucketStart := start; bucketStart.Before(end); bucketStart = bucketStart.Add(bucket) {
+		bucketEnd := bucketStart.Add(bucket)
+		if bucketEnd.After(end) {
+			bucketEnd = end
+		}
+		queries[strconv.Itoa(len(starts))] = append(extra[:len(extra):len(extra)], Query{Where: []WhereClause{
+			{Field: timeField, Operator: ">=", Value: bucketStart},
+			{Field: timeField, Operator: "<", Value: bucketEnd},
+		}})
+		starts = append(starts, bucketStart)
+	}
+
+	results, err := db.RunAggregations(ctx, queries, []AggregateSpec{{Op: AggregateCount, Alias: "count"}})
+	if err != nil {
+		return nil, err
+	}
+	counts = make(map[time.Time]int64, len(starts))
+	for i, bucketStart := range starts {
+		counts[bucketStart], _ = results[strconv.Itoa(i)]["count"].(int64)
+	}
+	return counts, nil
+}
+
+// aggregateValue converts an aggregation result value to int64, float64 or nil.
+func aggregateValue(value interface{}) interface{} {
+	v, ok := value.(*firestorepb.Value)
+	if !ok {
+		return value
+	}
+	switch x := v.GetValueType().(type) {
+	case *firestorepb.Value_IntegerValue:
+		return x.IntegerValue
+	case *firestorepb.Value_DoubleValue:
+		return x.DoubleValue
+	case *firestorepb.Value_NullValue:
+		return nil
+	}
+	return v
+}
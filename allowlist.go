@@ -0,0 +1,101 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"reflect"
+	"slices"
+)
+
+// WithFieldAllowlist returns a new DB instance only reading the given top-level fields of documents, named by
+// their Go name or "firestore" tag name, for field-level authorization. Queries select the allowed fields
+// only, so the others are neither transferred nor returned by FindSnapshots, Export and FindAllJSON, and
+// every decode leaves the other stored fields of the model zero, including after single-document reads,
+// which always transfer whole documents. GetByIDWithRaw returns the allowed fields only. The ID is always set.
+// A nil list removes the restriction, while an empty one allows no field.
+func (db *DB) WithFieldAllowlist(fields []string) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.fieldAllowlist = slices.Clone(fields)
+	return newInstance
+}
+
+// allowedFields returns the stored names of the fields of the struct type t allowed by WithFieldAllowlist, with
+// the SchemaVersionField for models implementing SchemaUpgrader, and whether reads are restricted at all.
+func (db *DB) allowedFields(t reflect.Type) ([]string, bool) {
+	if db.options.fieldAllowlist == nil {
+		return nil, false
+	}
+	allowed := []string{}
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return allowed, true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := allowedFieldName(t.Field(i), db.options.fieldAllowlist)
+		if ok {
+			allowed = append(allowed, name)
+		}
+	}
+	if _, ok := schemaUpgrader(reflect.New(t).Interface()); ok {
+		allowed = append(allowed, SchemaVersionField)
+	}
+	return allowed, true
+}
+
+// allowedFieldName returns the stored name of fieldDef and whether the allowlist names it.
+func allowedFieldName(fieldDef reflect.StructField, allowlist []string) (string, bool) {
+	if !fieldDef.IsExported() {
+		return "", false
+	}
+	name, _ := FirestoreFieldName(fieldDef)
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = fieldDef.Name
+	}
+	return name, slices.Contains(allowlist, name) || slices.Contains(allowlist, fieldDef.Name)
+}
+
+// restrictQuery selects the allowed fields in q when reads are restricted.
+func (db *DB) restrictQuery(q firestore.Query) firestore.Query {
+	if allowed, restricted := db.allowedFields(db.GetModelType()); restricted {
+		return q.Select(allowed...)
+	}
+	return q
+}
+
+// restrictData returns the entries of data holding allowed fields of the struct type t when reads are restricted,
+// or data.
+func (db *DB) restrictData(data map[string]interface{}, t reflect.Type) map[string]interface{} {
+	allowed, restricted := db.allowedFields(t)
+	if !restricted {
+		return data
+	}
+	result := make(map[string]interface{}, len(allowed))
+	for _, name := range allowed {
+		if value, ok := data[name]; ok {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+// zeroDisallowedFields sets the stored fields of dest, a pointer to a struct, that reads may not populate to
+// their zero value, so that they hold nothing from a previous use of dest.
+func (db *DB) zeroDisallowedFields(dest interface{}) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		fieldDef := v.Type().Field(i)
+		if name, allowed := allowedFieldName(fieldDef, db.options.fieldAllowlist); name != "" && !allowed {
+			v.Field(i).Set(reflect.Zero(fieldDef.Type))
+		}
+	}
+}
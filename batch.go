@@ -0,0 +1,466 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"reflect"
+	"sync"
+)
+
+// GetByIDsChunkSize is the number of documents fetched per GetAll call in GetByIDs.
+const GetByIDsChunkSize = 100
+
+// GetByIDs retrieves the documents with the given IDs and stores them in dest (which must be a pointer to a slice)
+// in the order of ids. IDs are fetched in chunks of GetByIDsChunkSize, with up to GetConcurrency() chunks in
+// flight at once. Documents that do not exist are skipped; use GetByIDsOrdered to keep results aligned with ids.
+// If some chunks fail, the documents from the successful chunks are still stored in dest and the chunk errors
+// are returned joined together.
+func (db *DB) GetByIDs(ctx context.Context, ids []string, dest interface{}) (err error) {
+	defer recoverError("GetByIDs", &err)
+	ctx, db = db.prepare(ctx)
+	dbInstance, err := db.sliceModel(dest)
+	if err != nil {
+		return err
+	}
+	docs, err := dbInstance.fetchByIDs(ctx, ids)
+	if docs == nil {
+		return err
+	}
+
+	var found []*firestore.DocumentSnapshot
+	for _, doc := range docs {
+		if doc != nil && doc.Exists() {
+			found = append(found, doc)
+		}
+	}
+	if err := dbInstance.appendDocuments(ctx, found, dest); err != nil {
+		return err
+	}
+	return err
+}
+
+// GetByIDsOrdered works like GetByIDs, but replaces the slice dest points to with one element per ID, in the
+// order of ids, so that results can be correlated by position: the element of an ID whose document does not
+// exist is left zero, and the ID is returned in missing, in the order of ids. The IDs of failed chunks are
+// neither found nor missing; their elements are zero too and the chunk errors are returned joined together.
+func (db *DB) GetByIDsOrdered(ctx context.Context, ids []string, dest interface{}) (missing []string, err error) {
+	defer recoverError("GetByIDsOrdered", &err)
+	ctx, db = db.prepare(ctx)
+	dbInstance, err := db.sliceModel(dest)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := dbInstance.fetchByIDs(ctx, ids)
+	if docs == nil {
+		return nil, err
+	}
+
+	results := reflect.MakeSlice(reflect.TypeOf(dest).Elem(), len(ids), len(ids))
+	for i, doc := range docs {
+		switch {
+		case doc == nil:
+		case !doc.Exists():
+			missing = append(missing, ids[i])
+		default:
+			if err := dbInstance.decodeDocument(ctx, doc, results.Index(i).Addr().Interface()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	reflect.ValueOf(dest).Elem().Set(results)
+	return missing, err
+}
+
+// fetchByIDs fetches the documents of the model's collection with the given IDs, in chunks of GetByIDsChunkSize
+// read concurrently. It returns one snapshot per ID, nil for the IDs of failed chunks, along with the chunk
+// errors joined together. The snapshots are nil when nothing could be fetched, e.g. because an ID is empty.
+func (db *DB) fetchByIDs(ctx context.Context, ids []string) ([]*firestore.DocumentSnapshot, error) {
+	colName, err := db.CollectionName()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if id == "" {
+			return nil, fmt.Errorf("ID cannot be empty")
+		}
+	}
+
+	collection := db.GetConnection().GetClient().Collection(colName)
+	chunks := chunkStrings(ids, GetByIDsChunkSize)
+	results := make([][]*firestore.DocumentSnapshot, len(chunks))
+	errs := make([]error, len(chunks))
+
+	if err := db.checkTransactionRead(); err != nil {
+		return nil, err
+	}
+	concurrency := db.GetConcurrency()
+	if db.GetConnection().HasTransaction() {
+		// Transaction reads are issued one at a time
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, chunk []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// Panics in a worker are not seen by the deferred recovery of the caller
+			defer recoverError(fmt.Sprintf("GetByIDs chunk %d", i), &errs[i])
+
+			refs := make([]*firestore.DocumentRef, len(chunk))
+			for j, id := range chunk {
+				refs[j] = collection.Doc(id)
+			}
+
+			docs, err := db.getAll(ctx, refs)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to fetch chunk %d: %v", i, err)
+				return
+			}
+			results[i] = docs
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	docs := make([]*firestore.DocumentSnapshot, 0, len(ids))
+	for i, chunk := range chunks {
+		if results[i] == nil {
+			docs = append(docs, make([]*firestore.DocumentSnapshot, len(chunk))...)
+			continue
+		}
+		docs = append(docs, results[i]...)
+	}
+	return docs, errors.Join(errs...)
+}
+
+// GetByRefs retrieves the documents referenced by refs, which may belong to any collection or subcollection,
+// and stores them in dest (which must be a pointer to a slice) in the order of refs, with their IDs set.
+// Refs are fetched in chunks of GetByIDsChunkSize, and documents that do not exist are skipped.
+func (db *DB) GetByRefs(ctx context.Context, refs []*firestore.DocumentRef, dest interface{}) (err error) {
+	defer recoverError("GetByRefs", &err)
+	ctx, db = db.prepare(ctx)
+	dbInstance, err := db.sliceModel(dest)
+	if err != nil {
+		return err
+	}
+	for i, ref := range refs {
+		if ref == nil {
+			return fmt.Errorf("ref %d is nil", i)
+		}
+	}
+	if err := dbInstance.checkTransactionRead(); err != nil {
+		return err
+	}
+
+	var found []*firestore.DocumentSnapshot
+	for start := 0; start < len(refs); start += GetByIDsChunkSize {
+		chunk := refs[start:min(start+GetByIDsChunkSize, len(refs))]
+		docs, err := dbInstance.getAll(ctx, chunk)
+		if err != nil {
+			return fmt.Errorf("failed to fetch documents: %v", err)
+		}
+		for _, doc := range docs {
+			if doc.Exists() {
+				found = append(found, doc)
+			}
+		}
+	}
+	return dbInstance.appendDocuments(ctx, found, dest)
+}
+
+// SaveAll saves every model of the models slice (structs or pointers to structs) with batched writes,
+// creating new documents for models without an ID. The returned slice is aligned with models and holds
+// the generated ID of each newly created document, or an empty string for models that already had an ID.
+// Inside a transaction, the writes are added to the transaction instead of being committed in batches.
+func (db *DB) SaveAll(ctx context.Context, models interface{}) (ids []string, err error) {
+	defer recoverError("SaveAll", &err)
+	ctx, db = db.prepare(ctx)
+	return db.writeAll(ctx, models)
+}
+
+// BatchUpsert saves every model of the models slice (structs or pointers to structs) like SaveAll,
+// but merges the model data into existing documents with firestore.MergeAll instead of overwriting them,
+// so stored fields that the models do not hold are preserved. IDs are generated only for models without one.
+func (db *DB) BatchUpsert(ctx context.Context, models interface{}) (err error) {
+	defer recoverError("BatchUpsert", &err)
+	ctx, db = db.prepare(ctx)
+	_, err = db.writeAll(ctx, models, firestore.MergeAll)
+	return err
+}
+
+// writeAll sets every model of the models slice with opts, in batches of BatchWriteLimit writes
+// or in the connection's transaction, and returns the IDs generated for models without one.
+func (db *DB) writeAll(ctx context.Context, models interface{}, opts ...firestore.SetOption) ([]string, error) {
+	if db.options.readOnly {
+		return nil, ErrReadOnly
+	}
+	rv := reflect.ValueOf(models)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("models must be a slice or a pointer to a slice")
+	}
+	if db.GetConnection().HasTransaction() && rv.Len() > TransactionWriteLimit {
+		return nil, fmt.Errorf("cannot save more than %d documents in a transaction", TransactionWriteLimit)
+	}
+
+	generated := make([]string, rv.Len())
+	written := make(map[string]bool)
+	defer func() {
+		for colName := range written {
+			db.invalidateQueryCache(colName)
+		}
+	}()
+	batch := db.GetConnection().GetClient().Batch()
+	pending := 0
+	committed := 0
+	for i := 0; i < rv.Len(); i++ {
+		elem := rv.Index(i)
+		if elem.Kind() == reflect.Struct {
+			elem = elem.Addr()
+		}
+		if elem.Kind() != reflect.Ptr || elem.IsNil() || elem.Elem().Kind() != reflect.Struct {
+			return generated, fmt.Errorf("element %d must be a struct or a pointer to a struct", i)
+		}
+		model := elem.Interface()
+
+		dbInstance := db.Model(model).(*DB)
+		colName, err := dbInstance.CollectionName()
+		if err != nil {
+			return generated, err
+		}
+		written[colName] = true
+		id, err := dbInstance.resolveID(model)
+		if err != nil {
+			return generated, err
+		}
+
+		collection := dbInstance.GetConnection().GetClient().Collection(colName)
+		var docRef *firestore.DocumentRef
+		if id == "" {
+			docRef = dbInstance.newDocRef(collection)
+			SetIDField(model, docRef.ID)
+			generated[i] = docRef.ID
+		} else {
+			docRef = collection.Doc(id)
+		}
+
+		dbInstance.stampTimestamps(model)
+		if applier, ok := model.(DefaultsApplier); ok {
+			applier.ApplyDefaults()
+		}
+		data, err := StructToMapWithOptions(model, dbInstance.GetEncodeOptions())
+		if err != nil {
+			return generated, err
+		}
+		if err := checkDocumentSize(documentPath(docRef), data); err != nil {
+			return generated, err
+		}
+
+		if db.GetConnection().HasTransaction() {
+			if err := db.transactionWrite(func(tx *firestore.Transaction) error {
+				return tx.Set(docRef, data, opts...)
+			}); err != nil {
+				return generated, err
+			}
+			continue
+		}
+
+		batch.Set(docRef, data, opts...)
+		pending++
+		if pending == BatchWriteLimit {
+			if _, err := batch.Commit(ctx); err != nil {
+				return generated, fmt.Errorf("batch commit failed: %v", err)
+			}
+			committed += pending
+			db.reportProgress(committed)
+			batch = db.GetConnection().GetClient().Batch()
+			pending = 0
+		}
+	}
+
+	if pending > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return generated, fmt.Errorf("batch commit failed: %v", err)
+		}
+		db.reportProgress(committed + pending)
+	}
+	return generated, nil
+}
+
+// chunkStrings splits values into consecutive chunks of at most size elements.
+func chunkStrings(values []string, size int) [][]string {
+	var chunks [][]string
+	for start := 0; start < len(values); start += size {
+		end := start + size
+		if end > len(values) {
+			end = len(values)
+		}
+		chunks = append(chunks, values[start:end])
+	}
+	return chunks
+}
+
+// DeleteCollection deletes every document in the current model's collection, committing one write batch
+// per page of batchSize documents, and returns the number of documents deleted.
+// With WithRecursiveDelete, the subcollections of each document are deleted first (and counted), so no
+// orphaned subcollection documents are left behind. Documents that only exist as parents of
+// subcollections are not returned by queries and are therefore not visited.
+func (db *DB) DeleteCollection(ctx context.Context, batchSize int) (deleted int, err error) {
+	defer recoverError("DeleteCollection", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return 0, ErrReadOnly
+	}
+	if db.GetConnection().HasTransaction() {
+		return 0, fmt.Errorf("deleting a collection is not supported in a transaction")
+	}
+	if batchSize <= 0 || batchSize > BatchWriteLimit {
+		return 0, fmt.Errorf("batch size must be between 1 and %d", BatchWriteLimit)
+	}
+
+	colName, err := db.CollectionName()
+	if err != nil {
+		return 0, err
+	}
+	defer db.invalidateQueryCache(colName)
+
+	q, err := db.RawQuery(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return db.deleteQueryDocuments(ctx, q, batchSize, db.options.progress)
+}
+
+// RenameCollection copies every document of the current model's collection into the newName collection,
+// keeping their IDs, with one write batch per page of BatchWriteLimit documents, and returns the number of
+// documents copied. newName is resolved like the model's collection name, so the collection prefix and suffix
+// are added around it and it is a sibling of the model's collection under the same parent document.
+// Documents already in newName with the same IDs are overwritten. When deleteOld is set, the source documents
+// are deleted once all of them are copied, so a failure never loses data. Subcollections are neither copied
+// nor deleted, even with WithRecursiveDelete, so they stay under the source document paths.
+func (db *DB) RenameCollection(ctx context.Context, newName string, deleteOld bool) (copied int, err error) {
+	defer recoverError("RenameCollection", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return 0, ErrReadOnly
+	}
+	if db.GetConnection().HasTransaction() {
+		return 0, fmt.Errorf("renaming a collection is not supported in a transaction")
+	}
+	if newName == "" {
+		return 0, fmt.Errorf("new collection name cannot be empty")
+	}
+	colName, err := db.CollectionName()
+	if err != nil {
+		return 0, err
+	}
+	newName = db.qualifiedCollectionName(newName)
+	if newName == colName {
+		return 0, fmt.Errorf("collection %s cannot be renamed to itself", colName)
+	}
+	defer db.invalidateQueryCache(colName)
+	defer db.invalidateQueryCache(newName)
+
+	q, err := db.RawQuery(ctx)
+	if err != nil {
+		return 0, err
+	}
+	q = q.OrderBy(firestore.DocumentID, firestore.Asc)
+	target := db.GetConnection().GetClient().Collection(newName)
+	var lastDoc *firestore.DocumentSnapshot
+	for {
+		page := q
+		if lastDoc != nil {
+			page = q.StartAfter(lastDoc)
+		}
+		docs, err := page.Limit(BatchWriteLimit).Documents(ctx).GetAll()
+		if err != nil {
+			return copied, fmt.Errorf("failed to retrieve documents: %v", err)
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		batch := db.GetConnection().GetClient().Batch()
+		for _, doc := range docs {
+			batch.Set(target.Doc(doc.Ref.ID), doc.Data())
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return copied, fmt.Errorf("batch commit failed: %v", err)
+		}
+		copied += len(docs)
+		lastDoc = docs[len(docs)-1]
+	}
+
+	if deleteOld {
+		// The subcollections were not copied, so they must not be deleted with their documents
+		source := &DB{options: db.options}
+		source.options.recursiveDelete = false
+		if _, err := source.deleteQueryDocuments(ctx, q, BatchWriteLimit, nil); err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// deleteQueryDocuments deletes all documents matched by q in batches of batchSize, passing the number of
+// documents deleted so far to progress, if not nil, after each batch.
+func (db *DB) deleteQueryDocuments(ctx context.Context, q firestore.Query, batchSize int, progress func(processed int)) (int, error) {
+	total := 0
+	for {
+		docs, err := q.Limit(batchSize).Documents(ctx).GetAll()
+		if err != nil {
+			return total, fmt.Errorf("failed to retrieve documents: %v", err)
+		}
+		if len(docs) == 0 {
+			return total, nil
+		}
+
+		batch := db.GetConnection().GetClient().Batch()
+		for _, doc := range docs {
+			if db.options.recursiveDelete {
+				deleted, err := db.deleteSubcollections(ctx, doc.Ref, batchSize)
+				total += deleted
+				if err != nil {
+					return total, err
+				}
+			}
+			batch.Delete(doc.Ref)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return total, fmt.Errorf("batch commit failed: %v", err)
+		}
+		total += len(docs)
+		if progress != nil {
+			progress(total)
+		}
+	}
+}
+
+// deleteSubcollections deletes the documents of every subcollection under docRef.
+func (db *DB) deleteSubcollections(ctx context.Context, docRef *firestore.DocumentRef, batchSize int) (int, error) {
+	total := 0
+	iter := docRef.Collections(ctx)
+	for {
+		colRef, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			return total, nil
+		}
+		if err != nil {
+			return total, fmt.Errorf("failed to list subcollections: %v", err)
+		}
+		deleted, err := db.deleteQueryDocuments(ctx, colRef.Query, batchSize, nil)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache stores the FindAll results cached by WithQueryCache. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored under key, unless it is missing or has expired.
+	Get(key string) (interface{}, bool)
+	// Set stores value under key for ttl, or without expiry when ttl is 0.
+	Set(key string, value interface{}, ttl time.Duration)
+}
+
+// WithQueryCache returns a new DB instance caching FindAll results in cache for ttl, keyed by the collection
+// and the queries, with the values of value providers resolved at each call. Writes through any DB instance using the same cache invalidate the cached results
+// of the written collection; writes made elsewhere are only seen once the results expire.
+// Writes in a transaction invalidate the results when they are queued, not when the transaction commits.
+// Reads in a transaction always bypass the cache. Pass a nil cache to disable caching.
+func (db *DB) WithQueryCache(cache Cache, ttl time.Duration) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.queryCache = cache
+	newInstance.options.queryCacheTTL = ttl
+	return newInstance
+}
+
+// findDocuments runs queries against the model's collection, serving them from the query cache when there is one.
+func (db *DB) findDocuments(ctx context.Context, queries []Query) ([]*firestore.DocumentSnapshot, error) {
+	cache := db.options.queryCache
+	if cache == nil || db.GetConnection().HasTransaction() || !db.options.readTime.IsZero() {
+		q, err := db.buildQuery(ctx, queries)
+		if err != nil {
+			return nil, err
+		}
+		return db.documents(ctx, q)
+	}
+
+	colName, err := db.CollectionName()
+	if err != nil {
+		return nil, err
+	}
+	queries, err = resolveValueProviders(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+	key := db.queryCacheKey("query", colName, queries)
+	if cached, ok := cache.Get(key); ok {
+		if docs, ok := cached.([]*firestore.DocumentSnapshot); ok {
+			return docs, nil
+		}
+	}
+
+	q, err := db.buildQuery(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := db.documents(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cache.Set(key, docs, db.options.queryCacheTTL)
+	return docs, nil
+}
+
+// countEntry is a count cached by Count, with the time it was read.
+type countEntry struct {
+	count  int64
+	readAt time.Time
+}
+
+// countRefreshes holds the cache keys of the counts being refreshed in the background.
+var countRefreshes sync.Map
+
+// WithStaleCount returns a new DB instance where Count serves cached counts up to maxStale past their query cache
+// TTL: a stale count is returned immediately while it is refreshed in the background, so callers never wait for
+// an expired count. Only one refresh per count runs at a time. Refreshes are detached from the cancellation of
+// the Count context, since the caller has usually returned by then, but keep its values and are bounded by
+// maxStale. It requires a query cache with a TTL (see WithQueryCache) and has no effect otherwise.
+func (db *DB) WithStaleCount(maxStale time.Duration) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.staleCount = maxStale
+	return newInstance
+}
+
+// Count returns the number of documents matching queries, counted with an aggregation query. With a query
+// cache (see WithQueryCache), counts are cached and invalidated like FindAll results; see also WithStaleCount.
+func (db *DB) Count(ctx context.Context, queries []Query) (count int64, err error) {
+	defer recoverError("Count", &err)
+	ctx, db = db.prepare(ctx)
+	cache := db.options.queryCache
+	if cache == nil || db.GetConnection().HasTransaction() || !db.options.readTime.IsZero() {
+		return db.countDocuments(ctx, queries)
+	}
+
+	colName, err := db.CollectionName()
+	if err != nil {
+		return 0, err
+	}
+	queries, err = resolveValueProviders(ctx, queries)
+	if err != nil {
+		return 0, err
+	}
+	key := db.queryCacheKey("count", colName, queries)
+	if cached, ok := cache.Get(key); ok {
+		if entry, ok := cached.(countEntry); ok {
+			age, ttl := time.Since(entry.readAt), db.options.queryCacheTTL
+			switch {
+			case ttl == 0 || age <= ttl:
+				return entry.count, nil
+			case age <= ttl+db.options.staleCount:
+				db.refreshCount(ctx, key, queries)
+				return entry.count, nil
+			}
+		}
+	}
+
+	count, err = db.countDocuments(ctx, queries)
+	if err != nil {
+		return 0, err
+	}
+	db.cacheCount(key, count)
+	return count, nil
+}
+
+// countDocuments counts the documents matching queries without the cache.
+func (db *DB) countDocuments(ctx context.Context, queries []Query) (int64, error) {
+	results, err := db.Aggregate(ctx, queries, []AggregateSpec{{Op: AggregateCount, Alias: "count"}})
+	if err != nil {
+		return 0, err
+	}
+	count, _ := results["count"].(int64)
+	return count, nil
+}
+
+// cacheCount stores count under key. With WithStaleCount, the entry outlives the TTL by the allowed staleness.
+func (db *DB) cacheCount(key string, count int64) {
+	ttl := db.options.queryCacheTTL
+	if ttl > 0 {
+		ttl += db.options.staleCount
+	}
+	db.options.queryCache.Set(key, countEntry{count: count, readAt: time.Now()}, ttl)
+}
+
+// refreshCount recounts the documents matching queries in the background and caches the result under key,
+// unless a refresh of key is already running.
+func (db *DB) refreshCount(ctx context.Context, key string, queries []Query) {
+	if _, running := countRefreshes.LoadOrStore(key, true); running {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), db.options.staleCount)
+	go func() {
+		defer countRefreshes.Delete(key)
+		defer cancel()
+		// countDocuments goes through Aggregate, which recovers its own panics
+		if count, err := db.countDocuments(ctx, queries); err == nil {
+			db.cacheCount(key, count)
+		}
+	}()
+}
+
+// queryCacheKey returns the cache key of the kind ("query" or "count") of results of queries on the collection.
+func (db *DB) queryCacheKey(kind string, colName string, queries []Query) string {
+	// Count passes its queries before soft-deleted documents are excluded, so the soft-delete field is in the key
+	return fmt.Sprintf("fireorm:%s:%s:%s:%s:%s:%#v", kind, colName, db.queryCacheGeneration(colName), db.GetModelType(),
+		db.softDeletePath(), queries)
+}
+
+// resolveValueProviders returns queries with the values of their where clauses' value providers resolved, so
+// that cache keys hold the values queried rather than the providers, which may return other values each time.
+func resolveValueProviders(ctx context.Context, queries []Query) ([]Query, error) {
+	resolved := queries
+	for i, qry := range queries {
+		if !slices.ContainsFunc(qry.Where, func(w WhereClause) bool { return w.ValueProvider != nil }) {
+			continue
+		}
+		if &resolved[0] == &queries[0] {
+			resolved = slices.Clone(queries)
+		}
+		where := slices.Clone(qry.Where)
+		for j, w := range where {
+			if w.ValueProvider == nil {
+				continue
+			}
+			value, err := w.ValueProvider.GetValue(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get value for field %s: %v", w.fieldName(), err)
+			}
+			where[j].Value = value
+			where[j].ValueProvider = nil
+		}
+		resolved[i].Where = where
+	}
+	return resolved, nil
+}
+
+// queryCacheGeneration returns the current generation of the collection's cached results.
+// The generation is part of the cache keys, so replacing it invalidates all previously cached results.
+func (db *DB) queryCacheGeneration(colName string) string {
+	generation, ok := db.options.queryCache.Get(queryCacheGenerationKey(colName))
+	if !ok {
+		return "0"
+	}
+	return fmt.Sprint(generation)
+}
+
+// invalidateQueryCache drops the cached results of the collection, if there is a query cache.
+func (db *DB) invalidateQueryCache(colName string) {
+	if db.options.queryCache == nil {
+		return
+	}
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36)
+	db.options.queryCache.Set(queryCacheGenerationKey(colName), generation, 0)
+}
+
+// queryCacheGenerationKey returns the cache key of the collection's generation.
+func queryCacheGenerationKey(colName string) string {
+	return "fireorm:generation:" + colName
+}
@@ -0,0 +1,66 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"google.golang.org/grpc/metadata"
+	"maps"
+	"slices"
+)
+
+// CallOptions tune the Firestore calls made by the operations of a DB instance, as an escape hatch for advanced
+// cases. The Firestore SDK takes client options (option.ClientOption) when the client is created and has no
+// per-call options for most calls, so only the settings below can be applied per operation; see also
+// WithReadTime and WithConsistency for read options.
+type CallOptions struct {
+	// Metadata is sent as gRPC request metadata with every call of an operation, e.g. for routing or tracing
+	// headers, in addition to the metadata already carried by its context.
+	Metadata map[string]string
+	// TransactionOptions are passed to the transactions started by RunInTransaction and by the operations running
+	// in a transaction of their own (SaveIfNewer, Claim and the like), e.g. firestore.ReadOnly. RunInTransaction
+	// manages attempts itself (see WithMaxTransactionRetries), so firestore.MaxAttempts has no effect there.
+	TransactionOptions []firestore.TransactionOption
+}
+
+// WithCallOptions returns a new DB instance applying opts to the Firestore calls of its operations.
+func (db *DB) WithCallOptions(opts CallOptions) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.callOptions = CallOptions{
+		Metadata:           maps.Clone(opts.Metadata),
+		TransactionOptions: slices.Clone(opts.TransactionOptions),
+	}
+	return newInstance
+}
+
+// GetCallOptions returns the options applied to the Firestore calls of operations.
+func (db *DB) GetCallOptions() CallOptions {
+	return db.options.callOptions
+}
+
+// prepare returns the context and DB instance an operation called with ctx runs with: ctx carrying the call
+// metadata, and db bound to the transaction carried by ctx, if any (see contextTransaction).
+func (db *DB) prepare(ctx context.Context) (context.Context, *DB) {
+	db = db.contextTransaction(ctx)
+	if ctx == nil || len(db.options.callOptions.Metadata) == 0 {
+		return ctx, db
+	}
+	// Operations built on other operations prepare the same context again, so pairs already sent are skipped
+	sent, _ := metadata.FromOutgoingContext(ctx)
+	var pairs []string
+	for key, value := range db.options.callOptions.Metadata {
+		if !slices.Contains(sent.Get(key), value) {
+			pairs = append(pairs, key, value)
+		}
+	}
+	if len(pairs) == 0 {
+		return ctx, db
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...), db
+}
+
+// transactionOptions returns the TransactionOptions of the call options followed by extra, which take precedence.
+func (db *DB) transactionOptions(extra ...firestore.TransactionOption) []firestore.TransactionOption {
+	return append(slices.Clone(db.options.callOptions.TransactionOptions), extra...)
+}
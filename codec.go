@@ -0,0 +1,217 @@
+package fireorm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"strings"
+)
+
+// EncryptedTagOption is the "fireorm" tag option marking fields passed through the field codec,
+// e.g. `firestore:"ssn" fireorm:"ssn,encrypted"`.
+const EncryptedTagOption = "encrypted"
+
+// LowercaseTagOption is the "fireorm" tag option marking string fields stored lowercased, such as emails,
+// e.g. `firestore:"email" fireorm:"email,lowercase"`. Saves lowercase their values, as do the where clauses
+// comparing them, so that lookups ignore case. Slices of strings are lowercased element by element.
+const LowercaseTagOption = "lowercase"
+
+// GzipTagOption is the "fireorm" tag option marking []byte or string fields stored gzip-compressed, for large
+// blobs such as JSON payloads, e.g. `firestore:"payload" fireorm:"payload,gzip"`. Values are compressed on
+// write and decompressed on read; empty values are stored as is. Only top-level fields of the model are
+// decompressed, and the option cannot be combined with the EncryptedTagOption.
+const GzipTagOption = "gzip"
+
+// MaxGzipFieldSize is the maximum size, in bytes, of a decompressed GzipTagOption field. Reads of larger values
+// fail instead of allocating them, so a small stored value cannot expand without bound.
+const MaxGzipFieldSize = 16 * MaxDocumentSize
+
+// Codec transforms the values of encrypted fields: Encode runs on the value before it is written
+// and Decode on the stored value after it is read. Encode and Decode must be inverses.
+// Decode runs after the document is decoded into the model, so the encoded value must also be
+// assignable to the field; use string or []byte fields for encrypted data.
+type Codec struct {
+	Encode func(value interface{}) (interface{}, error)
+	Decode func(value interface{}) (interface{}, error)
+}
+
+// WithFieldCodec returns a new DB instance passing the fields tagged with the EncryptedTagOption
+// "fireorm" option through codec on write and read. Other fields are untouched.
+func (db *DB) WithFieldCodec(codec Codec) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.encode.FieldCodec = &codec
+	return newInstance
+}
+
+// encodeField lowercases value if the field is tagged as lowercase, and applies the field codec to it if the
+// field is tagged as encrypted.
+func encodeField(fieldDef reflect.StructField, value interface{}, opts EncodeOptions) (interface{}, error) {
+	if HasFireormOption(fieldDef, LowercaseTagOption) {
+		value = lowercaseValue(value)
+	}
+	if HasFireormOption(fieldDef, GzipTagOption) {
+		compressed, err := gzipValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress field %s: %v", fieldDef.Name, err)
+		}
+		value = compressed
+	}
+	if !HasFireormOption(fieldDef, EncryptedTagOption) {
+		return value, nil
+	}
+	if opts.FieldCodec == nil || opts.FieldCodec.Encode == nil {
+		return nil, fmt.Errorf("field %s is encrypted but no field codec is configured", fieldDef.Name)
+	}
+	encoded, err := opts.FieldCodec.Encode(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode field %s: %v", fieldDef.Name, err)
+	}
+	return encoded, nil
+}
+
+// decodeFields sets the encrypted fields of dest to their decoded values from the stored document data.
+func decodeFields(dest interface{}, data map[string]interface{}, codec *Codec) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fieldDef := t.Field(i)
+		if !HasFireormOption(fieldDef, EncryptedTagOption) {
+			continue
+		}
+		name, _ := FirestoreFieldName(fieldDef)
+		stored, ok := data[name]
+		if !ok || stored == nil {
+			continue
+		}
+		if codec == nil || codec.Decode == nil {
+			return fmt.Errorf("field %s is encrypted but no field codec is configured", fieldDef.Name)
+		}
+		decoded, err := codec.Decode(stored)
+		if err != nil {
+			return fmt.Errorf("failed to decode field %s: %v", fieldDef.Name, err)
+		}
+		decodedVal := reflect.ValueOf(decoded)
+		if !decodedVal.IsValid() {
+			v.Field(i).Set(reflect.Zero(fieldDef.Type))
+			continue
+		}
+		if !decodedVal.Type().AssignableTo(fieldDef.Type) {
+			return fmt.Errorf("decoded value of type %s cannot be assigned to field %s of type %s", decodedVal.Type(), fieldDef.Name, fieldDef.Type)
+		}
+		v.Field(i).Set(decodedVal)
+	}
+	return nil
+}
+
+// lowercaseValue lowercases a string value, or the strings of a slice, as used by the "in" and "array-contains-any"
+// operators. Other values are returned unchanged.
+func lowercaseValue(value interface{}) interface{} {
+	if p, ok := value.(*string); ok && p != nil {
+		return strings.ToLower(*p)
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return strings.ToLower(rv.String())
+	case reflect.Slice, reflect.Array:
+		if kind := rv.Type().Elem().Kind(); kind != reflect.String && kind != reflect.Interface {
+			return value
+		}
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return value
+		}
+		lowered := make([]interface{}, rv.Len())
+		for i := range lowered {
+			lowered[i] = lowercaseValue(rv.Index(i).Interface())
+		}
+		return lowered
+	}
+	return value
+}
+
+// gzipValue compresses a []byte or string value. Nil and empty values are returned unchanged.
+func gzipValue(value interface{}) (interface{}, error) {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return nil, fmt.Errorf("only []byte and string values can be compressed, got %T", value)
+	}
+	if len(raw) == 0 {
+		return value, nil
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipFields returns data with the compressed values of the top-level fields of the struct type t tagged with
+// the GzipTagOption decompressed, as []byte or string depending on the field, and whether t has such fields.
+// data itself is not modified.
+func gunzipFields(t reflect.Type, data map[string]interface{}) (map[string]interface{}, bool, error) {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct {
+		return data, false, nil
+	}
+	var result map[string]interface{}
+	for i := 0; i < t.NumField(); i++ {
+		fieldDef := t.Field(i)
+		if !HasFireormOption(fieldDef, GzipTagOption) {
+			continue
+		}
+		if result == nil {
+			result = maps.Clone(data)
+		}
+		name, _ := FirestoreFieldName(fieldDef)
+		if name == "" {
+			name = fieldDef.Name
+		}
+		compressed, ok := data[name].([]byte)
+		if !ok || len(compressed) == 0 {
+			continue
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to decompress field %s: %v", fieldDef.Name, err)
+		}
+		raw, err := io.ReadAll(io.LimitReader(reader, MaxGzipFieldSize+1))
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to decompress field %s: %v", fieldDef.Name, err)
+		}
+		if len(raw) > MaxGzipFieldSize {
+			return nil, true, fmt.Errorf("failed to decompress field %s: value exceeds %d bytes", fieldDef.Name, MaxGzipFieldSize)
+		}
+		if indirectType(fieldDef.Type).Kind() == reflect.String {
+			result[name] = string(raw)
+		} else {
+			result[name] = raw
+		}
+	}
+	if result == nil {
+		return data, false, nil
+	}
+	return result, true, nil
+}
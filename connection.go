@@ -2,7 +2,10 @@ package fireorm
 
 import (
 	"cloud.google.com/go/firestore"
+	"context"
+	"errors"
 	"fmt"
+	"google.golang.org/api/iterator"
 )
 
 type IConnection interface {
@@ -52,6 +55,31 @@ func (c *Connection) HasClient() bool {
 	return c.client != nil
 }
 
+// HasWritten reports whether a write has been added to the connection's transaction through any DB instance.
+func (c *Connection) HasWritten() bool {
+	return c.transaction != nil && transactionWritten(c.transaction)
+}
+
+// ListRootCollections returns the IDs of all top-level collections of the database.
+func (c *Connection) ListRootCollections(ctx context.Context) ([]string, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var names []string
+	iter := c.client.Collections(ctx)
+	for {
+		colRef, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list root collections: %v", err)
+		}
+		names = append(names, colRef.ID)
+	}
+	return names, nil
+}
+
 func (c *Connection) Close() error {
 	if c.client != nil {
 		return c.client.Close()
@@ -0,0 +1,97 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CounterShardsCollection is the subcollection of a counter document holding its shards.
+	CounterShardsCollection = "shards"
+	// CounterShardField is the shard document field holding the shard's part of the count.
+	CounterShardField = "count"
+)
+
+// IncrementSharded adds delta to the sharded counter counterID of the model's collection. Firestore sustains about
+// one write per second per document, so the counter is split across numShards shard documents, named "0" to
+// numShards-1 in the CounterShardsCollection subcollection of the counterID document, and each increment goes to
+// a random shard. Use CountShards with the same numShards to read the total. numShards may grow over time,
+// but must not shrink, as the counts of the dropped shards would no longer be read.
+func (db *DB) IncrementSharded(ctx context.Context, counterID string, numShards int, delta int64) (err error) {
+	defer recoverError("IncrementSharded", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return ErrReadOnly
+	}
+	refs, err := db.counterShards(counterID, numShards)
+	if err != nil {
+		return err
+	}
+
+	shard := refs[rand.Intn(len(refs))]
+	data := map[string]interface{}{CounterShardField: firestore.Increment(delta)}
+	if db.GetConnection().HasTransaction() {
+		return db.transactionWrite(func(tx *firestore.Transaction) error {
+			return tx.Set(shard, data, firestore.MergeAll)
+		})
+	}
+	if _, err := shard.Set(ctx, data, firestore.MergeAll); err != nil {
+		return fmt.Errorf("failed to increment counter %s: %v", counterID, err)
+	}
+	return nil
+}
+
+// CountShards returns the total of the sharded counter counterID of the model's collection, summing its numShards
+// shards. Shards that were never incremented count as 0.
+func (db *DB) CountShards(ctx context.Context, counterID string, numShards int) (total int64, err error) {
+	defer recoverError("CountShards", &err)
+	ctx, db = db.prepare(ctx)
+	refs, err := db.counterShards(counterID, numShards)
+	if err != nil {
+		return 0, err
+	}
+	if err := db.checkTransactionRead(); err != nil {
+		return 0, err
+	}
+
+	docs, err := db.getAll(ctx, refs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch counter %s: %v", counterID, err)
+	}
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		count, ok := doc.Data()[CounterShardField].(int64)
+		if !ok {
+			return 0, fmt.Errorf("shard %s of counter %s has no integer %s field", doc.Ref.ID, counterID, CounterShardField)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// counterShards returns the references of the numShards shards of the counter counterID.
+func (db *DB) counterShards(counterID string, numShards int) ([]*firestore.DocumentRef, error) {
+	if counterID == "" || strings.Contains(counterID, "/") {
+		return nil, fmt.Errorf("invalid counter ID %q", counterID)
+	}
+	if numShards <= 0 {
+		return nil, fmt.Errorf("number of shards must be positive, got %d", numShards)
+	}
+	colName, err := db.CollectionName()
+	if err != nil {
+		return nil, err
+	}
+
+	shards := db.GetConnection().GetClient().Collection(colName).Doc(counterID).Collection(CounterShardsCollection)
+	refs := make([]*firestore.DocumentRef, numShards)
+	for i := range refs {
+		refs[i] = shards.Doc(strconv.Itoa(i))
+	}
+	return refs, nil
+}
@@ -3,9 +3,20 @@ package fireorm
 import (
 	"cloud.google.com/go/firestore"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"log"
 	"reflect"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // IDB defines the interface for database operations.
@@ -15,26 +26,237 @@ type IDB interface {
 	WithTransaction(tx *firestore.Transaction) IDB
 	CollectionName() (string, error)
 	GetByID(ctx context.Context, model interface{}) error
+	GetByIDWithRaw(ctx context.Context, model interface{}) (map[string]interface{}, error)
+	GetByIDOrDefault(ctx context.Context, model interface{}, defaults interface{}) error
+	GetForUpdate(ctx context.Context, model interface{}) error
+	GetByIDSelect(ctx context.Context, model interface{}, fields ...string) error
+	GetByIDs(ctx context.Context, ids []string, dest interface{}) error
+	GetByIDsOrdered(ctx context.Context, ids []string, dest interface{}) ([]string, error)
+	GetByRefs(ctx context.Context, refs []*firestore.DocumentRef, dest interface{}) error
+	DeleteCollection(ctx context.Context, batchSize int) (int, error)
+	RenameCollection(ctx context.Context, newName string, deleteOld bool) (int, error)
+	IncrementSharded(ctx context.Context, counterID string, numShards int, delta int64) error
+	CountShards(ctx context.Context, counterID string, numShards int) (int64, error)
 	FindOne(ctx context.Context, queries []Query, dest interface{}) error
 	FindAll(ctx context.Context, queries []Query, dest interface{}) error
+	FindSnapshots(ctx context.Context, queries []Query) ([]*firestore.DocumentSnapshot, error)
+	FindUnion(ctx context.Context, queries [][]Query, dest interface{}) error
+	SearchAcross(ctx context.Context, collectionQueries []CollectionQuery, dest *[]SearchResult) error
+	FindPage(ctx context.Context, queries []Query, pageSize int, dest interface{}) (bool, *firestore.DocumentSnapshot, error)
+	FindAllIndexedBy(ctx context.Context, keyField string, queries []Query, dest interface{}) error
+	FindAllJSON(ctx context.Context, queries []Query) ([]byte, error)
+	Export(ctx context.Context, w io.Writer, queries ...[]Query) (int, error)
+	Partitions(ctx context.Context, desiredCount int) ([]Query, error)
+	Import(ctx context.Context, r io.Reader) (int, error)
+	FindAllExplain(ctx context.Context, queries []Query, dest interface{}) (ExplainMetrics, error)
+	Iterator(ctx context.Context, queries []Query) *ModelIterator
+	FindAllPoly(ctx context.Context, queries []Query, discriminatorField string, factory func(typeName string) interface{}, dest *[]interface{}) error
 	ApplyQueries(ctx context.Context, q firestore.Query, queries []Query) (firestore.Query, error)
+	RawQuery(ctx context.Context) (firestore.Query, error)
+	Aggregate(ctx context.Context, queries []Query, specs []AggregateSpec) (map[string]interface{}, error)
+	RunAggregations(ctx context.Context, queries map[string][]Query, specs []AggregateSpec) (map[string]map[string]interface{}, error)
+	Count(ctx context.Context, queries []Query) (int64, error)
+	WithStaleCount(maxStale time.Duration) IDB
+	CountUpTo(ctx context.Context, queries []Query, upTo int64) (int64, error)
+	CountDistinct(ctx context.Context, field string, queries []Query) (int64, error)
+	WithDistinctLimit(limit int) IDB
+	CountByTimeBucket(ctx context.Context, timeField string, start, end time.Time, bucket time.Duration, extra []Query) (map[time.Time]int64, error)
+	Watch(ctx context.Context, queries []Query, projection interface{}, handler func(event WatchEvent) error) error
 	Save(ctx context.Context, model interface{}, fieldsToSave ...string) error
+	Claim(ctx context.Context, model interface{}, leaseField string, ttl time.Duration) (bool, error)
+	SaveIfNewer(ctx context.Context, model interface{}, compareField string) error
+	SaveIdempotent(ctx context.Context, model interface{}, key string) error
+	SaveAll(ctx context.Context, models interface{}) ([]string, error)
+	BatchUpsert(ctx context.Context, models interface{}) error
 	Update(ctx context.Context, model interface{}, updates []firestore.Update, where ...[]Query) error
+	UpdateAllowed(ctx context.Context, model interface{}, updates []firestore.Update, allowed []string) error
 	Delete(ctx context.Context, model interface{}) error
+	DeleteStrict(ctx context.Context, model interface{}) error
+	Move(ctx context.Context, model interface{}, targetCollection string) (string, error)
+	Diff(ctx context.Context, model interface{}) (map[string]FieldChange, error)
+	ArrayAppend(ctx context.Context, model interface{}, field string, elems ...interface{}) error
+	ArrayRemove(ctx context.Context, model interface{}, field string, elems ...interface{}) error
+	UpdateMax(ctx context.Context, model interface{}, field string, value interface{}) error
+	UpdateMin(ctx context.Context, model interface{}, field string, value interface{}) error
 	GetID(model interface{}) string
+	DocRef(model interface{}) (*firestore.DocumentRef, error)
+	ListSubcollections(ctx context.Context, model interface{}) ([]string, error)
+	GetAggregate(ctx context.Context, model interface{}, subSpecs []SubcollectionSpec) error
 	GetModelType() reflect.Type
 	GetModelValue() reflect.Value
 	SetUpdateBatchSize(size int) IDB
 	GetUpdateBatchSize() int
+	WithProgress(progress func(processed int)) IDB
 	GetConnection() IConnection
 	SetConnection(conn IConnection) IDB
+	WithDuplicateKeyPolicy(policy DuplicateKeyPolicy) IDB
+	WithDecodeErrorPolicy(policy DecodeErrorPolicy) IDB
+	WithMutationSink(sink MutationSink) IDB
+	GetDuplicateKeyPolicy() DuplicateKeyPolicy
+	WithJSONIDKey(key string) IDB
+	GetJSONIDKey() string
+	WithNilSliceMode(mode NilSliceMode) IDB
+	WithTimeTruncation(enabled bool) IDB
+	WithStripIDOnWrite() IDB
+	WithMapKeyConversion(enabled bool) IDB
+	WithExcludedFields(fields ...string) IDB
+	WithFieldAllowlist(fields []string) IDB
+	WithStrictFieldMask() IDB
+	WithFieldCodec(codec Codec) IDB
+	GetEncodeOptions() EncodeOptions
+	WithConcurrency(n int) IDB
+	GetConcurrency() int
+	WithConsistency(level ConsistencyLevel) IDB
+	WithCallOptions(opts CallOptions) IDB
+	GetCallOptions() CallOptions
+	WithIdempotencyCollection(name string) IDB
+	GetIdempotencyCollection() string
+	GetConsistency() ConsistencyLevel
+	WithReadTime(t time.Time) IDB
+	GetReadTime() time.Time
+	WithRecursiveDelete(recursive bool) IDB
+	WithCollectionPrefix(prefix string) IDB
+	WithCollectionSuffix(suffix string) IDB
+	UnderSameParent(ctx context.Context, model interface{}) IDB
+	WithIDGenerator(generator IDGenerator) IDB
+	WithReadOnly() IDB
+	WithUpdateOnly() IDB
+	WithSoftDelete(field string) IDB
+	Unscoped() IDB
+	WithStrictDecoding() IDB
+	WithNumberNormalization() IDB
+	WithQueryCache(cache Cache, ttl time.Duration) IDB
+	WithMaxTransactionRetries(n int) IDB
+	WithRetryClassifier(retryable func(err error) bool) IDB
+	GetMaxTransactionRetries() int
+	RunInTransaction(ctx context.Context, fn func(ctx context.Context, tx IDB) error) error
+	HasTransaction(ctx context.Context) bool
+}
+
+// ErrReadOnly is returned by write operations on a DB instance created with WithReadOnly.
+var ErrReadOnly = errors.New("writes are disabled in read-only mode")
+
+// ErrNotFound is returned by operations requiring a document that does not exist, such as DeleteStrict.
+var ErrNotFound = errors.New("document not found")
+
+// ErrReadTimeQuery is returned by queries on a DB instance created with WithReadTime, outside of transactions.
+// The Firestore SDK applies read times to queries per client, not per query, so they cannot be read at the
+// read time of the instance.
+var ErrReadTimeQuery = errors.New("queries cannot be read at the read time set with WithReadTime")
+
+// ErrDistinctLimit is returned by CountDistinct when more distinct values are found than the limit set with
+// WithDistinctLimit.
+var ErrDistinctLimit = errors.New("distinct value limit exceeded")
+
+// ConsistencyLevel defines the consistency of reads.
+type ConsistencyLevel int
+
+const (
+	// ConsistencyStrong reads the latest committed data. This is Firestore's default.
+	ConsistencyStrong ConsistencyLevel = iota
+	// ConsistencyEventual reads data as of EventualConsistencyStaleness ago, which Firestore
+	// can serve with lower latency.
+	ConsistencyEventual
+)
+
+// EventualConsistencyStaleness is how far in the past ConsistencyEventual reads are served from.
+const EventualConsistencyStaleness = 15 * time.Second
+
+// EventualReadTime returns the read time ConsistencyEventual reads use when issued at now.
+// It is truncated to microseconds, the precision of Firestore read times.
+func EventualReadTime(now time.Time) time.Time {
+	return now.Add(-EventualConsistencyStaleness).Truncate(time.Microsecond)
+}
+
+// DuplicateKeyPolicy defines how FindAllIndexedBy handles documents sharing the same key.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeyLastWins keeps the last document decoded for a given key.
+	DuplicateKeyLastWins DuplicateKeyPolicy = iota
+	// DuplicateKeyError makes FindAllIndexedBy fail when a key is seen twice.
+	DuplicateKeyError
+)
+
+// DecodeErrorPolicy defines how FindAll and ModelIterator handle documents that cannot be decoded into the model.
+type DecodeErrorPolicy int
+
+const (
+	// DecodeErrorFail makes the read fail with the decode error. This is the default.
+	DecodeErrorFail DecodeErrorPolicy = iota
+	// DecodeErrorSkip leaves the documents that cannot be decoded out of the results.
+	DecodeErrorSkip
+	// DecodeErrorCollect leaves the documents that cannot be decoded out of the results like DecodeErrorSkip, and
+	// reports their errors: FindAll stores the other results and returns an *ErrPartialDecode, and ModelIterator
+	// returns them from DecodeErrors.
+	DecodeErrorCollect
+)
+
+// ErrPartialDecode is returned by FindAll under DecodeErrorCollect when some documents could not be decoded.
+// The results of the other documents are stored in dest. Errors holds the decode error of each such document,
+// keyed by document ID.
+type ErrPartialDecode struct {
+	Errors map[string]error
+}
+
+func (e *ErrPartialDecode) Error() string {
+	ids := make([]string, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	messages := make([]string, len(ids))
+	for i, id := range ids {
+		messages[i] = fmt.Sprintf("%s: %v", id, e.Errors[id])
+	}
+	return fmt.Sprintf("%d documents could not be decoded: %s", len(ids), strings.Join(messages, "; "))
+}
+
+func (e *ErrPartialDecode) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
 }
 
 type dbOptions struct {
-	conn            IConnection
-	modelType       reflect.Type
-	modelVal        reflect.Value
-	updateBatchSize int
+	conn                  IConnection
+	modelType             reflect.Type
+	modelVal              reflect.Value
+	updateBatchSize       int
+	duplicateKeys         DuplicateKeyPolicy
+	jsonIDKey             string
+	encode                EncodeOptions
+	concurrency           int
+	consistency           ConsistencyLevel
+	readTime              time.Time
+	recursiveDelete       bool
+	collectionPrefix      string
+	collectionSuffix      string
+	parentPath            string
+	parentErr             error
+	idGenerator           IDGenerator
+	readOnly              bool
+	updateOnly            bool
+	strictDecoding        bool
+	normalizeNumbers      bool
+	fieldAllowlist        []string
+	callOptions           CallOptions
+	idempotencyCollection string
+	distinctLimit         int
+	progress              func(processed int)
+	decodeErrorPolicy     DecodeErrorPolicy
+	mutationSink          MutationSink
+	strictFieldMask       bool
+	maxTransactionRetries int
+	retryClassifier       func(err error) bool
+	queryCache            Cache
+	queryCacheTTL         time.Duration
+	staleCount            time.Duration
+	registration          *modelRegistration
+	softDeleteField       string
+	unscoped              bool
 }
 
 // DB holds the Firestore connection and state about the current model.
@@ -46,10 +268,15 @@ type DB struct {
 func New(conn IConnection) IDB {
 	return &DB{
 		options: dbOptions{
-			conn:            conn,
-			modelType:       nil,
-			modelVal:        reflect.Value{},
-			updateBatchSize: 100,
+			conn:                  conn,
+			modelType:             nil,
+			modelVal:              reflect.Value{},
+			updateBatchSize:       100,
+			duplicateKeys:         DuplicateKeyLastWins,
+			jsonIDKey:             "id",
+			idempotencyCollection: DefaultIdempotencyCollection,
+			concurrency:           10,
+			maxTransactionRetries: DefaultMaxTransactionRetries,
 		},
 	}
 }
@@ -74,13 +301,23 @@ func (db *DB) WithConnection(connection IConnection) IDB {
 	return newInstance
 }
 
-// SetUpdateBatchSize sets the size of the update batch.
+// SetUpdateBatchSize returns a new DB instance with the given update batch size.
+// Update by query reads one page of this size and commits it as a single write batch,
+// so the size is clamped to Firestore's BatchWriteLimit. Non-positive sizes are ignored.
 func (db *DB) SetUpdateBatchSize(size int) IDB {
 	newInstance := &DB{
 		options: db.options,
 	}
-	newInstance.options.updateBatchSize = size
-	return db
+	switch {
+	case size <= 0:
+		log.Printf("fireorm: ignoring invalid update batch size %d, keeping %d", size, db.options.updateBatchSize)
+	case size > BatchWriteLimit:
+		log.Printf("fireorm: update batch size %d exceeds the Firestore limit, using %d", size, BatchWriteLimit)
+		newInstance.options.updateBatchSize = BatchWriteLimit
+	default:
+		newInstance.options.updateBatchSize = size
+	}
+	return newInstance
 }
 
 // GetUpdateBatchSize returns the size of the update batch.
@@ -88,6 +325,308 @@ func (db *DB) GetUpdateBatchSize() int {
 	return db.options.updateBatchSize
 }
 
+// WithProgress returns a new DB instance calling progress after each write batch committed by the bulk
+// operations (Update by query, SaveAll, BatchUpsert and DeleteCollection), with the cumulative number of documents
+// processed by the operation so far, e.g. to drive a progress bar. Counts only increase within an operation.
+// Writes in a transaction are committed at once and not reported. A nil progress removes the callback.
+func (db *DB) WithProgress(progress func(processed int)) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.progress = progress
+	return newInstance
+}
+
+// reportProgress passes the number of documents processed so far by a bulk operation to the WithProgress
+// callback, if any.
+func (db *DB) reportProgress(processed int) {
+	if db.options.progress != nil {
+		db.options.progress(processed)
+	}
+}
+
+// WithDecodeErrorPolicy returns a new DB instance handling the documents FindAll and Iterator cannot decode
+// according to policy, for reads tolerating malformed data. Other reads keep failing on decode errors.
+func (db *DB) WithDecodeErrorPolicy(policy DecodeErrorPolicy) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.decodeErrorPolicy = policy
+	return newInstance
+}
+
+// WithDuplicateKeyPolicy returns a new DB instance using the given duplicate key policy.
+func (db *DB) WithDuplicateKeyPolicy(policy DuplicateKeyPolicy) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.duplicateKeys = policy
+	return newInstance
+}
+
+// GetDuplicateKeyPolicy returns the duplicate key policy used by FindAllIndexedBy.
+func (db *DB) GetDuplicateKeyPolicy() DuplicateKeyPolicy {
+	return db.options.duplicateKeys
+}
+
+// WithJSONIDKey returns a new DB instance storing the document ID under key in FindAllJSON results
+// and Export lines, and reading it from there in Import lines.
+func (db *DB) WithJSONIDKey(key string) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.jsonIDKey = key
+	return newInstance
+}
+
+// GetJSONIDKey returns the key under which FindAllJSON, Export and Import store the document ID.
+func (db *DB) GetJSONIDKey() string {
+	return db.options.jsonIDKey
+}
+
+// WithNilSliceMode returns a new DB instance storing nil slice fields according to mode.
+// By default nil slices are stored as null (NilSliceAsNull).
+func (db *DB) WithNilSliceMode(mode NilSliceMode) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.encode.NilSlices = mode
+	return newInstance
+}
+
+// WithTimeTruncation returns a new DB instance truncating time.Time fields to microseconds on write,
+// so that the values in memory match the values Firestore stores and returns.
+func (db *DB) WithTimeTruncation(enabled bool) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.encode.TruncateTimes = enabled
+	return newInstance
+}
+
+// WithStripIDOnWrite returns a new DB instance leaving the ID field out of the written data, even when it is
+// tagged (e.g. `firestore:"id"`), so that documents never store their own ID. The ID is still set on read.
+func (db *DB) WithStripIDOnWrite() IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.encode.StripID = true
+	return newInstance
+}
+
+// WithMapKeyConversion returns a new DB instance storing maps with integer, boolean or encoding.TextMarshaler
+// keys (such as a map[int]string field) with their keys formatted as strings; see EncodeOptions.ConvertMapKeys.
+// Reads parse the keys back, whatever the option. Without it, writing such a map fails before anything is sent.
+func (db *DB) WithMapKeyConversion(enabled bool) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.encode.ConvertMapKeys = enabled
+	return newInstance
+}
+
+// WithExcludedFields returns a new DB instance leaving the given top-level fields, named by their Go name or
+// their firestore tag, out of the data written by Save and the batch writes, without changing the struct tags.
+// Listing an excluded field in a partial Save is an error. Calling it again replaces the excluded fields.
+func (db *DB) WithExcludedFields(fields ...string) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.encode.ExcludedFields = append([]string(nil), fields...)
+	return newInstance
+}
+
+// GetEncodeOptions returns the options used to convert models to Firestore data on write.
+func (db *DB) GetEncodeOptions() EncodeOptions {
+	return db.options.encode
+}
+
+// WithConcurrency returns a new DB instance running at most n requests in parallel in concurrent operations.
+// Values lower than 1 are treated as 1.
+func (db *DB) WithConcurrency(n int) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	if n < 1 {
+		n = 1
+	}
+	newInstance.options.concurrency = n
+	return newInstance
+}
+
+// GetConcurrency returns the maximum number of parallel requests in concurrent operations.
+func (db *DB) GetConcurrency() int {
+	return db.options.concurrency
+}
+
+// WithConsistency returns a new DB instance reading with the given consistency level.
+// Firestore is strongly consistent by default. ConsistencyEventual only affects single-document
+// reads outside of transactions (GetByID and the operations built on it): the Firestore SDK applies
+// read times to queries per client, not per query, and transactions always read their own snapshot.
+func (db *DB) WithConsistency(level ConsistencyLevel) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.consistency = level
+	return newInstance
+}
+
+// GetConsistency returns the consistency level of reads.
+func (db *DB) GetConsistency() ConsistencyLevel {
+	return db.options.consistency
+}
+
+// WithReadTime returns a new DB instance reading documents as they were at t, which takes precedence over the
+// consistency level. Like all options, the read time carries over to the instances derived from it with Model
+// and the other With methods, so the reads of a report spanning several models all see the same snapshot when
+// they start from db.WithReadTime(time.Now()). Firestore keeps versions for an hour (seven days with
+// point-in-time recovery) and reads at whole seconds, so t is truncated to the second.
+// The read time applies to single-document reads outside of transactions (GetByID, GetByIDs, GetByRefs and the
+// operations built on them); queries and aggregations return ErrReadTimeQuery instead of reading the latest data,
+// and transactions always read their own snapshot.
+func (db *DB) WithReadTime(t time.Time) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.readTime = t.Truncate(time.Second)
+	return newInstance
+}
+
+// GetReadTime returns the time documents are read at, or the zero time when reading the latest data.
+func (db *DB) GetReadTime() time.Time {
+	return db.options.readTime
+}
+
+// WithRecursiveDelete returns a new DB instance where DeleteCollection also deletes subcollections.
+func (db *DB) WithRecursiveDelete(recursive bool) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.recursiveDelete = recursive
+	return newInstance
+}
+
+// WithCollectionPrefix returns a new DB instance prepending prefix to every collection name (e.g. "dev_users").
+func (db *DB) WithCollectionPrefix(prefix string) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.collectionPrefix = prefix
+	return newInstance
+}
+
+// WithCollectionSuffix returns a new DB instance appending suffix to every collection name (e.g. "users_staging").
+func (db *DB) WithCollectionSuffix(suffix string) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.collectionSuffix = suffix
+	return newInstance
+}
+
+// UnderSameParent returns a new DB instance for the model's type whose collection is the subcollection of the
+// document referenced by the model's parent field, so that queries and writes address the model's siblings.
+// The parent field is the *firestore.DocumentRef field tagged with the ParentTagOption "fireorm" option,
+// or the model's only *firestore.DocumentRef field. If there is no such field or it is nil,
+// every operation of the returned instance fails.
+func (db *DB) UnderSameParent(ctx context.Context, model interface{}) IDB {
+	newInstance := db.Model(model).(*DB)
+	parent, err := ParentRef(model)
+	if err != nil {
+		newInstance.options.parentErr = err
+		return newInstance
+	}
+	newInstance.options.parentPath = documentPath(parent)
+	newInstance.options.parentErr = nil
+	return newInstance
+}
+
+// WithIDGenerator returns a new DB instance generating the IDs of new documents with generator
+// (e.g. UUIDGenerator or ULIDGenerator) instead of Firestore's random IDs. Pass nil to restore the default.
+func (db *DB) WithIDGenerator(generator IDGenerator) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.idGenerator = generator
+	return newInstance
+}
+
+// WithReadOnly returns a new DB instance where every write (Save, Update, Delete and the batch operations)
+// fails with ErrReadOnly, while reads keep working. It can be used to block writes during migrations.
+func (db *DB) WithReadOnly() IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.readOnly = true
+	return newInstance
+}
+
+// WithUpdateOnly returns a new DB instance where Save of a model with an ID only writes to an existing document,
+// returning ErrNotFound when it does not exist, instead of creating it. This keeps stale IDs from silently
+// recreating deleted documents. The model's fields are written with Update semantics: stored fields the model
+// does not write are kept. Saves of models without an ID still create new documents.
+func (db *DB) WithUpdateOnly() IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.updateOnly = true
+	return newInstance
+}
+
+// WithSoftDelete returns a new DB instance soft-deleting documents through the field stored as field (a
+// nullable timestamp, null while the document is live), like the SoftDeleteField of RegisterModel, for every
+// model used through it. It takes precedence over the registered SoftDeleteField.
+func (db *DB) WithSoftDelete(field string) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.softDeleteField = field
+	return newInstance
+}
+
+// Unscoped returns a new DB instance ignoring soft deletes: reads return soft-deleted documents
+// and Delete and DeleteStrict permanently delete documents.
+func (db *DB) Unscoped() IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.unscoped = true
+	return newInstance
+}
+
+// WithStrictDecoding returns a new DB instance failing reads of documents holding fields that the model
+// does not declare, with an error listing them, instead of silently ignoring them. It is meant to catch
+// schema drift in tests. A field is declared by its "firestore" tag, or by its Go name when untagged.
+func (db *DB) WithStrictDecoding() IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.strictDecoding = true
+	return newInstance
+}
+
+// WithNumberNormalization returns a new DB instance converting the integers read into untyped values back to int.
+// Fields, map values and slice elements typed interface{} (such as an Extra map[string]interface{} field) are
+// decoded with the types Firestore returns: every integer comes back as int64 whatever its original Go type,
+// every floating-point number as float64, nested maps as map[string]interface{} and arrays as []interface{}.
+// With normalization, int64 values inside them become int, so that data written from ints reads back equal.
+// Floating-point numbers stay float64, even when integral, as Firestore keeps them apart from integers.
+func (db *DB) WithNumberNormalization() IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.normalizeNumbers = true
+	return newInstance
+}
+
+// newDocRef returns a reference to a new document in collection, with an ID from the configured generator.
+func (db *DB) newDocRef(collection *firestore.CollectionRef) *firestore.DocumentRef {
+	if db.options.idGenerator != nil {
+		return collection.Doc(db.options.idGenerator())
+	}
+	return collection.NewDoc()
+}
+
 // GetModelType returns the type of the model associated with the DB instance.
 func (db *DB) GetModelType() reflect.Type {
 	return db.options.modelType
@@ -125,151 +664,534 @@ func (db *DB) Model(model interface{}) IDB {
 	}
 	newInstance.options.modelType = t
 	newInstance.options.modelVal = reflect.New(t)
+	newInstance.options.registration = registeredModel(t)
 	return newInstance
 }
 
 // GetByID retrieves a single document by ID and stores it in dest.
-func (db *DB) GetByID(ctx context.Context, model interface{}) error {
+func (db *DB) GetByID(ctx context.Context, model interface{}) (err error) {
+	defer recoverError("GetByID", &err)
+	ctx, db = db.prepare(ctx)
 	getByIdFunc := func(dbInstance *DB) error {
-		if dbInstance.GetModelType() == nil {
-			return fmt.Errorf("no model set, call db.Model(&Model{}) first")
-		}
-
-		colName, err := dbInstance.CollectionName()
+		doc, err := dbInstance.getDocument(ctx, model)
 		if err != nil {
 			return err
 		}
+		if dbInstance.softDeleted(doc) {
+			return ErrNotFound
+		}
+		return dbInstance.decodeDocument(ctx, doc, model)
+	}
+	return getByIdFunc(db.Model(model).(*DB))
+}
 
-		defer func() {
-			if r := recover(); r != nil {
-				err = fmt.Errorf("panic occurred: %v", r)
-			}
-		}()
+// GetByIDWithRaw retrieves a single document by ID, stores it in model and also returns its raw data,
+// both from the same read.
+func (db *DB) GetByIDWithRaw(ctx context.Context, model interface{}) (raw map[string]interface{}, err error) {
+	defer recoverError("GetByIDWithRaw", &err)
+	ctx, db = db.prepare(ctx)
+	dbInstance := db.Model(model).(*DB)
+	doc, err := dbInstance.getDocument(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	if dbInstance.softDeleted(doc) {
+		return nil, ErrNotFound
+	}
+	if err := dbInstance.decodeDocument(ctx, doc, model); err != nil {
+		return nil, err
+	}
+	return dbInstance.restrictData(doc.Data(), reflect.TypeOf(model)), nil
+}
 
-		id := dbInstance.GetID(model)
-		if id == "" {
-			return fmt.Errorf("ID cannot be empty")
-		}
-		docRef := dbInstance.GetConnection().GetClient().Collection(colName).Doc(id)
+// GetByIDOrDefault works like GetByID, but when the document does not exist (or is soft-deleted), it copies
+// defaults, a struct or pointer to a struct of the model's type, into model instead of returning an error,
+// keeping the model's ID. The copy is shallow: slices, maps and pointers are shared with defaults.
+func (db *DB) GetByIDOrDefault(ctx context.Context, model interface{}, defaults interface{}) (err error) {
+	defer recoverError("GetByIDOrDefault", &err)
+	dest := reflect.ValueOf(model)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() || dest.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("model must be a non-nil pointer to a struct, got %T", model)
+	}
+	source := reflect.Indirect(reflect.ValueOf(defaults))
+	if !source.IsValid() || source.Type() != dest.Elem().Type() {
+		return fmt.Errorf("defaults must be a %s or a pointer to one, got %T", dest.Elem().Type(), defaults)
+	}
 
-		var doc *firestore.DocumentSnapshot
-		if dbInstance.GetConnection().HasTransaction() {
-			doc, err = dbInstance.GetConnection().GetTransaction().Get(docRef)
-		} else {
-			doc, err = docRef.Get(ctx)
-		}
-		if err != nil {
-			return err
+	err = db.GetByID(ctx, model)
+	if !errors.Is(err, ErrNotFound) && status.Code(err) != codes.NotFound {
+		return err
+	}
+	id := db.Model(model).(*DB).GetID(model)
+	dest.Elem().Set(source)
+	SetIDField(model, id)
+	return nil
+}
+
+// GetByIDSelect retrieves only the given fields (by "firestore" name) of the document identified by the model's ID
+// and stores them in model, leaving its other fields unchanged. The fields are read with a projection query on
+// the document ID, so the rest of the document is neither transferred nor decoded. The schema version is read
+// too for models implementing SchemaUpgrader. Being a query, it always reads the latest data, whatever the
+// consistency level. Returns ErrNotFound when the document does not exist.
+func (db *DB) GetByIDSelect(ctx context.Context, model interface{}, fields ...string) (err error) {
+	defer recoverError("GetByIDSelect", &err)
+	ctx, db = db.prepare(ctx)
+	if len(fields) == 0 {
+		return fmt.Errorf("at least one field must be selected")
+	}
+	dbInstance := db.Model(model).(*DB)
+	docRef, err := dbInstance.documentRef(model)
+	if err != nil {
+		return err
+	}
+	unrestricted := dbInstance
+	if allowed, restricted := dbInstance.allowedFields(reflect.TypeOf(model)); restricted {
+		fields = slices.DeleteFunc(slices.Clone(fields), func(field string) bool { return !slices.Contains(allowed, field) })
+		if len(fields) == 0 {
+			return fmt.Errorf("none of the selected fields is allowed")
 		}
+		// The selection is already restricted and must not be replaced by the allowed fields
+		unrestricted = &DB{options: dbInstance.options}
+		unrestricted.options.fieldAllowlist = nil
+	}
+	if _, ok := schemaUpgrader(model); ok {
+		fields = append(fields[:len(fields):len(fields)], SchemaVersionField)
+	}
 
-		err = doc.DataTo(&model)
-		if err != nil {
-			return fmt.Errorf("failed to parse document: %v", err)
+	q := docRef.Parent.Where(firestore.DocumentID, "==", docRef).Select(fields...).Limit(1)
+	docs, err := unrestricted.documents(ctx, q)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return ErrNotFound
+	}
+	return dbInstance.decodeDocument(ctx, docs[0], model)
+}
+
+// documentRef returns the reference of the document identified by the model's ID.
+func (db *DB) documentRef(model interface{}) (*firestore.DocumentRef, error) {
+	if db.GetModelType() == nil {
+		return nil, fmt.Errorf("no model set, call db.Model(&Model{}) first")
+	}
+
+	colName, err := db.CollectionName()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := db.resolveID(model)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("ID cannot be empty")
+	}
+	return db.GetConnection().GetClient().Collection(colName).Doc(id), nil
+}
+
+// getDocument fetches the document identified by the model's ID, within the connection's transaction if there is one.
+func (db *DB) getDocument(ctx context.Context, model interface{}) (doc *firestore.DocumentSnapshot, err error) {
+	docRef, err := db.documentRef(model)
+	if err != nil {
+		return nil, err
+	}
+
+	if db.GetConnection().HasTransaction() {
+		if err := db.checkTransactionRead(); err != nil {
+			return nil, err
 		}
-		return nil
+		return db.GetConnection().GetTransaction().Get(docRef)
 	}
-	return getByIdFunc(db.Model(model).(*DB))
+	switch {
+	case !db.options.readTime.IsZero():
+		docRef = docRef.WithReadOptions(firestore.ReadTime(db.options.readTime))
+	case db.GetConsistency() == ConsistencyEventual:
+		docRef = docRef.WithReadOptions(firestore.ReadTime(EventualReadTime(time.Now())))
+	}
+	return docRef.Get(ctx)
 }
 
 // CollectionName derives the collection name from the model's type name.
 // Customize as needed for your naming conventions.
-func (db *DB) CollectionName() (string, error) {
+// The prefix and suffix set with WithCollectionPrefix and WithCollectionSuffix are added around the name.
+func (db *DB) CollectionName() (name string, err error) {
+	defer recoverError("CollectionName", &err)
 	if db.GetModelType() == nil {
 		return "", fmt.Errorf("no model set")
 	}
 
+	if db.options.parentErr != nil {
+		return "", db.options.parentErr
+	}
+
+	// Default: use the lowercased type name + "s"
+	collectionName := strings.ToLower(db.GetModelType().Name()) + "s"
+
 	// Check if the model has a CollectionName() method
 	method := db.GetModelValue().MethodByName("CollectionName")
 	if method.IsValid() && method.Type().NumIn() == 0 && method.Type().NumOut() == 1 && method.Type().Out(0).Kind() == reflect.String {
 		results := method.Call(nil)
-		collectionName, ok := results[0].Interface().(string)
+		var ok bool
+		collectionName, ok = results[0].Interface().(string)
 		if !ok {
 			return "", fmt.Errorf("CollectionName method does not return a string")
 		}
-		return collectionName, nil
+	}
+	if registration := db.options.registration; registration != nil && registration.config.CollectionName != "" {
+		collectionName = registration.config.CollectionName
 	}
 
-	// Default: use the lowercased type name + "s"
-	return strings.ToLower(db.GetModelType().Name()) + "s", nil
+	return db.qualifiedCollectionName(collectionName), nil
+}
+
+// qualifiedCollectionName returns the path of the collection named name, with the collection prefix and suffix
+// added around it, under the parent document if the DB instance has one.
+func (db *DB) qualifiedCollectionName(name string) string {
+	name = db.options.collectionPrefix + name + db.options.collectionSuffix
+	if db.options.parentPath != "" {
+		// Subcollections are addressed by their slash-separated path from the database root
+		name = db.options.parentPath + "/" + name
+	}
+	return name
 }
 
 // FindAll retrieves multiple documents based on queries and stores them in dest (which must be a pointer to a slice).
-func (db *DB) FindAll(ctx context.Context, queries []Query, dest interface{}) error {
+// When the query needs a missing composite index, the error is an *ErrIndexRequired holding the creation link.
+func (db *DB) FindAll(ctx context.Context, queries []Query, dest interface{}) (err error) {
+	defer recoverError("FindAll", &err)
+	ctx, db = db.prepare(ctx)
 	findAll := func(dbInstance *DB) error {
-		if dbInstance.GetModelType() == nil {
-			return fmt.Errorf("no model set, call db.Model(&Model{}) first")
+		queries := dbInstance.defaultOrdered(dbInstance.scoped(queries))
+		docs, err := dbInstance.findDocuments(ctx, queries)
+		if indexErr, ok := ParseIndexRequired(err, queries); ok {
+			return indexErr
 		}
-
-		colName, err := dbInstance.CollectionName()
 		if err != nil {
 			return err
 		}
+		return dbInstance.appendDocumentsWithPolicy(ctx, docs, dest, dbInstance.options.decodeErrorPolicy)
+	}
+	dbInstance, err := db.sliceModel(dest)
+	if err != nil {
+		return err
+	}
+	return findAll(dbInstance)
+}
 
-		q := dbInstance.GetConnection().GetClient().Collection(colName).Query
+// FindSnapshots runs queries against the model's collection like FindAll, within the connection's transaction
+// if there is one, and returns the document snapshots without decoding them, for callers needing their
+// references, timestamps or raw data.
+func (db *DB) FindSnapshots(ctx context.Context, queries []Query) (snapshots []*firestore.DocumentSnapshot, err error) {
+	defer recoverError("FindSnapshots", &err)
+	ctx, db = db.prepare(ctx)
+	if db.GetModelType() == nil {
+		return nil, fmt.Errorf("no model set, call db.Model(&Model{}) first")
+	}
 
-		if queries != nil && len(queries) != 0 {
-			q, err = dbInstance.ApplyQueries(ctx, q, queries)
-			if err != nil {
+	queries = db.defaultOrdered(db.scoped(queries))
+	q, err := db.buildQuery(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err = db.documents(ctx, q)
+	if indexErr, ok := ParseIndexRequired(err, queries); ok {
+		return nil, indexErr
+	}
+	return snapshots, err
+}
+
+// FindUnion runs each set of queries like FindAll, concurrently (see WithConcurrency), and stores the union
+// of the results in dest (which must be a pointer to a slice), with every document once. Results keep the order
+// of the query sets: the documents of the first set come first, then those of the second set not already
+// included, and so on. It emulates an OR of filters that cannot be combined in a single Firestore query.
+// Errors of the individual query sets are joined, and no results are stored if any set fails.
+func (db *DB) FindUnion(ctx context.Context, queries [][]Query, dest interface{}) (err error) {
+	defer recoverError("FindUnion", &err)
+	ctx, db = db.prepare(ctx)
+	dbInstance, err := db.sliceModel(dest)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	found := make([][]*firestore.DocumentSnapshot, len(queries))
+	concurrency := dbInstance.GetConcurrency()
+	if dbInstance.GetConnection().HasTransaction() {
+		// Transaction reads are issued one at a time
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, setQueries := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, setQueries []Query) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var docs []*firestore.DocumentSnapshot
+			err := func() (err error) {
+				defer recoverError("FindUnion", &err)
+				setQueries = dbInstance.defaultOrdered(dbInstance.scoped(setQueries))
+				docs, err = dbInstance.findDocuments(ctx, setQueries)
+				if indexErr, ok := ParseIndexRequired(err, setQueries); ok {
+					return indexErr
+				}
 				return err
+			}()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("query %d: %w", i, err))
+				return
+			}
+			found[i] = docs
+		}(i, setQueries)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	seen := make(map[string]bool)
+	var union []*firestore.DocumentSnapshot
+	for _, docs := range found {
+		for _, doc := range docs {
+			if !seen[doc.Ref.Path] {
+				seen[doc.Ref.Path] = true
+				union = append(union, doc)
 			}
 		}
+	}
+	return dbInstance.appendDocuments(ctx, union, dest)
+}
 
-		// Handle transaction or no transaction
-		var docs []*firestore.DocumentSnapshot
-		if dbInstance.GetConnection().HasTransaction() {
-			docs, err = dbInstance.GetConnection().GetTransaction().Documents(q).GetAll()
-		} else {
-			docs, err = q.Documents(ctx).GetAll()
+// FindPage retrieves the first pageSize documents matching queries into dest (which must be a pointer to a slice).
+// It reads one extra document to report whether more results follow, and returns the snapshot of the last
+// document of the page (nil if the page is empty), to pass as the StartAfter cursor of the next page.
+// pageSize replaces any limit given in queries.
+func (db *DB) FindPage(ctx context.Context, queries []Query, pageSize int, dest interface{}) (hasMore bool, lastDoc *firestore.DocumentSnapshot, err error) {
+	defer recoverError("FindPage", &err)
+	ctx, db = db.prepare(ctx)
+	if pageSize <= 0 {
+		return false, nil, fmt.Errorf("page size must be positive, got %d", pageSize)
+	}
+	dbInstance, err := db.sliceModel(dest)
+	if err != nil {
+		return false, nil, err
+	}
+
+	q, err := dbInstance.buildQuery(ctx, dbInstance.defaultOrdered(dbInstance.scoped(queries)))
+	if err != nil {
+		return false, nil, err
+	}
+	docs, err := dbInstance.documents(ctx, q.Limit(pageSize+1))
+	if err != nil {
+		return false, nil, err
+	}
+	if len(docs) > pageSize {
+		hasMore = true
+		docs = docs[:pageSize]
+	}
+	if len(docs) > 0 {
+		lastDoc = docs[len(docs)-1]
+	}
+	return hasMore, lastDoc, dbInstance.appendDocuments(ctx, docs, dest)
+}
+
+// FindAllExplain works like FindAll but runs the query with Firestore's query explain enabled
+// and returns the reported plan and execution metrics alongside the decoded results.
+func (db *DB) FindAllExplain(ctx context.Context, queries []Query, dest interface{}) (metrics ExplainMetrics, err error) {
+	defer recoverError("FindAllExplain", &err)
+	ctx, db = db.prepare(ctx)
+	dbInstance, err := db.sliceModel(dest)
+	if err != nil {
+		return metrics, err
+	}
+
+	q, err := dbInstance.buildQuery(ctx, dbInstance.defaultOrdered(dbInstance.scoped(queries)))
+	if err != nil {
+		return metrics, err
+	}
+
+	iter, err := dbInstance.documentIterator(ctx, q.WithRunOptions(firestore.ExplainOptions{Analyze: true}))
+	if err != nil {
+		return metrics, err
+	}
+	docs, err := iter.GetAll()
+	if err != nil {
+		return metrics, err
+	}
+	if err := dbInstance.appendDocuments(ctx, docs, dest); err != nil {
+		return metrics, err
+	}
+
+	explain, err := iter.ExplainMetrics()
+	if err != nil {
+		return metrics, fmt.Errorf("failed to get explain metrics: %v", err)
+	}
+	if explain == nil {
+		return metrics, nil
+	}
+	if explain.PlanSummary != nil {
+		for _, index := range explain.PlanSummary.IndexesUsed {
+			if index != nil {
+				metrics.IndexesUsed = append(metrics.IndexesUsed, *index)
+			}
 		}
-		if err != nil {
-			return err
+	}
+	if stats := explain.ExecutionStats; stats != nil {
+		metrics.ResultsReturned = stats.ResultsReturned
+		metrics.ReadOperations = stats.ReadOperations
+		if stats.ExecutionDuration != nil {
+			metrics.ExecutionDuration = *stats.ExecutionDuration
 		}
-
-		rv := reflect.ValueOf(dest)
-		if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
-			return fmt.Errorf("dest must be a pointer to a slice")
+		if stats.DebugStats != nil {
+			metrics.DebugStats = *stats.DebugStats
 		}
+	}
+	return metrics, nil
+}
 
-		sliceVal := rv.Elem()
-		for _, doc := range docs {
-			newInstance := reflect.New(dbInstance.GetModelType()).Interface()
-			if err := doc.DataTo(newInstance); err != nil {
-				return fmt.Errorf("failed to parse document: %v", err)
+// FindAllIndexedBy retrieves multiple documents based on queries and stores them in dest
+// (which must be a pointer to a map of structs), keyed by the value of keyField.
+// keyField may be either the Go field name or its firestore tag.
+func (db *DB) FindAllIndexedBy(ctx context.Context, keyField string, queries []Query, dest interface{}) (err error) {
+	defer recoverError("FindAllIndexedBy", &err)
+	ctx, db = db.prepare(ctx)
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Map {
+		return fmt.Errorf("dest must be a pointer to a map")
+	}
+	mapType := rv.Elem().Type()
+	elemType := mapType.Elem()
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("dest map element must be a struct")
+	}
+
+	items := reflect.New(reflect.SliceOf(elemType))
+	if err := db.FindAll(ctx, queries, items.Interface()); err != nil {
+		return err
+	}
+
+	mapVal := rv.Elem()
+	if mapVal.IsNil() {
+		mapVal.Set(reflect.MakeMap(mapType))
+	}
+	for i := 0; i < items.Elem().Len(); i++ {
+		item := items.Elem().Index(i)
+		key, ok := FieldByName(item, keyField)
+		if !ok {
+			return fmt.Errorf("field %s not found in model", keyField)
+		}
+		if !key.Type().AssignableTo(mapType.Key()) {
+			// reflect converts integers to strings as runes, so only string-to-string conversions are allowed
+			if !key.Type().ConvertibleTo(mapType.Key()) || (mapType.Key().Kind() == reflect.String) != (key.Kind() == reflect.String) {
+				return fmt.Errorf("field %s of type %s cannot be used as a %s map key", keyField, key.Type(), mapType.Key())
 			}
-			SetIDField(newInstance, doc.Ref.ID)
-			sliceVal = reflect.Append(sliceVal, reflect.ValueOf(newInstance).Elem())
+			key = key.Convert(mapType.Key())
 		}
-		rv.Elem().Set(sliceVal)
-		return nil
+		if !key.Comparable() {
+			return fmt.Errorf("field %s of type %s is not comparable and cannot be used as a map key", keyField, key.Type())
+		}
+		if db.GetDuplicateKeyPolicy() == DuplicateKeyError && mapVal.MapIndex(key).IsValid() {
+			return fmt.Errorf("duplicate key %v for field %s", key.Interface(), keyField)
+		}
+		mapVal.SetMapIndex(key, item)
 	}
-	// Dest is a slice of structs, so check what is the destination type
-	destType := reflect.TypeOf(dest).Elem()
-	if destType.Kind() != reflect.Slice {
+	return nil
+}
+
+// FindAllPoly retrieves multiple documents of different types from the current model's collection.
+// For each document, the string value of discriminatorField is passed to factory, which must return a pointer
+// to a new instance of the matching struct (or nil for unknown types). The document is decoded into that
+// instance, its ID is set and it is appended to dest.
+func (db *DB) FindAllPoly(ctx context.Context, queries []Query, discriminatorField string, factory func(typeName string) interface{}, dest *[]interface{}) (err error) {
+	defer recoverError("FindAllPoly", &err)
+	ctx, db = db.prepare(ctx)
+	if dest == nil {
 		return fmt.Errorf("dest must be a pointer to a slice")
 	}
-	// Check what is the type of one slice element
-	elemType := destType.Elem()
-	if elemType.Kind() != reflect.Struct {
-		return fmt.Errorf("dest slice element must be a struct")
+
+	q, err := db.buildQuery(ctx, db.defaultOrdered(db.scoped(queries)))
+	if err != nil {
+		return err
+	}
+
+	docs, err := db.documents(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		value, err := doc.DataAt(discriminatorField)
+		if err != nil {
+			return fmt.Errorf("document %s has no discriminator field %s: %v", doc.Ref.ID, discriminatorField, err)
+		}
+		typeName, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("discriminator field %s of document %s is not a string", discriminatorField, doc.Ref.ID)
+		}
+
+		instance := factory(typeName)
+		if instance == nil {
+			return fmt.Errorf("unknown type %q for document %s", typeName, doc.Ref.ID)
+		}
+		if reflect.TypeOf(instance).Kind() != reflect.Ptr {
+			return fmt.Errorf("factory must return a pointer for type %q", typeName)
+		}
+		if err := db.decodeDocument(ctx, doc, instance); err != nil {
+			return err
+		}
+		*dest = append(*dest, instance)
 	}
-	elemTypeInstance := reflect.New(elemType).Interface()
-	return findAll(db.Model(elemTypeInstance).(*DB))
+	return nil
+}
+
+// FindAllJSON retrieves multiple documents based on queries and returns them as a JSON array.
+// Each object holds the document data plus its ID under the key set by WithJSONIDKey ("id" by default).
+func (db *DB) FindAllJSON(ctx context.Context, queries []Query) (data []byte, err error) {
+	defer recoverError("FindAllJSON", &err)
+	ctx, db = db.prepare(ctx)
+	q, err := db.buildQuery(ctx, db.defaultOrdered(db.scoped(queries)))
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := db.documents(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		item := toJSONValue(doc.Data()).(map[string]interface{})
+		item[db.GetJSONIDKey()] = doc.Ref.ID
+		items = append(items, item)
+	}
+	return json.Marshal(items)
 }
 
 // FindOne retrieves a single document based on queries and stores it in dest (which must be a pointer to a struct).
-func (db *DB) FindOne(ctx context.Context, queries []Query, dest interface{}) error {
+// The document is decoded like the results of FindAll, into a new model replacing the value of dest, so fields
+// absent from the document are left zero and the ID field is set the same way.
+func (db *DB) FindOne(ctx context.Context, queries []Query, dest interface{}) (err error) {
+	defer recoverError("FindOne", &err)
+	ctx, db = db.prepare(ctx)
 	findOne := func(dbInstance *DB) error {
 		if dbInstance.GetModelType() == nil {
 			return fmt.Errorf("no model set, call db.Model(&Model{}) first")
 		}
 
-		colName, err := dbInstance.CollectionName()
-		if err != nil {
-			return err
+		rv := reflect.ValueOf(dest)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("dest must be a pointer to a struct")
 		}
 
-		q := dbInstance.GetConnection().GetClient().Collection(colName).Query
-		q, err = dbInstance.ApplyQueries(ctx, q, queries)
+		queries := dbInstance.defaultOrdered(dbInstance.scoped(queries))
+		q, err := dbInstance.buildQuery(ctx, queries)
 		if err != nil {
 			return err
 		}
@@ -277,11 +1199,9 @@ func (db *DB) FindOne(ctx context.Context, queries []Query, dest interface{}) er
 		// Ensure we only get one document
 		q = q.Limit(1)
 
-		var docs []*firestore.DocumentSnapshot
-		if dbInstance.GetConnection().HasTransaction() {
-			docs, err = dbInstance.GetConnection().GetTransaction().Documents(q).GetAll()
-		} else {
-			docs, err = q.Documents(ctx).GetAll()
+		docs, err := dbInstance.documents(ctx, q)
+		if indexErr, ok := ParseIndexRequired(err, queries); ok {
+			return indexErr
 		}
 		if err != nil {
 			return err
@@ -291,10 +1211,11 @@ func (db *DB) FindOne(ctx context.Context, queries []Query, dest interface{}) er
 			return fmt.Errorf("no document found")
 		}
 
-		if err := docs[0].DataTo(dest); err != nil {
-			return fmt.Errorf("failed to parse document: %v", err)
+		newInstance := reflect.New(rv.Elem().Type())
+		if err := dbInstance.decodeDocument(ctx, docs[0], newInstance.Interface()); err != nil {
+			return err
 		}
-		SetIDField(dest, docs[0].Ref.ID)
+		rv.Elem().Set(newInstance.Elem())
 		return nil
 	}
 	return findOne(db.Model(dest).(*DB))
@@ -303,7 +1224,14 @@ func (db *DB) FindOne(ctx context.Context, queries []Query, dest interface{}) er
 // Save inserts or updates a document.
 // If the model has no ID set and no fieldsToSave are specified, a new document is created.
 // If fieldsToSave are specified but no ID is set, returns an error (can't update without ID).
-func (db *DB) Save(ctx context.Context, model interface{}, fieldsToSave ...string) error {
+// See WithUpdateOnly to keep saves of models with an ID from creating documents.
+func (db *DB) Save(ctx context.Context, model interface{}, fieldsToSave ...string) (err error) {
+	defer recoverError("Save", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return ErrReadOnly
+	}
+	var mutation MutationEvent
 	save := func(dbInstance *DB) error {
 		if dbInstance.GetModelType() == nil {
 			return fmt.Errorf("no model set, call db.Model(&Model{}) first")
@@ -313,17 +1241,28 @@ func (db *DB) Save(ctx context.Context, model interface{}, fieldsToSave ...strin
 		if err != nil {
 			return err
 		}
+		defer dbInstance.invalidateQueryCache(colName)
 
-		id := dbInstance.GetID(model)
+		id, err := dbInstance.resolveID(model)
+		if err != nil {
+			return err
+		}
+		if _, ok := model.(CompositeIDProvider); ok && id != "" {
+			SetIDField(model, id)
+		}
 		docRef := dbInstance.GetConnection().GetClient().Collection(colName).Doc(id)
-		data, err := StructToMap(model)
+		dbInstance.stampTimestamps(model)
+		if applier, ok := model.(DefaultsApplier); ok {
+			applier.ApplyDefaults()
+		}
+		data, err := StructToMapWithOptions(model, dbInstance.GetEncodeOptions())
 		if err != nil {
 			return err
 		}
 
 		// If no ID is specified and no fieldsToSave are provided, create a new document
 		if id == "" && (fieldsToSave == nil || len(fieldsToSave) == 0) {
-			docRef = dbInstance.GetConnection().GetClient().Collection(colName).NewDoc()
+			docRef = dbInstance.newDocRef(dbInstance.GetConnection().GetClient().Collection(colName))
 			SetIDField(model, docRef.ID)
 			id = docRef.ID
 		}
@@ -333,21 +1272,36 @@ func (db *DB) Save(ctx context.Context, model interface{}, fieldsToSave ...strin
 			return fmt.Errorf("cannot update fields on a record with no ID")
 		}
 
+		mutation = MutationEvent{Collection: colName, ID: id, Op: MutationSave, Data: data}
 		if len(fieldsToSave) == 0 {
 			// Set or create the entire document
+			if err := checkDocumentSize(documentPath(docRef), data); err != nil {
+				return err
+			}
+			if dbInstance.options.updateOnly && id != "" {
+				return dbInstance.updateDocument(ctx, docRef, data)
+			}
 			if dbInstance.GetConnection().HasTransaction() {
-				return dbInstance.GetConnection().GetTransaction().Set(docRef, data)
+				return dbInstance.transactionWrite(func(tx *firestore.Transaction) error {
+					return tx.Set(docRef, data)
+				})
 			}
 			_, err = docRef.Set(ctx, data)
 			return err
 		}
 
 		// Update selected fields only
+		if path := dbInstance.updatedAtPath(); path != "" && !slices.Contains(fieldsToSave, path) {
+			fieldsToSave = append(fieldsToSave[:len(fieldsToSave):len(fieldsToSave)], path)
+		}
 		var updates []firestore.Update
+		if keywords, ok := data[KeywordsField]; ok && !slices.Contains(fieldsToSave, KeywordsField) {
+			updates = append(updates, firestore.Update{Path: KeywordsField, Value: keywords})
+		}
 		for _, field := range fieldsToSave {
-			value, ok := data[field]
-			if !ok {
-				return fmt.Errorf("field %s not found in model data", field)
+			value, err := fieldUpdateValue(model, field, dbInstance.GetEncodeOptions())
+			if err != nil {
+				return err
 			}
 			updates = append(updates, firestore.Update{
 				Path:  field,
@@ -355,17 +1309,114 @@ func (db *DB) Save(ctx context.Context, model interface{}, fieldsToSave ...strin
 			})
 		}
 
+		mutation.Data = mutationData(updates)
 		if dbInstance.GetConnection().HasTransaction() {
-			return dbInstance.GetConnection().GetTransaction().Update(docRef, updates)
+			return dbInstance.transactionWrite(func(tx *firestore.Transaction) error {
+				return tx.Update(docRef, updates)
+			})
 		}
 		_, err = docRef.Update(ctx, updates)
 		return err
 	}
-	return save(db.Model(model).(*DB))
+	dbInstance := db.Model(model).(*DB)
+	if err := save(dbInstance); err != nil {
+		return err
+	}
+	return dbInstance.emitMutation(ctx, mutation)
+}
+
+// updateDocument writes every top-level field of data to the existing document, returning ErrNotFound if it
+// does not exist. Inside a transaction, a missing document fails the commit instead.
+func (db *DB) updateDocument(ctx context.Context, docRef *firestore.DocumentRef, data map[string]interface{}) error {
+	updates := make([]firestore.Update, 0, len(data))
+	for key, value := range data {
+		updates = append(updates, firestore.Update{FieldPath: firestore.FieldPath{key}, Value: value})
+	}
+	if db.GetConnection().HasTransaction() {
+		return db.transactionWrite(func(tx *firestore.Transaction) error {
+			return tx.Update(docRef, updates)
+		})
+	}
+	_, err := docRef.Update(ctx, updates)
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SaveIfNewer saves the model only if its compareField value is strictly greater than the stored one.
+// The stored value is read within a transaction, so concurrent writers cannot interleave.
+// compareField may be either the Go field name or its firestore tag and must hold a number or a time.Time.
+// If the stored document is newer or equal, SaveIfNewer is a no-op and returns nil.
+func (db *DB) SaveIfNewer(ctx context.Context, model interface{}, compareField string) (err error) {
+	defer recoverError("SaveIfNewer", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return ErrReadOnly
+	}
+	id, err := db.resolveID(model)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return db.Save(ctx, model)
+	}
+
+	fieldDef, ok := StructFieldByName(reflect.TypeOf(model), compareField)
+	if !ok {
+		return fmt.Errorf("field %s not found in model", compareField)
+	}
+	fieldTag, _ := FirestoreFieldName(fieldDef)
+	if fieldTag == "" || fieldTag == "-" {
+		return fmt.Errorf("field %s is not stored in firestore", compareField)
+	}
+	incoming, _ := FieldByName(reflect.ValueOf(model), fieldDef.Name)
+
+	saveIfNewer := func(ctx context.Context, dbInstance *DB) error {
+		colName, err := dbInstance.Model(model).CollectionName()
+		if err != nil {
+			return err
+		}
+
+		if err := dbInstance.checkTransactionRead(); err != nil {
+			return err
+		}
+		docRef := dbInstance.GetConnection().GetClient().Collection(colName).Doc(id)
+		doc, err := dbInstance.GetConnection().GetTransaction().Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if doc != nil && doc.Exists() {
+			stored, err := doc.DataAt(fieldTag)
+			if err == nil && stored != nil {
+				cmp, err := CompareValues(incoming.Interface(), stored)
+				if err != nil {
+					return fmt.Errorf("failed to compare field %s: %v", compareField, err)
+				}
+				if cmp <= 0 {
+					return nil
+				}
+			}
+		}
+		return dbInstance.Save(ctx, model)
+	}
+
+	if db.GetConnection().HasTransaction() {
+		return saveIfNewer(ctx, db)
+	}
+	return db.GetConnection().GetClient().RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		return saveIfNewer(ctx, db.WithTransaction(tx).(*DB))
+	}, db.transactionOptions()...)
 }
 
 // Update updates the document identified by the model's ID with the provided firestore updates.
-func (db *DB) Update(ctx context.Context, model interface{}, updates []firestore.Update, where ...[]Query) error {
+func (db *DB) Update(ctx context.Context, model interface{}, updates []firestore.Update, where ...[]Query) (err error) {
+	defer recoverError("Update", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return ErrReadOnly
+	}
 	update := func(dbInstance *DB) error {
 		if dbInstance.GetModelType() == nil {
 			return fmt.Errorf("no model set, call db.Model(&Model{}) first")
@@ -375,16 +1426,25 @@ func (db *DB) Update(ctx context.Context, model interface{}, updates []firestore
 		if err != nil {
 			return err
 		}
+		defer dbInstance.invalidateQueryCache(colName)
 
-		id := dbInstance.GetID(model)
+		id, err := dbInstance.resolveID(model)
+		if err != nil {
+			return err
+		}
 		if id != "" {
 			// Direct update by ID
 			docRef := dbInstance.GetConnection().GetClient().Collection(colName).Doc(id)
 			if dbInstance.GetConnection().HasTransaction() {
-				return dbInstance.GetConnection().GetTransaction().Update(docRef, updates)
+				if err := dbInstance.transactionWrite(func(tx *firestore.Transaction) error {
+					return tx.Update(docRef, updates)
+				}); err != nil {
+					return err
+				}
+			} else if _, err = docRef.Update(ctx, updates); err != nil {
+				return err
 			}
-			_, err = docRef.Update(ctx, updates)
-			return err
+			return dbInstance.emitMutation(ctx, updateMutation(colName, id, updates))
 		}
 
 		// Update by query if no ID is provided
@@ -397,17 +1457,54 @@ func (db *DB) Update(ctx context.Context, model interface{}, updates []firestore
 		if err != nil {
 			return err
 		}
+		limit := queryLimit(where[0])
+
+		// Inside a transaction, read the matching documents through it and update each one atomically
+		if dbInstance.GetConnection().HasTransaction() {
+			if err := dbInstance.checkTransactionRead(); err != nil {
+				return err
+			}
+			tx := dbInstance.GetConnection().GetTransaction()
+			readLimit := TransactionWriteLimit + 1
+			if limit > 0 && limit < readLimit {
+				readLimit = limit
+			}
+			docs, err := tx.Documents(q.Limit(readLimit)).GetAll()
+			if err != nil {
+				return fmt.Errorf("failed to retrieve documents: %v", err)
+			}
+			// Only reachable when the caller's limit is unset or above TransactionWriteLimit
+			if len(docs) > TransactionWriteLimit {
+				return fmt.Errorf("transactional update matches more than %d documents", TransactionWriteLimit)
+			}
+			for _, doc := range docs {
+				if err := dbInstance.transactionWrite(func(tx *firestore.Transaction) error {
+					return tx.Update(doc.Ref, updates)
+				}); err != nil {
+					return err
+				}
+				if err := dbInstance.emitMutation(ctx, updateMutation(colName, doc.Ref.ID, updates)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
 
 		var lastDoc *firestore.DocumentSnapshot
+		updated := 0
 
-		for {
+		for limit <= 0 || updated < limit {
 			// Skip StartAfter for the first iteration
 			query := q
 			if lastDoc != nil {
 				query = q.StartAfter(lastDoc)
 			}
 
-			iter := query.Limit(dbInstance.GetUpdateBatchSize()).Documents(ctx)
+			batchSize := dbInstance.GetUpdateBatchSize()
+			if limit > 0 && limit-updated < batchSize {
+				batchSize = limit - updated
+			}
+			iter := query.Limit(batchSize).Documents(ctx)
 			docs, err := iter.GetAll()
 			if err != nil {
 				return fmt.Errorf("failed to retrieve documents: %v", err)
@@ -422,16 +1519,19 @@ func (db *DB) Update(ctx context.Context, model interface{}, updates []firestore
 				batch.Update(doc.Ref, updates)
 			}
 
-			if dbInstance.GetConnection().HasTransaction() {
-				return fmt.Errorf("transactional batch updates are not supported")
-			}
-
 			_, err = batch.Commit(ctx)
 			if err != nil {
 				return fmt.Errorf("batch commit failed: %v", err)
 			}
 
 			lastDoc = docs[len(docs)-1] // Update lastDoc for the next iteration
+			updated += len(docs)
+			dbInstance.reportProgress(updated)
+			for _, doc := range docs {
+				if err := dbInstance.emitMutation(ctx, updateMutation(colName, doc.Ref.ID, updates)); err != nil {
+					return err
+				}
+			}
 		}
 
 		return nil
@@ -440,7 +1540,29 @@ func (db *DB) Update(ctx context.Context, model interface{}, updates []firestore
 }
 
 // Delete removes the document identified by the model's ID from Firestore.
-func (db *DB) Delete(ctx context.Context, model interface{}) error {
+// Deleting a document that does not exist succeeds; use DeleteStrict to detect it.
+func (db *DB) Delete(ctx context.Context, model interface{}) (err error) {
+	defer recoverError("Delete", &err)
+	ctx, db = db.prepare(ctx)
+	return db.deleteDocument(ctx, model, false)
+}
+
+// DeleteStrict removes the document identified by the model's ID like Delete, but returns ErrNotFound
+// without deleting anything if the document does not exist. Outside a transaction, the existence check
+// is a precondition of the delete itself; inside one, the document is read first, which counts as a read
+// of the transaction.
+func (db *DB) DeleteStrict(ctx context.Context, model interface{}) (err error) {
+	defer recoverError("DeleteStrict", &err)
+	ctx, db = db.prepare(ctx)
+	return db.deleteDocument(ctx, model, true)
+}
+
+// deleteDocument deletes the document identified by the model's ID, failing with ErrNotFound
+// if mustExist is set and the document does not exist.
+func (db *DB) deleteDocument(ctx context.Context, model interface{}, mustExist bool) error {
+	if db.options.readOnly {
+		return ErrReadOnly
+	}
 	if db.GetModelType() == nil {
 		return fmt.Errorf("no model set, call db.Model(&Model{}) first")
 	}
@@ -450,54 +1572,584 @@ func (db *DB) Delete(ctx context.Context, model interface{}) error {
 		return err
 	}
 
-	id := db.GetID(model)
+	id, err := db.resolveID(model)
+	if err != nil {
+		return err
+	}
 	if id == "" {
 		return fmt.Errorf("ID cannot be empty for delete")
 	}
 
 	docRef := db.GetConnection().GetClient().Collection(colName).Doc(id)
+	defer db.invalidateQueryCache(colName)
+	if err := db.removeDocument(ctx, docRef, mustExist); err != nil {
+		return err
+	}
+	return db.emitMutation(ctx, MutationEvent{Collection: colName, ID: id, Op: MutationDelete})
+}
+
+// removeDocument deletes or soft-deletes docRef, failing with ErrNotFound if mustExist is set and the document
+// does not exist.
+func (db *DB) removeDocument(ctx context.Context, docRef *firestore.DocumentRef, mustExist bool) error {
+	if path := db.softDeletePath(); path != "" {
+		return db.softDelete(ctx, docRef, path, mustExist)
+	}
+	if db.GetConnection().HasTransaction() {
+		if mustExist {
+			if err := db.checkTransactionRead(); err != nil {
+				return err
+			}
+			if _, err := db.GetConnection().GetTransaction().Get(docRef); err != nil {
+				if status.Code(err) == codes.NotFound {
+					return ErrNotFound
+				}
+				return err
+			}
+		}
+		return db.transactionWrite(func(tx *firestore.Transaction) error {
+			return tx.Delete(docRef)
+		})
+	}
+
+	var preconditions []firestore.Precondition
+	if mustExist {
+		preconditions = append(preconditions, firestore.Exists)
+	}
+	_, err := docRef.Delete(ctx, preconditions...)
+	if mustExist && status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// softDelete stores the deletion time in the soft-delete field path of the document instead of deleting it.
+// Update fails on missing documents, which is only reported if mustExist is set.
+func (db *DB) softDelete(ctx context.Context, docRef *firestore.DocumentRef, path string, mustExist bool) error {
+	updates := []firestore.Update{{FieldPath: firestore.FieldPath{path}, Value: firestore.ServerTimestamp}}
 	if db.GetConnection().HasTransaction() {
-		return db.GetConnection().GetTransaction().Delete(docRef)
+		if mustExist {
+			if err := db.checkTransactionRead(); err != nil {
+				return err
+			}
+			if _, err := db.GetConnection().GetTransaction().Get(docRef); err != nil {
+				if status.Code(err) == codes.NotFound {
+					return ErrNotFound
+				}
+				return err
+			}
+		}
+		return db.transactionWrite(func(tx *firestore.Transaction) error {
+			return tx.Update(docRef, updates)
+		})
+	}
+
+	_, err := docRef.Update(ctx, updates)
+	if status.Code(err) == codes.NotFound {
+		if mustExist {
+			return ErrNotFound
+		}
+		return nil
 	}
-	_, err = docRef.Delete(ctx)
 	return err
 }
 
+// Move atomically moves the document identified by the model's ID to targetCollection and returns its ID there,
+// which is the same as the source ID. The source is read, written to the target and deleted in one transaction
+// (the connection's transaction if there is one), so the document is never in both collections or in neither.
+// Move fails, leaving the source in place, if a document with the same ID already exists in targetCollection.
+func (db *DB) Move(ctx context.Context, model interface{}, targetCollection string) (newID string, err error) {
+	defer recoverError("Move", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return "", ErrReadOnly
+	}
+	if targetCollection == "" {
+		return "", fmt.Errorf("target collection cannot be empty")
+	}
+
+	source, err := db.DocRef(model)
+	if err != nil {
+		return "", err
+	}
+	target := db.GetConnection().GetClient().Collection(targetCollection).Doc(source.ID)
+	if target.Path == source.Path {
+		return "", fmt.Errorf("document is already in collection %s", targetCollection)
+	}
+	defer db.invalidateQueryCache(collectionPath(source.Parent))
+	defer db.invalidateQueryCache(targetCollection)
+
+	move := func(tx *firestore.Transaction) error {
+		doc, err := tx.Get(source)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(target, doc.Data()); err != nil {
+			return err
+		}
+		return tx.Delete(source)
+	}
+	if db.GetConnection().HasTransaction() {
+		if err := db.checkTransactionRead(); err != nil {
+			return "", err
+		}
+		err = db.transactionWrite(move)
+	} else {
+		err = db.GetConnection().GetClient().RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			return move(tx)
+		}, db.transactionOptions()...)
+	}
+	if err != nil {
+		return "", err
+	}
+	return target.ID, nil
+}
+
+// ArrayAppend atomically adds elems to the array field of the document identified by the model's ID.
+// Elements already present in the array are not added again.
+func (db *DB) ArrayAppend(ctx context.Context, model interface{}, field string, elems ...interface{}) (err error) {
+	defer recoverError("ArrayAppend", &err)
+	ctx, db = db.prepare(ctx)
+	id, err := db.resolveID(model)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return fmt.Errorf("ID cannot be empty for array append")
+	}
+	return db.Update(ctx, model, []firestore.Update{
+		{Path: field, Value: firestore.ArrayUnion(elems...)},
+	})
+}
+
+// ArrayRemove atomically removes all instances of elems from the array field of the document identified by the model's ID.
+func (db *DB) ArrayRemove(ctx context.Context, model interface{}, field string, elems ...interface{}) (err error) {
+	defer recoverError("ArrayRemove", &err)
+	ctx, db = db.prepare(ctx)
+	id, err := db.resolveID(model)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return fmt.Errorf("ID cannot be empty for array remove")
+	}
+	return db.Update(ctx, model, []firestore.Update{
+		{Path: field, Value: firestore.ArrayRemove(elems...)},
+	})
+}
+
+// UpdateMax atomically sets the numeric field of the document identified by the model's ID
+// to the maximum of its stored value and value, using Firestore's maximum field transform.
+func (db *DB) UpdateMax(ctx context.Context, model interface{}, field string, value interface{}) (err error) {
+	defer recoverError("UpdateMax", &err)
+	ctx, db = db.prepare(ctx)
+	id, err := db.resolveID(model)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return fmt.Errorf("ID cannot be empty for update max")
+	}
+	return db.Update(ctx, model, []firestore.Update{
+		{Path: field, Value: firestore.FieldTransformMaximum(value)},
+	})
+}
+
+// UpdateMin atomically sets the numeric field of the document identified by the model's ID
+// to the minimum of its stored value and value, using Firestore's minimum field transform.
+func (db *DB) UpdateMin(ctx context.Context, model interface{}, field string, value interface{}) (err error) {
+	defer recoverError("UpdateMin", &err)
+	ctx, db = db.prepare(ctx)
+	id, err := db.resolveID(model)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return fmt.Errorf("ID cannot be empty for update min")
+	}
+	return db.Update(ctx, model, []firestore.Update{
+		{Path: field, Value: firestore.FieldTransformMinimum(value)},
+	})
+}
+
+// RawQuery returns the base Firestore query for the current model's collection.
+// It can be combined with ApplyQueries and native Firestore query options not wrapped by the DB.
+func (db *DB) RawQuery(ctx context.Context) (q firestore.Query, err error) {
+	defer recoverError("RawQuery", &err)
+	if db.GetModelType() == nil {
+		return firestore.Query{}, fmt.Errorf("no model set, call db.Model(&Model{}) first")
+	}
+
+	colName, err := db.CollectionName()
+	if err != nil {
+		return firestore.Query{}, err
+	}
+	return db.GetConnection().GetClient().Collection(colName).Query, nil
+}
+
 // ApplyQueries applies the given queries (where, orderBy, limit) to the given Firestore query.
-func (db *DB) ApplyQueries(ctx context.Context, q firestore.Query, queries []Query) (firestore.Query, error) {
+// Queries are applied in order and combine with AND semantics: every where clause of every Query entry
+// must match, so passing two entries with one clause each is the same as one entry with both clauses.
+// Order clauses accumulate in the same order, and a later limit or cursor replaces an earlier one.
+// When cursors are used, an explicit "__name__" ordering is appended unless already present, matching
+// Firestore's implicit tiebreaker so that cursor values line up with the ordering across pages.
+func (db *DB) ApplyQueries(ctx context.Context, q firestore.Query, queries []Query) (result firestore.Query, err error) {
+	defer recoverError("ApplyQueries", &err)
+	var orderBy []OrderClause
+	var startAt, startAfter, endAt, endBefore []interface{}
+	var disjunction *WhereClause
 	for _, qry := range queries {
 		for _, w := range qry.Where {
+			if w.Operator == "in" || w.Operator == "array-contains-any" {
+				// Firestore allows a single disjunctive clause per query and rejects others with an opaque error
+				if disjunction != nil {
+					return q, fmt.Errorf("a query can contain at most one 'in' or 'array-contains-any' clause, found %q on %s and %q on %s",
+						disjunction.Operator, disjunction.fieldName(), w.Operator, w.fieldName())
+				}
+				disjunction = &w
+			}
 			value := w.Value
 			if w.ValueProvider != nil {
 				v, err := w.ValueProvider.GetValue(ctx)
 				if err != nil {
-					return q, fmt.Errorf("failed to get value for field %s: %v", w.Field, err)
+					return q, fmt.Errorf("failed to get value for field %s: %v", w.fieldName(), err)
 				}
 				value = v
 			}
-			q = q.Where(w.Field, w.Operator, value)
+			if db.GetModelType() != nil && isTimeField(db.GetModelType(), w.path()) {
+				converted, err := toTimeValue(value)
+				if err != nil {
+					return q, fmt.Errorf("invalid value for time field %s: %v", w.fieldName(), err)
+				}
+				value = converted
+			}
+			if db.GetModelType() != nil && isLowercaseField(db.GetModelType(), w.path()) {
+				value = lowercaseValue(value)
+			}
+			value, err := toQueryValue(value, db.GetEncodeOptions())
+			if err != nil {
+				return q, fmt.Errorf("failed to convert value for field %s: %v", w.fieldName(), err)
+			}
+			if len(w.FieldPath) > 0 {
+				q = q.WherePath(w.FieldPath, w.Operator, value)
+			} else {
+				q = q.Where(w.Field, w.Operator, value)
+			}
 		}
 
 		for _, o := range qry.OrderBy {
 			q = q.OrderBy(o.Field, o.Direction)
+			orderBy = append(orderBy, o)
 		}
 
-		if qry.Limit > 0 && qry.Limit != QueryLimitUnlimited {
-			q = q.Limit(qry.Limit)
+		var err error
+		q, err = applyLimit(q, qry.Limit)
+		if err != nil {
+			return q, err
+		}
+
+		if qry.StartAt != nil {
+			startAt = qry.StartAt
+		}
+		if qry.StartAfter != nil {
+			startAfter = qry.StartAfter
 		}
+		if qry.EndAt != nil {
+			endAt = qry.EndAt
+		}
+		if qry.EndBefore != nil {
+			endBefore = qry.EndBefore
+		}
+	}
+
+	if startAt == nil && startAfter == nil && endAt == nil && endBefore == nil {
+		return q, nil
+	}
+
+	q = applyNameTiebreaker(q, orderBy)
+	if startAt != nil {
+		q = q.StartAt(startAt...)
+	}
+	if startAfter != nil {
+		q = q.StartAfter(startAfter...)
+	}
+	if endAt != nil {
+		q = q.EndAt(endAt...)
+	}
+	if endBefore != nil {
+		q = q.EndBefore(endBefore...)
 	}
 	return q, nil
 }
 
-// GetID retrieves the "ID" field value if it exists and is a string.
+// applyNameTiebreaker appends an explicit "__name__" ordering unless orderBy already has one.
+// Like Firestore's implicit ordering, it uses the direction of the last explicit ordering.
+func applyNameTiebreaker(q firestore.Query, orderBy []OrderClause) firestore.Query {
+	direction := firestore.Asc
+	for _, o := range orderBy {
+		if o.Field == firestore.DocumentID {
+			return q
+		}
+		direction = o.Direction
+	}
+	return q.OrderBy(firestore.DocumentID, direction)
+}
+
+// queryLimit returns the limit the queries apply, the last positive Limit, or 0 if none is set.
+func queryLimit(queries []Query) int {
+	limit := 0
+	for _, qry := range queries {
+		if qry.Limit > 0 {
+			limit = qry.Limit
+		}
+	}
+	return limit
+}
+
+// applyLimit applies a Query limit: 0 means no limit was specified, QueryLimitUnlimited explicitly
+// requests no limit, and a positive value limits the number of results. Other negative values are invalid.
+func applyLimit(q firestore.Query, limit int) (firestore.Query, error) {
+	switch {
+	case limit == 0, limit == QueryLimitUnlimited:
+		return q, nil
+	case limit < 0:
+		return q, fmt.Errorf("invalid query limit %d", limit)
+	}
+	return q.Limit(limit), nil
+}
+
+// DocRef returns the Firestore document reference for the model, based on its collection and ID.
+func (db *DB) DocRef(model interface{}) (ref *firestore.DocumentRef, err error) {
+	defer recoverError("DocRef", &err)
+	dbInstance := db.Model(model)
+	colName, err := dbInstance.CollectionName()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := db.resolveID(model)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("ID cannot be empty")
+	}
+	return dbInstance.GetConnection().GetClient().Collection(colName).Doc(id), nil
+}
+
+// ListSubcollections returns the IDs of all subcollections under the model's document.
+func (db *DB) ListSubcollections(ctx context.Context, model interface{}) (names []string, err error) {
+	defer recoverError("ListSubcollections", &err)
+	docRef, err := db.DocRef(model)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := docRef.Collections(ctx)
+	for {
+		colRef, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list subcollections: %v", err)
+		}
+		names = append(names, colRef.ID)
+	}
+	return names, nil
+}
+
+// decodeDocument decodes the document into dest, sets its ID and runs the AfterLoad hook if dest implements it.
+func (db *DB) decodeDocument(ctx context.Context, doc *firestore.DocumentSnapshot, dest interface{}) error {
+	data, upgraded, err := upgradeData(dest, doc.Data())
+	if err != nil {
+		return err
+	}
+	data, decompressed, err := gunzipFields(reflect.TypeOf(dest), data)
+	if err != nil {
+		return err
+	}
+	_, setter := dest.(FieldSetter)
+	if db.options.strictDecoding && !setter {
+		if unknown := unknownFields(reflect.TypeOf(dest), data); len(unknown) > 0 {
+			return fmt.Errorf("document %s has fields not declared by the model: %s", doc.Ref.ID, strings.Join(unknown, ", "))
+		}
+	}
+	_, restricted := db.allowedFields(reflect.TypeOf(dest))
+	if restricted {
+		data = db.restrictData(data, reflect.TypeOf(dest))
+		db.zeroDisallowedFields(dest)
+	}
+	if decoder, ok := dest.(FirestoreDecoder); ok {
+		err = decoder.DecodeFirestore(data)
+	} else if upgraded || restricted || decompressed || hasNonStringMapKeys(reflect.TypeOf(dest)) {
+		// The Firestore SDK only decodes maps into string-keyed maps
+		err = DecodeMap(data, dest)
+	} else {
+		err = doc.DataTo(dest)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse document: %v", err)
+	}
+	if err := decodeFields(dest, data, db.options.encode.FieldCodec); err != nil {
+		return err
+	}
+	if db.options.normalizeNumbers {
+		normalizeNumbers(reflect.ValueOf(dest))
+	}
+	if err := setFields(dest, data); err != nil {
+		return err
+	}
+	SetIDField(dest, doc.Ref.ID)
+	SetPathFields(dest, documentPath(doc.Ref))
+
+	if loader, ok := dest.(AfterLoader); ok {
+		if err := loader.AfterLoad(ctx); err != nil {
+			return fmt.Errorf("after load hook failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// buildQuery returns the model's collection query with the given queries applied.
+func (db *DB) buildQuery(ctx context.Context, queries []Query) (firestore.Query, error) {
+	q, err := db.RawQuery(ctx)
+	if err != nil {
+		return q, err
+	}
+	return db.ApplyQueries(ctx, q, queries)
+}
+
+// defaultOrdered returns queries with the DefaultOrderBy of models implementing DefaultOrderer appended,
+// unless one of the queries already has an OrderBy clause.
+func (db *DB) defaultOrdered(queries []Query) []Query {
+	if !db.GetModelValue().IsValid() {
+		return queries
+	}
+	orderer, ok := db.GetModelValue().Interface().(DefaultOrderer)
+	if !ok {
+		return queries
+	}
+	for _, query := range queries {
+		if len(query.OrderBy) > 0 {
+			return queries
+		}
+	}
+	return append(queries[:len(queries):len(queries)], Query{OrderBy: orderer.DefaultOrderBy()})
+}
+
+// sliceModel validates that dest is a pointer to a slice of structs and returns a DB instance for its element type.
+func (db *DB) sliceModel(dest interface{}) (*DB, error) {
+	destType := reflect.TypeOf(dest)
+	if destType == nil || destType.Kind() != reflect.Ptr || destType.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("dest must be a pointer to a slice")
+	}
+	// Check what is the type of one slice element
+	elemType := destType.Elem().Elem()
+	if elemType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dest slice element must be a struct")
+	}
+	return db.Model(reflect.New(elemType).Interface()).(*DB), nil
+}
+
+// appendDocuments decodes each document into a new model instance and appends it to the slice dest points to.
+func (db *DB) appendDocuments(ctx context.Context, docs []*firestore.DocumentSnapshot, dest interface{}) error {
+	return db.appendDocumentsWithPolicy(ctx, docs, dest, DecodeErrorFail)
+}
+
+// appendDocumentsWithPolicy is appendDocuments handling the documents that cannot be decoded according to policy.
+func (db *DB) appendDocumentsWithPolicy(ctx context.Context, docs []*firestore.DocumentSnapshot, dest interface{}, policy DecodeErrorPolicy) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest must be a pointer to a slice")
+	}
+
+	sliceVal := rv.Elem()
+	decodeErrors := make(map[string]error)
+	for _, doc := range docs {
+		newInstance := reflect.New(db.GetModelType()).Interface()
+		if err := db.decodeDocument(ctx, doc, newInstance); err != nil {
+			if policy == DecodeErrorFail {
+				return err
+			}
+			decodeErrors[doc.Ref.ID] = err
+			continue
+		}
+		sliceVal = reflect.Append(sliceVal, reflect.ValueOf(newInstance).Elem())
+	}
+	rv.Elem().Set(sliceVal)
+	if policy == DecodeErrorCollect && len(decodeErrors) > 0 {
+		return &ErrPartialDecode{Errors: decodeErrors}
+	}
+	return nil
+}
+
+// documentIterator runs the query, within the connection's transaction if there is one.
+func (db *DB) documentIterator(ctx context.Context, q firestore.Query) (*firestore.DocumentIterator, error) {
+	q = db.restrictQuery(q)
+	if db.GetConnection().HasTransaction() {
+		if err := db.checkTransactionRead(); err != nil {
+			return nil, err
+		}
+		return db.GetConnection().GetTransaction().Documents(q), nil
+	}
+	if !db.options.readTime.IsZero() {
+		return nil, ErrReadTimeQuery
+	}
+	return q.Documents(ctx), nil
+}
+
+// documents runs the query and returns all resulting documents.
+func (db *DB) documents(ctx context.Context, q firestore.Query) ([]*firestore.DocumentSnapshot, error) {
+	iter, err := db.documentIterator(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return iter.GetAll()
+}
+
+// getAll fetches the documents referenced by refs, in order, within the connection's transaction if there is one.
+// With a read time, each document is fetched on its own, as the SDK only applies read times to single-document reads.
+func (db *DB) getAll(ctx context.Context, refs []*firestore.DocumentRef) ([]*firestore.DocumentSnapshot, error) {
+	if db.GetConnection().HasTransaction() {
+		return db.GetConnection().GetTransaction().GetAll(refs)
+	}
+	if db.options.readTime.IsZero() {
+		return db.GetConnection().GetClient().GetAll(ctx, refs)
+	}
+	docs := make([]*firestore.DocumentSnapshot, len(refs))
+	for i, ref := range refs {
+		// Read options are set on a copy of the reference, not on the caller's
+		doc, err := ref.Parent.Doc(ref.ID).WithReadOptions(firestore.ReadTime(db.options.readTime)).Get(ctx)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return nil, err
+		}
+		docs[i] = doc
+	}
+	return docs, nil
+}
+
+// GetID retrieves the model's document ID: the CompositeID if the model implements CompositeIDProvider,
+// otherwise the value of the ID field (see IDField) if it exists and is a string.
 func (db *DB) GetID(model interface{}) string {
-	v := reflect.ValueOf(model)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+	id, _ := db.resolveID(model)
+	return id
+}
+
+// resolveID works like GetID but reports errors from building a composite ID.
+func (db *DB) resolveID(model interface{}) (string, error) {
+	if provider, ok := model.(CompositeIDProvider); ok {
+		id, err := provider.CompositeID()
+		if err != nil {
+			return "", fmt.Errorf("failed to build composite ID: %v", err)
+		}
+		if strings.Contains(id, "/") {
+			return "", fmt.Errorf("composite ID %q must not contain '/'", id)
+		}
+		return id, nil
 	}
-	field := v.FieldByName("ID")
-	if field.IsValid() && field.Kind() == reflect.String {
-		return field.String()
+
+	if field, ok := IDField(reflect.ValueOf(model)); ok {
+		return field.String(), nil
 	}
-	return ""
+	return "", nil
 }
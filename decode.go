@@ -0,0 +1,430 @@
+package fireorm
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecodeMap decodes Firestore document data, as returned by DocumentSnapshot.Data, into dest,
+// a pointer to a struct. Fields are matched like DocumentSnapshot.DataTo does: by "firestore" tag name,
+// or by Go name for untagged fields, exactly first and then case-insensitively, with the fields of untagged
+// embedded structs matched as fields of dest. Data keys without
+// a matching field are ignored, and null values leave non-nullable fields unchanged. Time fields also accept
+// RFC 3339 strings, as found in data read back from JSON.
+func DecodeMap(data map[string]interface{}, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("dest must be a non-nil pointer to a struct, got %T", dest)
+	}
+	return decodeStruct(v.Elem(), data)
+}
+
+// decodeStruct sets the fields of the struct v from data.
+func decodeStruct(v reflect.Value, data map[string]interface{}) error {
+	for key, value := range data {
+		field, ok := matchField(v.Type(), key)
+		if !ok {
+			continue
+		}
+		if err := decodeValue(fieldByIndex(v, field.Index), value); err != nil {
+			return fmt.Errorf("field %s: %v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// matchField returns the exported struct field stored under key, with its index from t. Like DataTo, the fields
+// of untagged embedded structs are matched as if they were fields of t, shallower fields taking precedence.
+func matchField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+	visited := map[reflect.Type]bool{}
+	level := []reflect.StructField{{Type: t}}
+	for len(level) > 0 {
+		var next []reflect.StructField
+		for _, parent := range level {
+			parentType := indirectType(parent.Type)
+			if visited[parentType] {
+				continue
+			}
+			visited[parentType] = true
+			for i := 0; i < parentType.NumField(); i++ {
+				fieldDef := parentType.Field(i)
+				fieldDef.Index = append(slices.Clone(parent.Index), i)
+				name, _ := FirestoreFieldName(fieldDef)
+				if name == "-" {
+					continue
+				}
+				if fieldDef.Anonymous && name == "" && embeddedStruct(fieldDef) {
+					next = append(next, fieldDef)
+					continue
+				}
+				if !fieldDef.IsExported() {
+					continue
+				}
+				if name == "" {
+					name = fieldDef.Name
+				}
+				if name == key {
+					return fieldDef, true
+				}
+				if folded == nil && strings.EqualFold(name, key) {
+					folded = &fieldDef
+				}
+			}
+		}
+		level = next
+	}
+	if folded != nil {
+		return *folded, true
+	}
+	return reflect.StructField{}, false
+}
+
+// embeddedStruct reports whether the embedded field fieldDef holds a struct whose fields can be decoded: a struct,
+// or a pointer to one that can be allocated because its type is exported.
+func embeddedStruct(fieldDef reflect.StructField) bool {
+	if fieldDef.Type.Kind() == reflect.Ptr {
+		return fieldDef.IsExported() && fieldDef.Type.Elem().Kind() == reflect.Struct
+	}
+	return fieldDef.Type.Kind() == reflect.Struct
+}
+
+// fieldByIndex returns the nested field of the struct v at index, allocating the nil embedded struct pointers
+// on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// setFields passes the fields of data that dest does not declare to its SetField method, if dest is a FieldSetter
+// decoded by reflection.
+func setFields(dest interface{}, data map[string]interface{}) error {
+	setter, ok := dest.(FieldSetter)
+	if !ok {
+		return nil
+	}
+	if _, ok := dest.(FirestoreDecoder); ok {
+		return nil
+	}
+	for _, name := range unknownFields(reflect.TypeOf(dest), data) {
+		if err := setter.SetField(name, data[name]); err != nil {
+			return fmt.Errorf("failed to set field %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// unknownFields returns the sorted keys of data not stored by any field of the model type t, including the
+// fields of embedded structs. The SchemaVersionField of models implementing SchemaUpgrader and the KeywordsField
+// of models implementing KeywordProvider are known.
+func unknownFields(t reflect.Type, data map[string]interface{}) []string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	known := map[string]bool{}
+	if _, ok := reflect.New(t).Interface().(SchemaUpgrader); ok {
+		known[SchemaVersionField] = true
+	}
+	if _, ok := reflect.New(t).Interface().(KeywordProvider); ok {
+		known[KeywordsField] = true
+	}
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			fieldDef := t.Field(i)
+			name, _ := FirestoreFieldName(fieldDef)
+			if name == "-" {
+				continue
+			}
+			if fieldDef.Anonymous && name == "" && indirectType(fieldDef.Type).Kind() == reflect.Struct {
+				collect(indirectType(fieldDef.Type))
+				continue
+			}
+			if !fieldDef.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = fieldDef.Name
+			}
+			known[name] = true
+		}
+	}
+	collect(t)
+
+	var unknown []string
+	for key := range data {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// parseMapKey converts a stored map key to the key type t, reversing the formatting of EncodeOptions.ConvertMapKeys.
+func parseMapKey(key string, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(key).Convert(t), nil
+	}
+	keyValue := reflect.New(t)
+	if unmarshaler, ok := keyValue.Interface().(encoding.TextUnmarshaler); ok {
+		if err := unmarshaler.UnmarshalText([]byte(key)); err != nil {
+			return keyValue, fmt.Errorf("cannot parse map key %q as %s: %v", key, t, err)
+		}
+		return keyValue.Elem(), nil
+	}
+	keyValue = keyValue.Elem()
+	var err error
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(key, 10, t.Bits()); err == nil {
+			keyValue.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(key, 10, t.Bits()); err == nil {
+			keyValue.SetUint(n)
+		}
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(key); err == nil {
+			keyValue.SetBool(b)
+		}
+	default:
+		return keyValue, fmt.Errorf("cannot decode map keys into type %s", t)
+	}
+	if err != nil {
+		return keyValue, fmt.Errorf("cannot parse map key %q as %s", key, t)
+	}
+	return keyValue, nil
+}
+
+// hasNonStringMapKeys reports whether a field of the struct type t (or pointer to it) holds maps with
+// non-string keys.
+func hasNonStringMapKeys(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() && nonStringMapKey(t.Field(i).Type) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeValue sets dest to the Firestore value, converting between the types Firestore returns
+// (int64, float64, string, bool, time.Time, []byte, []interface{}, map[string]interface{} and others)
+// and the destination type.
+func decodeValue(dest reflect.Value, value interface{}) error {
+	if value == nil {
+		switch dest.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			dest.Set(reflect.Zero(dest.Type()))
+		}
+		return nil
+	}
+
+	src := reflect.ValueOf(value)
+	if src.Type().AssignableTo(dest.Type()) {
+		dest.Set(src)
+		return nil
+	}
+
+	typeErr := fmt.Errorf("cannot set type %s to %T", dest.Type(), value)
+	switch dest.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(dest.Type().Elem())
+		if err := decodeValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		dest.Set(elem)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := value.(int64)
+		if !ok {
+			return typeErr
+		}
+		if dest.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows type %s", n, dest.Type())
+		}
+		dest.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := value.(int64)
+		if !ok {
+			return typeErr
+		}
+		if n < 0 || dest.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %d overflows type %s", n, dest.Type())
+		}
+		dest.SetUint(uint64(n))
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch x := value.(type) {
+		case float64:
+			f = x
+		case int64:
+			f = float64(x)
+		default:
+			return typeErr
+		}
+		if dest.Kind() == reflect.Float32 && !math.IsInf(f, 0) && dest.OverflowFloat(f) {
+			return fmt.Errorf("value %g overflows type %s", f, dest.Type())
+		}
+		dest.SetFloat(f)
+		return nil
+
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return typeErr
+		}
+		dest.SetString(s)
+		return nil
+
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return typeErr
+		}
+		dest.SetBool(b)
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return typeErr
+		}
+		if dest.Kind() == reflect.Array {
+			if len(items) > dest.Len() {
+				return fmt.Errorf("%d values do not fit in type %s", len(items), dest.Type())
+			}
+			dest.Set(reflect.Zero(dest.Type()))
+		} else {
+			dest.Set(reflect.MakeSlice(dest.Type(), len(items), len(items)))
+		}
+		for i, item := range items {
+			if err := decodeValue(dest.Index(i), item); err != nil {
+				return fmt.Errorf("index %d: %v", i, err)
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return typeErr
+		}
+		m := reflect.MakeMapWithSize(dest.Type(), len(entries))
+		for key, entry := range entries {
+			keyValue, err := parseMapKey(key, dest.Type().Key())
+			if err != nil {
+				return err
+			}
+			elem := reflect.New(dest.Type().Elem()).Elem()
+			if err := decodeValue(elem, entry); err != nil {
+				return fmt.Errorf("key %s: %v", key, err)
+			}
+			m.SetMapIndex(keyValue, elem)
+		}
+		dest.Set(m)
+		return nil
+
+	case reflect.Struct:
+		if dest.Type() == reflect.TypeOf(time.Time{}) {
+			s, ok := value.(string)
+			if !ok {
+				return typeErr
+			}
+			parsed, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return fmt.Errorf("cannot parse %q as an RFC 3339 time", s)
+			}
+			dest.Set(reflect.ValueOf(parsed))
+			return nil
+		}
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return typeErr
+		}
+		return decodeStruct(dest, entries)
+	}
+	return typeErr
+}
+
+// normalizeNumbers converts the int64 values held in the untyped (interface{}) parts of v to int, where they fit.
+func normalizeNumbers(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			normalizeNumbers(v.Elem())
+		}
+	case reflect.Interface:
+		if !v.IsNil() && v.CanSet() {
+			v.Set(reflect.ValueOf(normalizedNumber(v.Elem().Interface())))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				normalizeNumbers(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			normalizeNumbers(v.Index(i))
+		}
+	case reflect.Map:
+		// Map values are not addressable, so only untyped values are replaced in place
+		iter := v.MapRange()
+		for iter.Next() {
+			if v.Type().Elem().Kind() == reflect.Interface && !iter.Value().IsNil() {
+				v.SetMapIndex(iter.Key(), reflect.ValueOf(normalizedNumber(iter.Value().Elem().Interface())))
+			} else {
+				normalizeNumbers(iter.Value())
+			}
+		}
+	}
+}
+
+// normalizedNumber returns value with int64 values converted to int, recursing into maps and arrays.
+func normalizedNumber(value interface{}) interface{} {
+	switch x := value.(type) {
+	case int64:
+		if int64(int(x)) == x {
+			return int(x)
+		}
+	case map[string]interface{}:
+		for key, entry := range x {
+			x[key] = normalizedNumber(entry)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = normalizedNumber(item)
+		}
+	}
+	return value
+}
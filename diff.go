@@ -0,0 +1,71 @@
+package fireorm
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// FieldChange is the change of a single field reported by Diff.
+// Old is nil when the field is not stored (the document or the field does not exist yet).
+type FieldChange struct {
+	Old interface{}
+	New interface{}
+}
+
+// Diff compares the model to its stored document and returns the changed fields keyed by their
+// Firestore name. Each field is compared after decoding the stored document into the model type,
+// so Old and New hold values of the field's Go type. If the document does not exist, every field
+// is reported as added. Unchanged fields are left out.
+func (db *DB) Diff(ctx context.Context, model interface{}) (changes map[string]FieldChange, err error) {
+	defer recoverError("Diff", &err)
+	ctx, db = db.prepare(ctx)
+	dbInstance := db.Model(model).(*DB)
+
+	var stored map[string]interface{}
+	storedModel := reflect.New(dbInstance.GetModelType())
+	doc, err := dbInstance.getDocument(ctx, model)
+	switch {
+	case IsNotFoundError(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := dbInstance.decodeDocument(ctx, doc, storedModel.Interface()); err != nil {
+			return nil, err
+		}
+		stored = doc.Data()
+	}
+
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	changes = make(map[string]FieldChange)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := FirestoreFieldName(t.Field(i))
+		if name == "" || name == "-" {
+			continue
+		}
+		newValue := v.Field(i).Interface()
+		if _, ok := stored[name]; !ok {
+			changes[name] = FieldChange{New: newValue}
+			continue
+		}
+		oldValue := storedModel.Elem().Field(i).Interface()
+		if !equalValues(oldValue, newValue) {
+			changes[name] = FieldChange{Old: oldValue, New: newValue}
+		}
+	}
+	return changes, nil
+}
+
+// equalValues reports whether two field values are equal, comparing times by instant.
+func equalValues(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		if bt, ok := b.(time.Time); ok {
+			return at.Equal(bt)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
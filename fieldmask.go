@@ -0,0 +1,74 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// WithStrictFieldMask returns a new DB instance on which UpdateAllowed fails, without writing anything, when
+// some updates are not allowed, instead of dropping them.
+func (db *DB) WithStrictFieldMask() IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.strictFieldMask = true
+	return newInstance
+}
+
+// UpdateAllowed updates the document identified by the model's ID like Update, but only with the updates whose
+// field path is allowed, so that writes stay within the fields security rules let the caller change. allowed
+// lists stored field paths, dot-separated for nested fields, and allowing a field allows the fields nested in
+// it. Updates of other paths are dropped, or fail the whole call on an instance set up with
+// WithStrictFieldMask. When every update is dropped, nothing is written.
+func (db *DB) UpdateAllowed(ctx context.Context, model interface{}, updates []firestore.Update, allowed []string) (err error) {
+	defer recoverError("UpdateAllowed", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return ErrReadOnly
+	}
+	var permitted []firestore.Update
+	var disallowed []string
+	for _, update := range updates {
+		path := updatePath(update)
+		if len(path) == 0 {
+			return fmt.Errorf("update has no field path")
+		}
+		if pathAllowed(path, allowed) {
+			permitted = append(permitted, update)
+		} else {
+			disallowed = append(disallowed, strings.Join(path, "."))
+		}
+	}
+	if len(disallowed) > 0 && db.options.strictFieldMask {
+		return fmt.Errorf("updates of fields not allowed: %s", strings.Join(disallowed, ", "))
+	}
+	if len(permitted) == 0 {
+		return nil
+	}
+	return db.Update(ctx, model, permitted)
+}
+
+// updatePath returns the segments of the field path of update.
+func updatePath(update firestore.Update) []string {
+	if len(update.FieldPath) > 0 {
+		return update.FieldPath
+	}
+	if update.Path == "" {
+		return nil
+	}
+	return strings.Split(update.Path, ".")
+}
+
+// pathAllowed reports whether path is one of the allowed dot-separated paths or nested in one of them.
+func pathAllowed(path []string, allowed []string) bool {
+	for _, entry := range allowed {
+		segments := strings.Split(entry, ".")
+		if len(segments) <= len(path) && slices.Equal(segments, path[:len(segments)]) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,25 +1,373 @@
 package fireorm
 
 import (
+	"cloud.google.com/go/firestore"
+	"cmp"
+	"encoding"
+	"errors"
+	"fmt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// SetIDField tries to set the "ID" field if it exists and is of type string.
+// IDTagOption is the "fireorm" tag option marking the string field holding the document ID,
+// e.g. `fireorm:"id"`. Models without such a field use their "ID" field.
+const IDTagOption = "id"
+
+// SetIDField tries to set the document ID field (see IDField) if it exists and is of type string.
 func SetIDField(model interface{}, id string) {
-	v := reflect.ValueOf(model)
+	field, ok := IDField(reflect.ValueOf(model))
+	if ok && field.CanSet() {
+		field.SetString(id)
+	}
+}
+
+// IDField returns the string field holding the document ID: the IDField registered with RegisterModel,
+// else the field tagged with the IDTagOption "fireorm" option, or else the field named "ID".
+func IDField(v reflect.Value) (reflect.Value, bool) {
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	t := v.Type()
+	if registration := registeredModel(t); registration != nil && registration.config.IDField != "" {
+		return v.FieldByName(registration.config.IDField), true
+	}
 	field := v.FieldByName("ID")
-	if field.IsValid() && field.CanSet() && field.Kind() == reflect.String {
-		field.SetString(id)
+	for i := 0; i < t.NumField(); i++ {
+		if HasFireormOption(t.Field(i), IDTagOption) {
+			field = v.Field(i)
+			break
+		}
 	}
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return reflect.Value{}, false
+	}
+	return field, true
+}
+
+// idFieldIndex returns the index of the top-level struct field holding the document ID (see IDField), or -1.
+func idFieldIndex(t reflect.Type) int {
+	if registration := registeredModel(t); registration != nil && registration.config.IDField != "" {
+		fieldDef, _ := t.FieldByName(registration.config.IDField)
+		return fieldDef.Index[0]
+	}
+	index := -1
+	if fieldDef, ok := t.FieldByName("ID"); ok && len(fieldDef.Index) == 1 {
+		index = fieldDef.Index[0]
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if HasFireormOption(t.Field(i), IDTagOption) {
+			index = i
+			break
+		}
+	}
+	if index >= 0 && t.Field(index).Type.Kind() != reflect.String {
+		return -1
+	}
+	return index
+}
+
+// PathTagOption is the "fireorm" tag option marking a string field populated on read with the document path
+// relative to the database root, e.g. "users/alice" or "posts/p1/comments/c1". Such fields are usually also
+// tagged `firestore:"-"` so the path is not stored.
+const PathTagOption = "path"
+
+// SetPathFields sets the string fields tagged with the PathTagOption to path.
+func SetPathFields(model interface{}, path string) {
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if HasFireormOption(t.Field(i), PathTagOption) && field.Kind() == reflect.String && field.CanSet() {
+			field.SetString(path)
+		}
+	}
+}
+
+// ParentTagOption is the "fireorm" tag option marking the *firestore.DocumentRef field referencing
+// the parent document of a model stored in a subcollection (see UnderSameParent).
+const ParentTagOption = "parent"
+
+// ParentRef returns the parent document reference of the model: the value of its *firestore.DocumentRef field
+// tagged with the ParentTagOption, or of its only *firestore.DocumentRef field.
+func ParentRef(model interface{}) (*firestore.DocumentRef, error) {
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("model must be a struct or pointer to a struct")
+	}
+
+	refType := reflect.TypeOf((*firestore.DocumentRef)(nil))
+	var candidates []int
+	for i := 0; i < v.NumField(); i++ {
+		fieldDef := v.Type().Field(i)
+		if fieldDef.Type != refType {
+			continue
+		}
+		if HasFireormOption(fieldDef, ParentTagOption) {
+			candidates = []int{i}
+			break
+		}
+		candidates = append(candidates, i)
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("model %s has no *firestore.DocumentRef parent field", v.Type().Name())
+	case 1:
+	default:
+		return nil, fmt.Errorf("model %s has several *firestore.DocumentRef fields, tag the parent with `fireorm:\"%s\"`",
+			v.Type().Name(), ParentTagOption)
+	}
+
+	parent := v.Field(candidates[0]).Interface().(*firestore.DocumentRef)
+	if parent == nil {
+		return nil, fmt.Errorf("parent field %s of model %s is nil", v.Type().Field(candidates[0]).Name, v.Type().Name())
+	}
+	return parent, nil
+}
+
+// documentPath returns the slash-separated path of the document from the database root, e.g. "posts/p1".
+func documentPath(ref *firestore.DocumentRef) string {
+	var segments []string
+	for ref != nil {
+		segments = append([]string{ref.Parent.ID, ref.ID}, segments...)
+		ref = ref.Parent.Parent
+	}
+	return strings.Join(segments, "/")
+}
+
+// collectionPath returns the slash-separated path of the collection from the database root, e.g. "posts/p1/comments".
+func collectionPath(col *firestore.CollectionRef) string {
+	if col.Parent == nil {
+		return col.ID
+	}
+	return documentPath(col.Parent) + "/" + col.ID
+}
+
+// HasFireormOption reports whether the field's "fireorm" tag, a comma-separated list of options, contains option.
+func HasFireormOption(fieldDef reflect.StructField, option string) bool {
+	for _, tagOption := range strings.Split(fieldDef.Tag.Get("fireorm"), ",") {
+		if strings.TrimSpace(tagOption) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldByName looks up a struct field either by its Go name or by its "firestore" tag.
+func FieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	fieldDef, ok := StructFieldByName(v.Type(), name)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return v.FieldByIndex(fieldDef.Index), true
+}
+
+// StructFieldByName looks up a struct field definition either by its Go name or by its "firestore" tag.
+func StructFieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	if fieldDef, ok := t.FieldByName(name); ok {
+		return fieldDef, true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if fieldName, _ := FirestoreFieldName(t.Field(i)); fieldName == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// CompareValues compares two numeric or time.Time values.
+// It returns -1 if a < b, 0 if a == b and 1 if a > b.
+func CompareValues(a, b interface{}) (int, error) {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		if !ok {
+			return 0, fmt.Errorf("cannot compare time.Time with %T", b)
+		}
+		return at.Compare(bt), nil
+	}
+
+	an, ok := toNumber(a)
+	if !ok {
+		return 0, fmt.Errorf("unsupported comparison type %T", a)
+	}
+	bn, ok := toNumber(b)
+	if !ok {
+		return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+	}
+	return an.compare(bn), nil
+}
+
+// number holds a numeric value in its original precision.
+// Integers are kept as int64 or uint64 so that values above 2^53 still compare exactly.
+type number struct {
+	kind reflect.Kind // reflect.Int64, reflect.Uint64 or reflect.Float64
+	i    int64
+	u    uint64
+	f    float64
+}
+
+// toNumber converts any numeric value to a number.
+func toNumber(value interface{}) (number, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{kind: reflect.Int64, i: v.Int()}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return number{kind: reflect.Uint64, u: v.Uint()}, true
+	case reflect.Float32, reflect.Float64:
+		return number{kind: reflect.Float64, f: v.Float()}, true
+	}
+	return number{}, false
+}
+
+// float returns the value as a float64, which may lose precision for large integers.
+func (n number) float() float64 {
+	switch n.kind {
+	case reflect.Int64:
+		return float64(n.i)
+	case reflect.Uint64:
+		return float64(n.u)
+	}
+	return n.f
+}
+
+// compare returns -1, 0 or 1. Integers are compared exactly; floats are only used when one side is a float.
+func (n number) compare(other number) int {
+	switch {
+	case n.kind == reflect.Int64 && other.kind == reflect.Int64:
+		return cmp.Compare(n.i, other.i)
+	case n.kind == reflect.Uint64 && other.kind == reflect.Uint64:
+		return cmp.Compare(n.u, other.u)
+	case n.kind == reflect.Int64 && other.kind == reflect.Uint64:
+		if n.i < 0 {
+			return -1
+		}
+		return cmp.Compare(uint64(n.i), other.u)
+	case n.kind == reflect.Uint64 && other.kind == reflect.Int64:
+		return -other.compare(n)
+	}
+	return cmp.Compare(n.float(), other.float())
+}
+
+// FirestoreFieldName returns the stored field name from a struct field's "firestore" tag,
+// along with the tag options following it (e.g. "omitempty", "serverTimestamp").
+func FirestoreFieldName(fieldDef reflect.StructField) (string, map[string]bool) {
+	parts := strings.Split(fieldDef.Tag.Get("firestore"), ",")
+	options := make(map[string]bool, len(parts)-1)
+	for _, option := range parts[1:] {
+		options[strings.TrimSpace(option)] = true
+	}
+	return parts[0], options
+}
+
+// PendingServerTimestamps returns the names of the model's serverTimestamp fields that are still zero.
+// After a read, a zero field usually means the server timestamp has not been resolved yet (stored as null),
+// since the decode leaves the zero time in place. It only checks for zero values, so it cannot tell such
+// a field apart from one on a model that was never loaded or whose document lacks the field.
+func PendingServerTimestamps(model interface{}) []string {
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var pending []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if _, options := FirestoreFieldName(t.Field(i)); options["serverTimestamp"] && v.Field(i).IsZero() {
+			pending = append(pending, t.Field(i).Name)
+		}
+	}
+	return pending
+}
+
+// NilSliceMode controls how StructToMap stores nil slice fields.
+type NilSliceMode int
+
+const (
+	// NilSliceAsNull stores nil slices as null. This is the default and matches empty slices being stored as empty arrays.
+	NilSliceAsNull NilSliceMode = iota
+	// NilSliceOmit leaves nil slices out of the data map, so the field is absent from the document.
+	// Fields listed explicitly in a partial Save are still written, as null.
+	NilSliceOmit
+	// NilSliceAsEmpty stores nil slices as empty arrays, the same way as empty slices.
+	NilSliceAsEmpty
+)
+
+// EncodeOptions controls how StructToMapWithOptions converts a model to Firestore data.
+type EncodeOptions struct {
+	NilSlices NilSliceMode
+	// TruncateTimes truncates time.Time fields to microseconds. Firestore stores timestamps with
+	// microsecond precision, so without it a nanosecond-precise time reads back as a different value.
+	TruncateTimes bool
+	// FieldCodec encodes the fields tagged with the EncryptedTagOption "fireorm" option.
+	FieldCodec *Codec
+	// StripID leaves the field holding the document ID (see IDField) out of the data, whatever its tag,
+	// so that documents never store their own ID.
+	StripID bool
+	// ExcludedFields lists top-level fields, by Go name or "firestore" tag name, left out of the data.
+	ExcludedFields []string
+	// ConvertMapKeys stores maps with integer, boolean or encoding.TextMarshaler keys with their keys formatted
+	// as strings, as Firestore only stores string keys. Without it, writing such a map fails with an error.
+	// It applies to fields and to the maps and slices nested in them, including the values held by interface{}
+	// fields and elements, but not to maps inside nested structs. Maps held by interface values are read back
+	// with string keys, as their key type is unknown.
+	ConvertMapKeys bool
+}
+
+// excludes reports whether the top-level field is listed in ExcludedFields.
+func (opts EncodeOptions) excludes(fieldDef reflect.StructField, firestoreTag string) bool {
+	for _, excluded := range opts.ExcludedFields {
+		if excluded == fieldDef.Name || excluded == firestoreTag {
+			return true
+		}
+	}
+	return false
+}
+
+// nested returns the options applying to structs nested in a model, which ExcludedFields does not reach.
+func (opts EncodeOptions) nested() EncodeOptions {
+	opts.ExcludedFields = nil
+	return opts
 }
 
 // StructToMap converts a struct to a map (for Firestore), using the "firestore" tag for field names.
 func StructToMap(model interface{}) (map[string]interface{}, error) {
+	return StructToMapWithOptions(model, EncodeOptions{})
+}
+
+// StructToMapWithOptions converts a struct to a map (for Firestore) like StructToMap, applying opts.
+func StructToMapWithOptions(model interface{}, opts EncodeOptions) (map[string]interface{}, error) {
 	data := make(map[string]interface{})
 	v := reflect.ValueOf(model)
 	if v.Kind() == reflect.Ptr {
@@ -27,29 +375,472 @@ func StructToMap(model interface{}) (map[string]interface{}, error) {
 	}
 
 	t := v.Type()
+	idIndex := idFieldIndex(t)
 	for i := 0; i < t.NumField(); i++ {
 		fieldDef := t.Field(i)
-		firestoreTag := fieldDef.Tag.Get("firestore")
+		firestoreTag, tagOptions := FirestoreFieldName(fieldDef)
 		if firestoreTag == "" || firestoreTag == "-" {
 			continue
 		}
+		if opts.StripID && i == idIndex {
+			continue
+		}
+		if opts.excludes(fieldDef, firestoreTag) {
+			continue
+		}
 		fieldVal := v.Field(i)
-		data[firestoreTag] = fieldVal.Interface()
+		if tagOptions["omitempty"] && fieldVal.IsZero() {
+			continue
+		}
+		if tagOptions["serverTimestamp"] && fieldVal.IsZero() {
+			data[firestoreTag] = firestore.ServerTimestamp
+			continue
+		}
+		if fieldVal.Kind() == reflect.Slice && fieldVal.IsNil() {
+			switch opts.NilSlices {
+			case NilSliceOmit:
+				continue
+			case NilSliceAsEmpty:
+				data[firestoreTag] = reflect.MakeSlice(fieldVal.Type(), 0, 0).Interface()
+				continue
+			}
+		}
+		value, err := toFirestoreValue(fieldVal, opts)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", fieldDef.Name, err)
+		}
+		value, err = encodeField(fieldDef, value, opts)
+		if err != nil {
+			return nil, err
+		}
+		data[firestoreTag] = value
+	}
+	if upgrader, ok := schemaUpgrader(model); ok {
+		data[SchemaVersionField] = int64(upgrader.SchemaVersion())
+	}
+	if provider, ok := keywordProvider(model); ok {
+		data[KeywordsField] = normalizeKeywords(provider.SearchKeywords())
 	}
 	return data, nil
 }
 
-// IsNotFoundError checks if the provided error corresponds to a 'NotFound' or 'Unknown' gRPC status code.
+// keywordProvider returns the model as a KeywordProvider, also when it is a struct value whose method
+// has a pointer receiver.
+func keywordProvider(model interface{}) (KeywordProvider, bool) {
+	if provider, ok := model.(KeywordProvider); ok {
+		return provider, true
+	}
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	provider, ok := ptr.Interface().(KeywordProvider)
+	return provider, ok
+}
+
+// normalizeKeywords lowercases and trims keywords, dropping empty and duplicate ones. It never returns nil,
+// so that documents without keywords store an empty array.
+func normalizeKeywords(keywords []string) []string {
+	normalized := make([]string, 0, len(keywords))
+	seen := make(map[string]bool, len(keywords))
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" && !seen[keyword] {
+			seen[keyword] = true
+			normalized = append(normalized, keyword)
+		}
+	}
+	return normalized
+}
+
+// KeywordPrefixes returns the lowercased prefixes of every word of texts, for KeywordProvider models searchable
+// by prefix: "Ada Lovelace" gives "a", "ad", "ada", "l", "lo" and so on up to "lovelace". Words are separated
+// by white space. Prefixes grow the stored array quickly, so they are best kept to short fields like names.
+func KeywordPrefixes(texts ...string) []string {
+	var prefixes []string
+	for _, text := range texts {
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			runes := []rune(word)
+			for i := 1; i <= len(runes); i++ {
+				prefixes = append(prefixes, string(runes[:i]))
+			}
+		}
+	}
+	return normalizeKeywords(prefixes)
+}
+
+// KeywordQuery returns a query matching the documents of KeywordProvider models having keyword among their
+// search keywords. The keyword is normalized like the stored ones.
+func KeywordQuery(keyword string) Query {
+	return Query{Where: []WhereClause{{
+		Field:    KeywordsField,
+		Operator: "array-contains",
+		Value:    strings.ToLower(strings.TrimSpace(keyword)),
+	}}}
+}
+
+// schemaUpgrader returns the model as a SchemaUpgrader, also when it is a struct value whose methods
+// have pointer receivers.
+func schemaUpgrader(model interface{}) (SchemaUpgrader, bool) {
+	if upgrader, ok := model.(SchemaUpgrader); ok {
+		return upgrader, true
+	}
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	upgrader, ok := ptr.Interface().(SchemaUpgrader)
+	return upgrader, ok
+}
+
+// upgradeData runs the model's Upgrade hook on document data stored with an older schema version.
+// It reports whether the data was upgraded.
+func upgradeData(model interface{}, data map[string]interface{}) (map[string]interface{}, bool, error) {
+	upgrader, ok := model.(SchemaUpgrader)
+	if !ok {
+		return data, false, nil
+	}
+	storedVersion := 0
+	if version, ok := data[SchemaVersionField].(int64); ok {
+		storedVersion = int(version)
+	}
+	if storedVersion >= upgrader.SchemaVersion() {
+		return data, false, nil
+	}
+	upgraded, err := upgrader.Upgrade(storedVersion, data)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to upgrade document from schema version %d: %v", storedVersion, err)
+	}
+	return upgraded, true, nil
+}
+
+// fieldUpdateValue returns the value to store for the field named field (its "firestore" tag name)
+// in a partial save. It reads the struct field directly instead of the StructToMapWithOptions data,
+// so fields dropped by omitempty are still written and can be cleared.
+func fieldUpdateValue(model interface{}, field string, opts EncodeOptions) (interface{}, error) {
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		firestoreTag, tagOptions := FirestoreFieldName(t.Field(i))
+		if firestoreTag == "" || firestoreTag == "-" || firestoreTag != field {
+			continue
+		}
+		if opts.StripID && i == idFieldIndex(t) {
+			return nil, fmt.Errorf("field %s holds the document ID and is not written with StripID", field)
+		}
+		if opts.excludes(t.Field(i), firestoreTag) {
+			return nil, fmt.Errorf("field %s is excluded from writes", field)
+		}
+		fieldVal := v.Field(i)
+		if tagOptions["serverTimestamp"] && fieldVal.IsZero() {
+			return firestore.ServerTimestamp, nil
+		}
+		if fieldVal.Kind() == reflect.Slice && fieldVal.IsNil() {
+			// Listed fields are always written, so NilSliceOmit stores null like NilSliceAsNull
+			if opts.NilSlices == NilSliceAsEmpty {
+				return reflect.MakeSlice(fieldVal.Type(), 0, 0).Interface(), nil
+			}
+			return nil, nil
+		}
+		value, err := toFirestoreValue(fieldVal, opts)
+		if err != nil {
+			return nil, err
+		}
+		return encodeField(t.Field(i), value, opts)
+	}
+	return nil, fmt.Errorf("field %s not found in model data", field)
+}
+
+// toFirestoreValue converts a field value for storage. Maps holding tagged structs are converted
+// value by value with StructToMapWithOptions so the stored keys follow their "firestore" tags.
+// Times are truncated to microseconds when opts.TruncateTimes is set.
+func toFirestoreValue(v reflect.Value, opts EncodeOptions) (interface{}, error) {
+	held := v
+	if held.Kind() == reflect.Interface && !held.IsNil() {
+		held = held.Elem()
+	}
+	keyType := nonStringMapKey(held.Type())
+	if keyType == nil && holdsInterface(held.Type()) {
+		keyType = heldNonStringMapKey(held)
+	}
+	if keyType != nil {
+		if !opts.ConvertMapKeys {
+			return nil, fmt.Errorf("maps with %s keys cannot be stored, as Firestore map keys must be strings "+
+				"(see EncodeOptions.ConvertMapKeys)", keyType)
+		}
+		return toStringKeyedValue(held, opts)
+	}
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && isTaggedStruct(v.Type().Elem()) {
+		if v.IsNil() {
+			return nil, nil
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := iter.Value()
+			if elem.Kind() == reflect.Ptr && elem.IsNil() {
+				result[iter.Key().String()] = nil
+				continue
+			}
+			elemMap, err := StructToMapWithOptions(elem.Interface(), opts.nested())
+			if err != nil {
+				return nil, err
+			}
+			result[iter.Key().String()] = elemMap
+		}
+		return result, nil
+	}
+	if opts.TruncateTimes {
+		switch t := v.Interface().(type) {
+		case time.Time:
+			return t.Truncate(time.Microsecond), nil
+		case *time.Time:
+			if t != nil {
+				return t.Truncate(time.Microsecond), nil
+			}
+		}
+	}
+	return v.Interface(), nil
+}
+
+// nonStringMapKey returns the key type of the first map with non-string keys found in t, looking through
+// pointers, slices, arrays and map values, or nil.
+func nonStringMapKey(t reflect.Type) reflect.Type {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return nonStringMapKey(t.Elem())
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return t.Key()
+		}
+		return nonStringMapKey(t.Elem())
+	}
+	return nil
+}
+
+// holdsInterface reports whether values of type t may hold interface values, looking through pointers, slices,
+// arrays and map values, so that the maps they hold can only be found in the values themselves.
+func holdsInterface(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return holdsInterface(t.Elem())
+	}
+	return false
+}
+
+// heldNonStringMapKey returns the key type of the first map with non-string keys held in v, looking through
+// pointers, slices, arrays, map values and interface values, or nil.
+func heldNonStringMapKey(v reflect.Value) reflect.Type {
+	if !holdsInterface(v.Type()) {
+		return nonStringMapKey(v.Type())
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if !v.IsNil() {
+			return heldNonStringMapKey(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if keyType := heldNonStringMapKey(v.Index(i)); keyType != nil {
+				return keyType
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Type().Key()
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if keyType := heldNonStringMapKey(iter.Value()); keyType != nil {
+				return keyType
+			}
+		}
+	}
+	return nil
+}
+
+// toStringKeyedValue converts v, whose type holds maps with non-string keys, replacing those maps with
+// map[string]interface{} values keyed by the formatted keys.
+func toStringKeyedValue(v reflect.Value, opts EncodeOptions) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toFirestoreValue(v.Elem(), opts)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			value, err := toFirestoreValue(v.Index(i), opts)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := mapKeyString(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := result[key]; ok {
+				return nil, fmt.Errorf("map keys convert to the same string %q", key)
+			}
+			var value interface{}
+			elem := iter.Value()
+			switch {
+			case elem.Kind() == reflect.Ptr && elem.IsNil():
+			case isTaggedStruct(elem.Type()):
+				value, err = StructToMapWithOptions(elem.Interface(), opts.nested())
+			default:
+				value, err = toFirestoreValue(elem, opts)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %v", key, err)
+			}
+			result[key] = value
+		}
+		return result, nil
+	}
+	return v.Interface(), nil
+}
+
+// mapKeyString formats a map key as a string: with MarshalText for encoding.TextMarshaler keys, in decimal
+// for integers, and as "true" or "false" for booleans.
+func mapKeyString(key reflect.Value) (string, error) {
+	if marshaler, ok := key.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return "", fmt.Errorf("failed to convert map key %v: %v", key.Interface(), err)
+		}
+		return string(text), nil
+	}
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	case reflect.Bool:
+		return strconv.FormatBool(key.Bool()), nil
+	}
+	return "", fmt.Errorf("map keys of type %s cannot be converted to strings", key.Type())
+}
+
+// toQueryValue converts a where clause value like the data written for it, so that it compares equal to
+// the stored value: structs with "firestore" tags (and slices of them, for "in" and similar operators)
+// are converted with StructToMapWithOptions, and other values like field values with toFirestoreValue.
+func toQueryValue(value interface{}, opts EncodeOptions) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case isTaggedStruct(v.Type()):
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		return StructToMapWithOptions(value, opts.nested())
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && isTaggedStruct(v.Type().Elem()):
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			converted, err := toQueryValue(v.Index(i).Interface(), opts)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = converted
+		}
+		return values, nil
+	}
+	return toFirestoreValue(v, opts.nested())
+}
+
+// isTaggedStruct reports whether t is a struct (or pointer to a struct) with at least one "firestore" tag.
+func isTaggedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("firestore"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toJSONValue prepares Firestore document data for JSON encoding.
+// Document references are replaced by their paths, since they hold the client and cannot be marshaled.
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *firestore.DocumentRef:
+		if v == nil {
+			return nil
+		}
+		return v.Path
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			result[key] = toJSONValue(elem)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = toJSONValue(elem)
+		}
+		return result
+	}
+	return value
+}
+
+// IsNotFoundError checks if the provided error is ErrNotFound or corresponds to a 'NotFound' or 'Unknown' gRPC status code.
 //
 // Parameters:
-//   - err: The error to be checked, which is expected to be a gRPC error.
+//   - err: The error to be checked, which is expected to be a gRPC error or ErrNotFound.
 //
 // Returns:
-//   - bool: Returns true if the error has a gRPC status code of 'NotFound' or 'Unknown', otherwise false.
+//   - bool: Returns true if the error wraps ErrNotFound or has a gRPC status code of 'NotFound' or 'Unknown', otherwise false.
 func IsNotFoundError(err error) bool {
 	if err == nil {
 		return false
 	}
+	if errors.Is(err, ErrNotFound) {
+		return true
+	}
 	statusCode := status.Code(err)
 	return statusCode == codes.NotFound || statusCode == codes.Unknown
 }
+
+// recoverError converts a panic in a public DB method into an error naming the operation.
+// It must be deferred directly so that recover can intercept the panic.
+func recoverError(operation string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%s: panic occurred: %v", operation, r)
+	}
+}
@@ -0,0 +1,75 @@
+package fireorm
+
+import (
+	"context"
+)
+
+// AfterLoader is implemented by models that populate derived or transient fields after being loaded.
+// AfterLoad is called after the document is decoded in GetByID, FindOne and FindAll (per element).
+// A returned error fails the load.
+type AfterLoader interface {
+	AfterLoad(ctx context.Context) error
+}
+
+// FirestoreDecoder is implemented by models decoding their documents themselves, as a fast path avoiding the
+// reflection-based decode. When implemented, DecodeFirestore is called with the document data (after any
+// schema upgrade) instead of DocumentSnapshot.DataTo in GetByID, FindOne, FindAll and the other reads.
+// The ID field, encrypted fields and the AfterLoad hook are still handled by fireorm afterwards.
+type FirestoreDecoder interface {
+	DecodeFirestore(data map[string]interface{}) error
+}
+
+// DefaultsApplier is implemented by models filling their unset fields with defaults, e.g. a status of "active".
+// ApplyDefaults is called on the model by Save and the batch writes before it is encoded, so the defaults are
+// stored, including in fields tagged omitempty that would otherwise be left out. Partial saves only store the
+// selected fields.
+type DefaultsApplier interface {
+	ApplyDefaults()
+}
+
+// FieldSetter is implemented by models keeping some of their state in unexported fields, which the Firestore SDK
+// cannot set. After the exported fields are decoded, SetField is called with the name and raw Firestore value
+// (e.g. int64 for integers, map[string]interface{} for maps) of each stored field that no exported field
+// declares, in name order. A returned error fails the read, so SetField also reports fields the model does not
+// know, and WithStrictDecoding leaves them to it. Models implementing FirestoreDecoder decode all fields themselves.
+type FieldSetter interface {
+	SetField(name string, value interface{}) error
+}
+
+// DefaultOrderer is implemented by models whose query results have a default order, such as newest first.
+// FindAll and FindOne order their results by DefaultOrderBy when none of the queries has an OrderBy clause.
+type DefaultOrderer interface {
+	DefaultOrderBy() []OrderClause
+}
+
+// CompositeIDProvider is implemented by models keyed by a composite natural key (e.g. "tenant:resource").
+// When implemented, CompositeID replaces the ID field as the document ID in Save, GetByID, Delete
+// and the other operations addressing a single document. The returned ID must not contain "/".
+type CompositeIDProvider interface {
+	CompositeID() (string, error)
+}
+
+// KeywordsField is the document field holding the search keywords of models implementing KeywordProvider.
+const KeywordsField = "_keywords"
+
+// KeywordProvider is implemented by models searchable by keyword. Save and the batch writes store the keywords
+// returned by SearchKeywords in the KeywordsField array, lowercased and trimmed, without duplicates or empty
+// keywords, so that documents can be searched with an array-contains clause (see KeywordQuery). Partial saves
+// rewrite it too. Return KeywordPrefixes of the searchable text to support prefix search.
+type KeywordProvider interface {
+	SearchKeywords() []string
+}
+
+// SchemaVersionField is the document field holding the schema version of models implementing SchemaUpgrader.
+const SchemaVersionField = "_schemaVersion"
+
+// SchemaUpgrader is implemented by models whose stored documents are versioned.
+// Save and the batch writes stamp documents with SchemaVersion in the SchemaVersionField field. When a document
+// with an older version is read (documents without a version are version 0), Upgrade is called with the stored
+// version and raw data, and the returned data is decoded instead. Upgrade must handle every older version,
+// for example by applying successive migrations, and is only applied on read: the stored document is unchanged
+// until it is saved again.
+type SchemaUpgrader interface {
+	SchemaVersion() int
+	Upgrade(fromVersion int, data map[string]interface{}) (map[string]interface{}, error)
+}
@@ -0,0 +1,90 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// DefaultIdempotencyCollection is the collection in which SaveIdempotent records processed keys by default.
+const DefaultIdempotencyCollection = "_idempotency_keys"
+
+// WithIdempotencyCollection returns a new DB instance recording the keys processed by SaveIdempotent in the
+// root collection name instead of DefaultIdempotencyCollection.
+func (db *DB) WithIdempotencyCollection(name string) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.idempotencyCollection = name
+	return newInstance
+}
+
+// GetIdempotencyCollection returns the collection in which SaveIdempotent records processed keys.
+func (db *DB) GetIdempotencyCollection() string {
+	return db.options.idempotencyCollection
+}
+
+// SaveIdempotent saves the model like Save unless key was already processed, for exactly-once ingestion where
+// retried deliveries must not insert duplicates. The key is recorded as a document of the idempotency collection
+// (see WithIdempotencyCollection), with the collection and ID of the saved document, in the same transaction as
+// the save (the connection's transaction if there is one), so concurrent saves with the same key cannot both
+// write. Keys are shared by all models and must be valid document IDs. If the key was already processed,
+// SaveIdempotent is a no-op and returns nil, leaving the model unchanged. Recorded keys are never removed by
+// fireorm; expire them with a Firestore TTL policy on the processedAt field if needed.
+func (db *DB) SaveIdempotent(ctx context.Context, model interface{}, key string) (err error) {
+	defer recoverError("SaveIdempotent", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return ErrReadOnly
+	}
+	if key == "" || strings.Contains(key, "/") {
+		return fmt.Errorf("idempotency key must be a non-empty document ID, got %q", key)
+	}
+	if db.options.idempotencyCollection == "" {
+		return fmt.Errorf("idempotency collection cannot be empty")
+	}
+
+	saveIdempotent := func(ctx context.Context, dbInstance *DB) error {
+		colName, err := dbInstance.CollectionName()
+		if err != nil {
+			return err
+		}
+		if err := dbInstance.checkTransactionRead(); err != nil {
+			return err
+		}
+		keyRef := dbInstance.GetConnection().GetClient().Collection(dbInstance.options.idempotencyCollection).Doc(key)
+		doc, err := dbInstance.GetConnection().GetTransaction().Get(keyRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if doc != nil && doc.Exists() {
+			return nil
+		}
+
+		if err := dbInstance.Save(ctx, model); err != nil {
+			return err
+		}
+		id, err := dbInstance.resolveID(model)
+		if err != nil {
+			return err
+		}
+		return dbInstance.transactionWrite(func(tx *firestore.Transaction) error {
+			return tx.Create(keyRef, map[string]interface{}{
+				"collection":  colName,
+				"documentId":  id,
+				"processedAt": firestore.ServerTimestamp,
+			})
+		})
+	}
+
+	dbInstance := db.Model(model).(*DB)
+	if dbInstance.GetConnection().HasTransaction() {
+		return saveIdempotent(ctx, dbInstance)
+	}
+	return dbInstance.GetConnection().GetClient().RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		return saveIdempotent(ctx, dbInstance.WithTransaction(tx).(*DB))
+	}, dbInstance.transactionOptions()...)
+}
@@ -0,0 +1,87 @@
+package fireorm
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IDGenerator returns a new document ID. It is used by Save and SaveAll for models without an ID.
+type IDGenerator func() string
+
+// UUIDGenerator returns an IDGenerator producing random RFC 4122 version 4 UUIDs,
+// e.g. "f47ac10b-58cc-4372-a567-0e02b2c3d479".
+func UUIDGenerator() IDGenerator {
+	return func() string {
+		var b [16]byte
+		readRandom(b[:])
+		b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+		b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	}
+}
+
+// crockfordBase32 is the ULID alphabet. Its characters are in ascending byte order,
+// so ULIDs sort lexicographically in the order they were generated.
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator returns an IDGenerator producing ULIDs: 26 character IDs made of a millisecond
+// timestamp followed by 80 random bits. IDs generated within the same millisecond increment the
+// random part, so the IDs of one generator are strictly increasing and sort chronologically.
+func ULIDGenerator() IDGenerator {
+	var mu sync.Mutex
+	var lastMillis uint64
+	var entropy [10]byte
+	return func() string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		millis := uint64(time.Now().UnixMilli())
+		if millis <= lastMillis {
+			// Same millisecond (or a clock step back): keep the timestamp and increment the entropy
+			millis = lastMillis
+			incrementBytes(entropy[:])
+		} else {
+			readRandom(entropy[:])
+		}
+		lastMillis = millis
+
+		var id [16]byte
+		binary.BigEndian.PutUint16(id[0:2], uint16(millis>>32))
+		binary.BigEndian.PutUint32(id[2:6], uint32(millis))
+		copy(id[6:], entropy[:])
+		return encodeULID(id)
+	}
+}
+
+// encodeULID encodes the 128 bits of id as 26 Crockford base32 characters, most significant first.
+func encodeULID(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// incrementBytes adds one to the big-endian number held in b, wrapping around on overflow.
+func incrementBytes(b []byte) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return
+		}
+	}
+}
+
+// readRandom fills b from crypto/rand, which never fails on supported platforms.
+func readRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("fireorm: failed to read random bytes: %v", err))
+	}
+}
@@ -0,0 +1,56 @@
+package fireorm
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"regexp"
+	"strings"
+)
+
+// indexURLPattern matches the index creation link Firestore includes in missing index errors.
+var indexURLPattern = regexp.MustCompile(`https://console\.firebase\.google\.com/\S+`)
+
+// ErrIndexRequired is returned by FindAll when the query needs a composite index that does not exist,
+// typically because it orders by several fields. URL is the Firebase console link creating the index,
+// and OrderBy lists the orderings of the query. The original Firestore error is available through Unwrap.
+type ErrIndexRequired struct {
+	URL     string
+	OrderBy []OrderClause
+	Err     error
+}
+
+func (e *ErrIndexRequired) Error() string {
+	fields := make([]string, len(e.OrderBy))
+	for i, o := range e.OrderBy {
+		fields[i] = o.Field
+	}
+	return fmt.Sprintf("query ordered by [%s] requires a composite index, create it at %s",
+		strings.Join(fields, ", "), e.URL)
+}
+
+func (e *ErrIndexRequired) Unwrap() error {
+	return e.Err
+}
+
+// ParseIndexRequired returns an ErrIndexRequired for err if it is Firestore's missing index error
+// (a FailedPrecondition status holding an index creation link) for a query made of queries.
+func ParseIndexRequired(err error, queries []Query) (*ErrIndexRequired, bool) {
+	var indexErr *ErrIndexRequired
+	if errors.As(err, &indexErr) {
+		return indexErr, true
+	}
+	if status.Code(err) != codes.FailedPrecondition {
+		return nil, false
+	}
+	url := indexURLPattern.FindString(status.Convert(err).Message())
+	if url == "" {
+		return nil, false
+	}
+	var orderBy []OrderClause
+	for _, qry := range queries {
+		orderBy = append(orderBy, qry.OrderBy...)
+	}
+	return &ErrIndexRequired{URL: url, OrderBy: orderBy, Err: err}, true
+}
@@ -0,0 +1,75 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"maps"
+)
+
+// ModelIterator iterates over the documents matching a query, decoding them one at a time.
+// It must be stopped with Stop once it is no longer needed.
+type ModelIterator struct {
+	ctx  context.Context
+	db   *DB
+	iter *firestore.DocumentIterator
+	err  error
+
+	decodeErrors map[string]error
+}
+
+// Iterator returns a ModelIterator over the documents matching queries, as an alternative to FindAll
+// that does not load all results into a slice.
+func (db *DB) Iterator(ctx context.Context, queries []Query) *ModelIterator {
+	ctx, db = db.prepare(ctx)
+	it := &ModelIterator{ctx: ctx, db: db}
+	q, err := db.buildQuery(ctx, db.defaultOrdered(db.scoped(queries)))
+	if err != nil {
+		it.err = err
+		return it
+	}
+	it.iter, it.err = db.documentIterator(ctx, q)
+	return it
+}
+
+// Next decodes the next document into dest, which must be a pointer to the model struct.
+// It returns iterator.Done when there are no more documents, and keeps returning it afterwards.
+// Under DecodeErrorSkip and DecodeErrorCollect (see WithDecodeErrorPolicy), documents that cannot be decoded
+// are passed over, and dest may then hold partially decoded data until the next document is decoded into it.
+func (it *ModelIterator) Next(dest interface{}) (err error) {
+	defer recoverError("ModelIterator.Next", &err)
+	if it.err != nil {
+		return it.err
+	}
+	for {
+		doc, err := it.iter.Next()
+		if err != nil {
+			return err
+		}
+		err = it.db.decodeDocument(it.ctx, doc, dest)
+		switch {
+		case err == nil || it.db.options.decodeErrorPolicy == DecodeErrorFail:
+			return err
+		case it.db.options.decodeErrorPolicy == DecodeErrorCollect:
+			if it.decodeErrors == nil {
+				it.decodeErrors = make(map[string]error)
+			}
+			it.decodeErrors[doc.Ref.ID] = err
+		}
+	}
+}
+
+// DecodeErrors returns an *ErrPartialDecode holding the decode errors of the documents passed over so far
+// under DecodeErrorCollect, or nil if there are none.
+func (it *ModelIterator) DecodeErrors() error {
+	if len(it.decodeErrors) == 0 {
+		return nil
+	}
+	return &ErrPartialDecode{Errors: maps.Clone(it.decodeErrors)}
+}
+
+// Stop releases the resources of the iterator. Next returns iterator.Done after Stop.
+func (it *ModelIterator) Stop() {
+	if it.iter != nil {
+		it.iter.Stop()
+	}
+}
@@ -0,0 +1,96 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"time"
+)
+
+// Claim atomically claims the document identified by the model's ID by setting its leaseField, a time.Time
+// (or *time.Time) field given by Go name or "firestore" tag, to now+ttl, but only if the lease is unset (zero
+// or null) or already expired. It returns true when the document was claimed, in which case model is loaded
+// from the document with the new lease, and false when it is held by an unexpired lease. The check and the
+// write run in a transaction (the connection's transaction if there is one), so concurrent claims of the same
+// document cannot both succeed. Leases are compared with the local clock, so workers' clocks should be
+// synchronized well within ttl. Returns ErrNotFound if the document does not exist.
+func (db *DB) Claim(ctx context.Context, model interface{}, leaseField string, ttl time.Duration) (claimed bool, err error) {
+	defer recoverError("Claim", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return false, ErrReadOnly
+	}
+	if ttl <= 0 {
+		return false, fmt.Errorf("lease TTL must be positive, got %s", ttl)
+	}
+	fieldDef, ok := StructFieldByName(reflect.TypeOf(model), leaseField)
+	if !ok {
+		return false, fmt.Errorf("field %s not found in model", leaseField)
+	}
+	fieldTag, _ := FirestoreFieldName(fieldDef)
+	if fieldTag == "" || fieldTag == "-" {
+		return false, fmt.Errorf("field %s is not stored in firestore", leaseField)
+	}
+	if indirectType(fieldDef.Type) != reflect.TypeOf(time.Time{}) {
+		return false, fmt.Errorf("lease field %s must be a time.Time, got %s", leaseField, fieldDef.Type)
+	}
+
+	claim := func(ctx context.Context, dbInstance *DB) error {
+		claimed = false
+		docRef, err := dbInstance.documentRef(model)
+		if err != nil {
+			return err
+		}
+		if err := dbInstance.checkTransactionRead(); err != nil {
+			return err
+		}
+		doc, err := dbInstance.GetConnection().GetTransaction().Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if lease, err := doc.DataAt(fieldTag); err == nil && lease != nil {
+			expiry, ok := lease.(time.Time)
+			if !ok {
+				return fmt.Errorf("lease field %s holds %T, not a timestamp", leaseField, lease)
+			}
+			if !expiry.IsZero() && expiry.After(now) {
+				return nil
+			}
+		}
+
+		expiry := now.Add(ttl)
+		if err := dbInstance.decodeDocument(ctx, doc, model); err != nil {
+			return err
+		}
+		field, _ := FieldByName(reflect.ValueOf(model), fieldDef.Name)
+		if field.Kind() == reflect.Ptr {
+			field.Set(reflect.ValueOf(&expiry))
+		} else {
+			field.Set(reflect.ValueOf(expiry))
+		}
+		if err := dbInstance.transactionWrite(func(tx *firestore.Transaction) error {
+			return tx.Update(docRef, []firestore.Update{{FieldPath: firestore.FieldPath{fieldTag}, Value: expiry}})
+		}); err != nil {
+			return err
+		}
+		claimed = true
+		return nil
+	}
+
+	dbInstance := db.Model(model).(*DB)
+	if dbInstance.GetConnection().HasTransaction() {
+		return claimed, claim(ctx, dbInstance)
+	}
+	err = dbInstance.GetConnection().GetClient().RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		return claim(ctx, dbInstance.WithTransaction(tx).(*DB))
+	}, dbInstance.transactionOptions()...)
+	return claimed, err
+}
@@ -0,0 +1,114 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MutationOp is the kind of mutation reported by a MutationEvent.
+type MutationOp string
+
+const (
+	// MutationSave is a Save of a whole model or of selected fields.
+	MutationSave MutationOp = "save"
+	// MutationUpdate is an Update, of the model's document or of each document matching its queries.
+	MutationUpdate MutationOp = "update"
+	// MutationDelete is a Delete, including soft deletes.
+	MutationDelete MutationOp = "delete"
+)
+
+// MutationEvent describes a successful mutation of a document, for outbox and event-sourcing integrations.
+type MutationEvent struct {
+	Collection string
+	ID         string
+	Op         MutationOp
+	// Data holds the fields written, keyed by field path: every stored field for a Save of the whole model, the
+	// selected or updated fields otherwise, and nil for a Delete. Values are as written, so they may be
+	// Firestore sentinels such as firestore.ServerTimestamp.
+	Data map[string]interface{}
+}
+
+// MutationSink receives the events of the mutations made through a DB instance configured with WithMutationSink.
+type MutationSink interface {
+	// Emit is called with the event of each mutation made outside of a transaction, once the write succeeded.
+	// A returned error is returned by the mutation, whose write is not undone.
+	Emit(ctx context.Context, event MutationEvent) error
+	// OutboxCollection returns the root collection in which the events of mutations made in a transaction are
+	// written as documents, atomically with the mutations, for a relay to deliver them. Event documents hold
+	// the collection, id, op and data fields of the event and the server time in createdAt.
+	OutboxCollection() string
+}
+
+// WithMutationSink returns a new DB instance reporting every successful Save, Update and Delete to sink: the
+// event is passed to the sink after the write, or written to its outbox collection in the same transaction
+// when the mutation runs in one (see MutationSink). The batch and bulk operations are not reported. A nil sink
+// stops reporting.
+func (db *DB) WithMutationSink(sink MutationSink) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.mutationSink = sink
+	return newInstance
+}
+
+// emitMutation reports event to the mutation sink, if any: by writing it to the sink's outbox collection in the
+// connection's transaction, or else by passing it to the sink.
+func (db *DB) emitMutation(ctx context.Context, event MutationEvent) error {
+	sink := db.options.mutationSink
+	if sink == nil {
+		return nil
+	}
+	if !db.GetConnection().HasTransaction() {
+		if err := sink.Emit(ctx, event); err != nil {
+			return fmt.Errorf("mutation sink failed for %s/%s: %v", event.Collection, event.ID, err)
+		}
+		return nil
+	}
+
+	outbox := sink.OutboxCollection()
+	if outbox == "" {
+		return fmt.Errorf("mutation sink has no outbox collection for transactional mutations")
+	}
+	var data map[string]interface{}
+	if event.Data != nil {
+		data = make(map[string]interface{}, len(event.Data))
+		for path, value := range event.Data {
+			// A deleted field cannot be stored, so it is recorded as null
+			if value == firestore.Delete {
+				value = nil
+			}
+			data[path] = value
+		}
+	}
+	eventRef := db.GetConnection().GetClient().Collection(outbox).NewDoc()
+	return db.transactionWrite(func(tx *firestore.Transaction) error {
+		return tx.Create(eventRef, map[string]interface{}{
+			"collection": event.Collection,
+			"id":         event.ID,
+			"op":         string(event.Op),
+			"data":       data,
+			"createdAt":  firestore.ServerTimestamp,
+		})
+	})
+}
+
+// updateMutation returns the event of an Update of the document id of collection colName.
+func updateMutation(colName, id string, updates []firestore.Update) MutationEvent {
+	return MutationEvent{Collection: colName, ID: id, Op: MutationUpdate, Data: mutationData(updates)}
+}
+
+// mutationData returns the values of updates keyed by field path, with the segments of FieldPath updates joined
+// by dots.
+func mutationData(updates []firestore.Update) map[string]interface{} {
+	data := make(map[string]interface{}, len(updates))
+	for _, update := range updates {
+		path := update.Path
+		if len(update.FieldPath) > 0 {
+			path = strings.Join(update.FieldPath, ".")
+		}
+		data[path] = update.Value
+	}
+	return data
+}
@@ -0,0 +1,185 @@
+package fireorm
+
+import (
+	"bufio"
+	"bytes"
+	"cloud.google.com/go/firestore"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// ExportPageSize is the number of documents read per query by Export.
+const ExportPageSize = 500
+
+// Export writes the documents of the current model's collection matching the optional queries to w as
+// newline-delimited JSON, one object per line holding the document data plus its ID under the key set by
+// WithJSONIDKey ("id" by default), and returns the number of documents exported. Documents are read in pages
+// of ExportPageSize and written as they are read, so the collection is never held in memory.
+func (db *DB) Export(ctx context.Context, w io.Writer, queries ...[]Query) (exported int, err error) {
+	defer recoverError("Export", &err)
+	ctx, db = db.prepare(ctx)
+	var where []Query
+	if len(queries) > 0 {
+		where = queries[0]
+	}
+	q, err := db.buildQuery(ctx, where)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := queryLimit(where)
+	encoder := json.NewEncoder(w)
+	var lastDoc *firestore.DocumentSnapshot
+	for limit <= 0 || exported < limit {
+		page := q
+		if lastDoc != nil {
+			page = q.StartAfter(lastDoc)
+		}
+		pageSize := ExportPageSize
+		if limit > 0 && limit-exported < pageSize {
+			pageSize = limit - exported
+		}
+		docs, err := db.documents(ctx, page.Limit(pageSize))
+		if err != nil {
+			return exported, fmt.Errorf("failed to retrieve documents: %v", err)
+		}
+		for _, doc := range docs {
+			item := toJSONValue(doc.Data()).(map[string]interface{})
+			item[db.GetJSONIDKey()] = doc.Ref.ID
+			if err := encoder.Encode(item); err != nil {
+				return exported, fmt.Errorf("failed to write document %s: %v", doc.Ref.ID, err)
+			}
+			exported++
+		}
+		if len(docs) < pageSize {
+			break
+		}
+		lastDoc = docs[len(docs)-1]
+	}
+	return exported, nil
+}
+
+// Import reads newline-delimited JSON documents from r, as written by Export, and writes them into the current
+// model's collection in batches of BatchWriteLimit, under the ID stored in each line under the key set by
+// WithJSONIDKey ("id" by default). Each line is decoded into the model with DecodeMap and stored like Save
+// stores the model, so fields the model does not declare are dropped. Blank lines are ignored. Lines that are
+// not valid JSON objects, lack an ID or do not decode into the model are skipped, and their errors are
+// returned joined after the other documents have been written. It returns the number of documents imported.
+func (db *DB) Import(ctx context.Context, r io.Reader) (imported int, err error) {
+	defer recoverError("Import", &err)
+	ctx, db = db.prepare(ctx)
+	if db.options.readOnly {
+		return 0, ErrReadOnly
+	}
+	if db.GetConnection().HasTransaction() {
+		return 0, fmt.Errorf("importing documents is not supported in a transaction")
+	}
+	colName, err := db.CollectionName()
+	if err != nil {
+		return 0, err
+	}
+	defer db.invalidateQueryCache(colName)
+
+	collection := db.GetConnection().GetClient().Collection(colName)
+	batch := db.GetConnection().GetClient().Batch()
+	pending := 0
+	commit := func() error {
+		if _, err := batch.Commit(ctx); err != nil {
+			return fmt.Errorf("batch commit failed: %v", err)
+		}
+		imported += pending
+		batch = db.GetConnection().GetClient().Batch()
+		pending = 0
+		return nil
+	}
+
+	var malformed []error
+	reader := bufio.NewReader(r)
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return imported, fmt.Errorf("failed to read line %d: %v", lineNumber, readErr)
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			id, data, err := db.importLine(line)
+			if err != nil {
+				malformed = append(malformed, fmt.Errorf("line %d: %v", lineNumber, err))
+			} else {
+				batch.Set(collection.Doc(id), data)
+				pending++
+				if pending == BatchWriteLimit {
+					if err := commit(); err != nil {
+						return imported, err
+					}
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if pending > 0 {
+		if err := commit(); err != nil {
+			return imported, err
+		}
+	}
+	return imported, errors.Join(malformed...)
+}
+
+// importLine decodes a line read by Import into the document ID and the data to store.
+func (db *DB) importLine(line []byte) (string, map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var item map[string]interface{}
+	if err := decoder.Decode(&item); err != nil {
+		return "", nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if item == nil {
+		return "", nil, fmt.Errorf("expected a JSON object")
+	}
+	idKey := db.GetJSONIDKey()
+	id, ok := item[idKey].(string)
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", nil, fmt.Errorf("missing or invalid %q field", idKey)
+	}
+	delete(item, idKey)
+
+	model := reflect.New(db.GetModelType()).Interface()
+	if err := DecodeMap(fromJSONValue(item).(map[string]interface{}), model); err != nil {
+		return "", nil, err
+	}
+	data, err := StructToMapWithOptions(model, db.GetEncodeOptions())
+	if err != nil {
+		return "", nil, err
+	}
+	return id, data, nil
+}
+
+// fromJSONValue converts values decoded from JSON with json.Decoder.UseNumber to the types Firestore returns:
+// integral numbers become int64 and other numbers float64.
+func fromJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = fromJSONValue(elem)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = fromJSONValue(elem)
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,68 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"strings"
+)
+
+// Partitions splits the model's collection into about desiredCount ranges of document IDs, for reading a large
+// collection in parallel workers. Each returned Query holds the StartAt and EndBefore cursors of its range (the
+// first has no StartAt and the last no EndBefore), so the queries together match every document exactly once.
+// Pass each one to FindAll or Export on its own, optionally with where clauses; other orderings would
+// not line up with the ID cursors.
+// Firestore only partitions collection groups, so the group of the collection's ID is partitioned and the split
+// points falling in other collections of the same ID are dropped: fewer partitions than desired may be returned,
+// and always at least one.
+func (db *DB) Partitions(ctx context.Context, desiredCount int) (partitions []Query, err error) {
+	defer recoverError("Partitions", &err)
+	if desiredCount <= 0 {
+		return nil, fmt.Errorf("desired partition count must be positive, got %d", desiredCount)
+	}
+	if db.GetModelType() == nil {
+		return nil, fmt.Errorf("no model set, call db.Model(&Model{}) first")
+	}
+	colName, err := db.CollectionName()
+	if err != nil {
+		return nil, err
+	}
+
+	client := db.GetConnection().GetClient()
+	collection := client.Collection(colName)
+	groupQueries, err := client.CollectionGroup(collection.ID).GetPartitionedQueries(ctx, desiredCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to partition collection %s: %v", colName, err)
+	}
+
+	// The SDK keeps partition cursors unexported; they are read back from the serialized queries
+	prefix := collection.Path + "/"
+	var splitIDs []string
+	for _, groupQuery := range groupQueries {
+		serialized, err := groupQuery.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		var request firestorepb.RunQueryRequest
+		if err := proto.Unmarshal(serialized, &request); err != nil {
+			return nil, err
+		}
+		end := request.GetStructuredQuery().GetEndAt()
+		if end == nil || len(end.GetValues()) == 0 {
+			continue
+		}
+		id, ok := strings.CutPrefix(end.GetValues()[0].GetReferenceValue(), prefix)
+		if ok && id != "" && !strings.Contains(id, "/") {
+			splitIDs = append(splitIDs, id)
+		}
+	}
+
+	partitions = make([]Query, 0, len(splitIDs)+1)
+	var start []interface{}
+	for _, id := range splitIDs {
+		partitions = append(partitions, Query{StartAt: start, EndBefore: []interface{}{id}})
+		start = []interface{}{id}
+	}
+	return append(partitions, Query{StartAt: start}), nil
+}
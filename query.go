@@ -3,11 +3,21 @@ package fireorm
 import (
 	"cloud.google.com/go/firestore"
 	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
 )
 
 const (
 	QueryLimitMax       = 10_000
 	QueryLimitUnlimited = -1
+
+	// TransactionWriteLimit is the maximum number of documents a transaction may write.
+	TransactionWriteLimit = 500
+	// BatchWriteLimit is the maximum number of writes in a single batch commit.
+	BatchWriteLimit = 500
 )
 
 type IValueProvider interface {
@@ -16,22 +26,143 @@ type IValueProvider interface {
 }
 
 // Query defines the structure of a Firestore query.
+// Operations accept a slice of Query entries; all their where clauses are ANDed together (see DB.ApplyQueries).
 type Query struct {
 	Where   []WhereClause
 	OrderBy []OrderClause
 	Limit   int
+
+	// Cursors take either a single *firestore.DocumentSnapshot or values for the OrderBy fields, in order.
+	// When any cursor is set, an explicit "__name__" ordering is appended as a final tiebreaker.
+	StartAt    []interface{}
+	StartAfter []interface{}
+	EndAt      []interface{}
+	EndBefore  []interface{}
 }
 
 // WhereClause defines a single where condition.
 type WhereClause struct {
-	Field         string
-	Operator      string
+	// Field is a dot-separated path, so "tags.items" targets the items field nested in tags.
+	Field string
+	// FieldPath is used instead of Field when set, for paths whose segments contain dots
+	// (e.g. firestore.FieldPath{"labels", "v1.0"}).
+	FieldPath firestore.FieldPath
+	Operator  string
+	// Value is converted like the data written by Save, so a struct with "firestore" tags (or a slice of them)
+	// matches the map stored for it, and times are truncated when the DB instance truncates them on write.
+	// Values compared with a time.Time field of the model may also be RFC 3339 strings or Unix seconds.
 	Value         interface{}
 	ValueProvider IValueProvider
 }
 
+// ExplainMetrics holds the query plan and execution statistics reported by Firestore's query explain.
+type ExplainMetrics struct {
+	IndexesUsed       []map[string]interface{}
+	ResultsReturned   int64
+	ReadOperations    int64
+	ExecutionDuration time.Duration
+	DebugStats        map[string]interface{}
+}
+
+// fieldName returns the clause's field for messages, with FieldPath segments quoted.
+func (w WhereClause) fieldName() string {
+	if len(w.FieldPath) == 0 {
+		return w.Field
+	}
+	return fmt.Sprintf("%q", []string(w.FieldPath))
+}
+
+// path returns the segments of the clause's field path.
+func (w WhereClause) path() []string {
+	if len(w.FieldPath) > 0 {
+		return w.FieldPath
+	}
+	return strings.Split(w.Field, ".")
+}
+
+// isTimeField reports whether the field at path, whose segments are Go names or "firestore" tags,
+// is a time.Time (or pointer to one) field of the struct type t.
+func isTimeField(t reflect.Type, path []string) bool {
+	for _, segment := range path {
+		fieldDef, ok := StructFieldByName(t, segment)
+		if !ok {
+			return false
+		}
+		t = indirectType(fieldDef.Type)
+	}
+	return t == reflect.TypeOf(time.Time{})
+}
+
+// isLowercaseField reports whether the field at path, whose segments are Go names or "firestore" tags, is tagged
+// with the LowercaseTagOption in the struct type t.
+func isLowercaseField(t reflect.Type, path []string) bool {
+	for i, segment := range path {
+		fieldDef, ok := StructFieldByName(t, segment)
+		if !ok {
+			return false
+		}
+		if i == len(path)-1 {
+			return HasFireormOption(fieldDef, LowercaseTagOption)
+		}
+		t = indirectType(fieldDef.Type)
+	}
+	return false
+}
+
+// toTimeValue converts a value compared with a time field to a time.Time: times are kept, strings are parsed
+// as RFC 3339 and numbers are Unix seconds. Slices, as used by the "in" and "not-in" operators, are converted
+// element by element.
+func toTimeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, time.Time, *time.Time:
+		return value, nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as an RFC 3339 time", v)
+		}
+		return parsed, nil
+	case float32, float64:
+		seconds := reflect.ValueOf(v).Float()
+		whole := math.Floor(seconds)
+		return time.Unix(int64(whole), int64((seconds-whole)*1e9)).UTC(), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return time.Unix(rv.Int(), 0).UTC(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return time.Unix(int64(rv.Uint()), 0).UTC(), nil
+	case reflect.Slice, reflect.Array:
+		times := make([]interface{}, rv.Len())
+		for i := range times {
+			converted, err := toTimeValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %v", i, err)
+			}
+			times[i] = converted
+		}
+		return times, nil
+	}
+	return nil, fmt.Errorf("cannot compare a time with %T", value)
+}
+
 // OrderClause defines a single order by condition.
 type OrderClause struct {
 	Field     string
 	Direction firestore.Direction
 }
+
+// PrefixWhere returns the where clauses matching string fields that start with prefix.
+// Firestore has no LIKE operator, so the match is expressed as the range [prefix, prefix + "\uf8ff").
+// U+F8FF is the last code point of the Basic Multilingual Plane's private use area and sorts after most
+// characters found in text. The match is not complete: Firestore orders strings by their UTF-8 bytes,
+// so strings where prefix is followed by a code point above U+F8FF (such as CJK compatibility
+// characters or emoji) sort after the upper bound and are not returned.
+func PrefixWhere(field, prefix string) []WhereClause {
+	return []WhereClause{
+		{Field: field, Operator: ">=", Value: prefix},
+		{Field: field, Operator: "<", Value: prefix + "\uf8ff"},
+	}
+}
@@ -0,0 +1,173 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ModelConfig holds the settings of a model type registered with RegisterModel. Fields are named by their Go name.
+type ModelConfig struct {
+	// CollectionName replaces the collection name derived from the type name or its CollectionName method.
+	// Collection prefixes, suffixes and parents still apply.
+	CollectionName string
+	// IDField is the string field holding the document ID, replacing the field tagged with the IDTagOption
+	// and the "ID" field.
+	IDField string
+	// CreatedAtField is a time.Time field that Save, SaveAll and BatchUpsert set to the current time when it is zero.
+	CreatedAtField string
+	// UpdatedAtField is a time.Time field that Save, SaveAll and BatchUpsert set to the current time on every write.
+	// Saves of selected fields write it too if it has a "firestore" tag.
+	UpdatedAtField string
+	// SoftDeleteField is a *time.Time field, stored as null while the document is live. When set, Delete and
+	// DeleteStrict store the deletion time in it instead of deleting the document, queries (the Find methods,
+	// Iterator, Count and the other aggregations) only read documents where it is null, and GetByID returns
+	// ErrNotFound for soft-deleted documents. Use Unscoped to bypass it. Export, RenameCollection and
+	// DeleteCollection still process every document. Inside a transaction, soft-deleting a document that does
+	// not exist fails the commit.
+	SoftDeleteField string
+}
+
+// modelRegistration is a registered ModelConfig with the stored name of its soft-delete field.
+type modelRegistration struct {
+	config         ModelConfig
+	softDeletePath string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[reflect.Type]*modelRegistration{}
+)
+
+// RegisterModel registers config for the type of model (a struct or pointer to a struct), replacing any previous
+// registration. Model looks the configuration up by type, so every DB instance picks it up. Models are meant
+// to be registered once at startup, before they are used. It returns an error if a configured field does not
+// exist or has the wrong type.
+func RegisterModel(model interface{}, config ModelConfig) error {
+	t := reflect.TypeOf(model)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("model must be a struct or pointer to a struct, got %T", model)
+	}
+
+	registration := &modelRegistration{config: config}
+	if config.IDField != "" {
+		if _, err := configField(t, config.IDField, reflect.TypeOf("")); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{config.CreatedAtField, config.UpdatedAtField} {
+		if name == "" {
+			continue
+		}
+		if _, err := configField(t, name, reflect.TypeOf(time.Time{})); err != nil {
+			return err
+		}
+	}
+	if config.SoftDeleteField != "" {
+		fieldDef, err := configField(t, config.SoftDeleteField, reflect.TypeOf(&time.Time{}))
+		if err != nil {
+			return err
+		}
+		name, tagOptions := FirestoreFieldName(fieldDef)
+		if name == "-" || tagOptions["omitempty"] {
+			return fmt.Errorf("model %s: soft-delete field %s must be stored as null when nil", t.Name(), fieldDef.Name)
+		}
+		if name == "" {
+			name = fieldDef.Name
+		}
+		registration.softDeletePath = name
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[t] = registration
+	return nil
+}
+
+// configField returns the top-level field of t named name, checking that it has type want.
+func configField(t reflect.Type, name string, want reflect.Type) (reflect.StructField, error) {
+	fieldDef, ok := t.FieldByName(name)
+	if !ok || len(fieldDef.Index) != 1 {
+		return fieldDef, fmt.Errorf("model %s has no field %s", t.Name(), name)
+	}
+	if fieldDef.Type != want {
+		return fieldDef, fmt.Errorf("model %s: field %s must be a %s, got %s", t.Name(), name, want, fieldDef.Type)
+	}
+	return fieldDef, nil
+}
+
+// registeredModel returns the registration of the model type t, or nil.
+func registeredModel(t reflect.Type) *modelRegistration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[t]
+}
+
+// stampTimestamps sets the registered CreatedAtField (when zero) and UpdatedAtField of model to the current time.
+func (db *DB) stampTimestamps(model interface{}) {
+	registration := db.options.registration
+	if registration == nil {
+		return
+	}
+	v := reflect.Indirect(reflect.ValueOf(model))
+	now := time.Now()
+	if name := registration.config.CreatedAtField; name != "" && v.FieldByName(name).IsZero() {
+		v.FieldByName(name).Set(reflect.ValueOf(now))
+	}
+	if name := registration.config.UpdatedAtField; name != "" {
+		v.FieldByName(name).Set(reflect.ValueOf(now))
+	}
+}
+
+// updatedAtPath returns the "firestore" tag name of the registered UpdatedAtField, or an empty string.
+// Saves of selected fields only address tagged fields.
+func (db *DB) updatedAtPath() string {
+	registration := db.options.registration
+	if registration == nil || registration.config.UpdatedAtField == "" {
+		return ""
+	}
+	fieldDef, _ := db.GetModelType().FieldByName(registration.config.UpdatedAtField)
+	name, _ := FirestoreFieldName(fieldDef)
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// softDeletePath returns the stored name of the soft-delete field set with WithSoftDelete or registered with
+// RegisterModel, or an empty string when soft deletes are disabled or ignored with Unscoped.
+func (db *DB) softDeletePath() string {
+	switch {
+	case db.options.unscoped:
+		return ""
+	case db.options.softDeleteField != "":
+		return db.options.softDeleteField
+	case db.options.registration != nil:
+		return db.options.registration.softDeletePath
+	}
+	return ""
+}
+
+// softDeleted reports whether the document has been soft-deleted.
+func (db *DB) softDeleted(doc *firestore.DocumentSnapshot) bool {
+	path := db.softDeletePath()
+	if path == "" {
+		return false
+	}
+	return doc.Data()[path] != nil
+}
+
+// scoped returns queries restricted to documents that are not soft-deleted, for models with a SoftDeleteField.
+func (db *DB) scoped(queries []Query) []Query {
+	path := db.softDeletePath()
+	if path == "" {
+		return queries
+	}
+	live := Query{Where: []WhereClause{{FieldPath: firestore.FieldPath{path}, Operator: "==", Value: nil}}}
+	return append(queries[:len(queries):len(queries)], live)
+}
@@ -0,0 +1,103 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// CollectionQuery is one search of SearchAcross: the queries run against the collection of Model, whose type
+// also decodes the results.
+type CollectionQuery struct {
+	Model   interface{}
+	Queries []Query
+}
+
+// SearchResult is a document found by SearchAcross, tagged with the collection it was found in.
+type SearchResult struct {
+	Collection string
+	ID         string
+	// Model is a pointer to a new instance of the model type of the CollectionQuery, decoded from the document.
+	Model interface{}
+}
+
+// SearchAcross runs the queries of each CollectionQuery like FindAll, concurrently (see WithConcurrency), and
+// stores the results of all of them in dest, for searches spanning several collections. Results keep the order
+// of collectionQueries: the results of the first come first, in the order of its queries, and so on. Errors of
+// the individual searches are joined, and no results are stored if any search fails.
+func (db *DB) SearchAcross(ctx context.Context, collectionQueries []CollectionQuery, dest *[]SearchResult) (err error) {
+	defer recoverError("SearchAcross", &err)
+	ctx, db = db.prepare(ctx)
+	if dest == nil {
+		return fmt.Errorf("dest cannot be nil")
+	}
+	instances := make([]*DB, len(collectionQueries))
+	for i, collectionQuery := range collectionQueries {
+		if collectionQuery.Model == nil {
+			return fmt.Errorf("collection query %d has no model", i)
+		}
+		instances[i] = db.Model(collectionQuery.Model).(*DB)
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	found := make([][]*firestore.DocumentSnapshot, len(collectionQueries))
+	concurrency := db.GetConcurrency()
+	if db.GetConnection().HasTransaction() {
+		// Transaction reads are issued one at a time
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, collectionQuery := range collectionQueries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, dbInstance *DB, queries []Query) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var docs []*firestore.DocumentSnapshot
+			err := func() (err error) {
+				defer recoverError("SearchAcross", &err)
+				queries = dbInstance.defaultOrdered(dbInstance.scoped(queries))
+				docs, err = dbInstance.findDocuments(ctx, queries)
+				if indexErr, ok := ParseIndexRequired(err, queries); ok {
+					return indexErr
+				}
+				return err
+			}()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("collection query %d: %w", i, err))
+				return
+			}
+			found[i] = docs
+		}(i, instances[i], collectionQuery.Queries)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	var results []SearchResult
+	for i, docs := range found {
+		dbInstance := instances[i]
+		colName, err := dbInstance.CollectionName()
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			model := reflect.New(dbInstance.GetModelType()).Interface()
+			if err := dbInstance.decodeDocument(ctx, doc, model); err != nil {
+				return err
+			}
+			results = append(results, SearchResult{Collection: colName, ID: doc.Ref.ID, Model: model})
+		}
+	}
+	*dest = results
+	return nil
+}
@@ -0,0 +1,116 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// MaxDocumentSize is the maximum size of a Firestore document, in bytes.
+const MaxDocumentSize = 1 << 20
+
+// ErrDocumentTooLarge is returned by writes of documents whose estimated size exceeds MaxDocumentSize,
+// before anything is sent to Firestore.
+type ErrDocumentTooLarge struct {
+	// Path is the document path relative to the database root.
+	Path string
+	// Size is the estimated document size, in bytes.
+	Size int
+	// LargestField is the top-level field taking the most space, usually the one to move or split.
+	LargestField string
+}
+
+func (e *ErrDocumentTooLarge) Error() string {
+	return fmt.Sprintf("document %s is too large: its estimated size of %d bytes exceeds the %d bytes limit (largest field: %s)",
+		e.Path, e.Size, MaxDocumentSize, e.LargestField)
+}
+
+// checkDocumentSize returns an *ErrDocumentTooLarge if the document at path holding data exceeds MaxDocumentSize.
+// Sizes are estimated with Firestore's storage size rules: 32 bytes per document, plus the size of its name,
+// plus the size of each field name and value.
+func checkDocumentSize(path string, data map[string]interface{}) error {
+	size := 32 + documentNameSize(path)
+	largest, largestSize := "", -1
+	for key, value := range data {
+		fieldSize := len(key) + 1 + valueSize(reflect.ValueOf(value))
+		size += fieldSize
+		if fieldSize > largestSize {
+			largest, largestSize = key, fieldSize
+		}
+	}
+	if size > MaxDocumentSize {
+		return &ErrDocumentTooLarge{Path: path, Size: size, LargestField: largest}
+	}
+	return nil
+}
+
+// documentNameSize returns the storage size of the name of the document at path: the size of each
+// slash-separated segment plus 1, plus 16 bytes.
+func documentNameSize(path string) int {
+	size := 16
+	for _, segment := range strings.Split(path, "/") {
+		size += len(segment) + 1
+	}
+	return size
+}
+
+// valueSize returns the storage size of a field value: strings take their UTF-8 length plus 1, bytes their length,
+// booleans and nulls 1, numbers and timestamps 8, references the size of their document name, and arrays
+// and maps the sum of their elements (plus the size of the map keys).
+func valueSize(v reflect.Value) int {
+	if !v.IsValid() {
+		return 1
+	}
+	if !v.CanInterface() {
+		return 0
+	}
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return 8
+	case *firestore.DocumentRef:
+		if value == nil {
+			return 1
+		}
+		return documentNameSize(documentPath(value))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 1
+		}
+		return valueSize(v.Elem())
+	case reflect.String:
+		return v.Len() + 1
+	case reflect.Bool:
+		return 1
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Len()
+		}
+		size := 0
+		for i := 0; i < v.Len(); i++ {
+			size += valueSize(v.Index(i))
+		}
+		return size
+	case reflect.Map:
+		size := 0
+		iter := v.MapRange()
+		for iter.Next() {
+			size += len(fmt.Sprint(iter.Key().Interface())) + 1 + valueSize(iter.Value())
+		}
+		return size
+	case reflect.Struct:
+		// Structs left in the data, such as geographical points, are sized as maps of their fields
+		size := 0
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				size += len(v.Type().Field(i).Name) + 1 + valueSize(v.Field(i))
+			}
+		}
+		return size
+	}
+	return 8
+}
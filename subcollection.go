@@ -0,0 +1,76 @@
+package fireorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SubcollectionSpec names a subcollection of a document loaded by GetAggregate and the model field receiving
+// its documents.
+type SubcollectionSpec struct {
+	// Name is the ID of the subcollection under the document, e.g. "lineItems".
+	Name string
+	// Field is the slice field of the model, by Go name or "firestore" tag, receiving the documents of the
+	// subcollection. Its elements must be structs, decoded like the results of FindAll. Tag it `firestore:"-"`
+	// so that saving the model does not also store the subcollection in the document.
+	Field string
+	// Queries optionally filter, order or limit the documents loaded.
+	Queries []Query
+}
+
+// GetAggregate loads the document identified by the model's ID like GetByID, then the documents of each
+// subcollection of subSpecs into its slice field, replacing the field's elements, to read an aggregate root such
+// as an order with its line items. Subcollections are loaded one after the other, within the connection's
+// transaction if there is one. The specs are checked before anything is read.
+func (db *DB) GetAggregate(ctx context.Context, model interface{}, subSpecs []SubcollectionSpec) (err error) {
+	defer recoverError("GetAggregate", &err)
+	ctx, db = db.prepare(ctx)
+	fields := make([]reflect.Value, len(subSpecs))
+	for i, spec := range subSpecs {
+		if spec.Name == "" || strings.Contains(spec.Name, "/") {
+			return fmt.Errorf("subcollection name must be a non-empty collection ID, got %q", spec.Name)
+		}
+		field, ok := FieldByName(reflect.ValueOf(model), spec.Field)
+		if !ok || !field.CanSet() {
+			return fmt.Errorf("field %s not found in model", spec.Field)
+		}
+		if field.Kind() != reflect.Slice || field.Type().Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("field %s must be a slice of structs, got %s", spec.Field, field.Type())
+		}
+		fields[i] = field
+	}
+
+	if err := db.GetByID(ctx, model); err != nil {
+		return err
+	}
+	docRef, err := db.Model(model).(*DB).documentRef(model)
+	if err != nil {
+		return err
+	}
+	for i, spec := range subSpecs {
+		loaded := reflect.New(fields[i].Type())
+		subDB, err := db.sliceModel(loaded.Interface())
+		if err != nil {
+			return err
+		}
+		queries := subDB.defaultOrdered(subDB.scoped(spec.Queries))
+		q, err := subDB.ApplyQueries(ctx, docRef.Collection(spec.Name).Query, queries)
+		if err != nil {
+			return fmt.Errorf("subcollection %s: %v", spec.Name, err)
+		}
+		docs, err := subDB.documents(ctx, q)
+		if indexErr, ok := ParseIndexRequired(err, queries); ok {
+			return indexErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load subcollection %s: %v", spec.Name, err)
+		}
+		if err := subDB.appendDocuments(ctx, docs, loaded.Interface()); err != nil {
+			return err
+		}
+		fields[i].Set(loaded.Elem())
+	}
+	return nil
+}
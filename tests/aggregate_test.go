@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	for _, age := range []int{20, 30, 40} {
+		err := db.Save(ctx, &User{Name: "Aggregated", Age: age})
+		assert.NoError(t, err)
+	}
+	err := db.Save(ctx, &User{Name: "Other", Age: 99})
+	assert.NoError(t, err)
+
+	results, err := db.Aggregate(ctx, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Aggregated"}}},
+	}, []fireorm.AggregateSpec{
+		{Op: fireorm.AggregateCount, Alias: "total"},
+		{Op: fireorm.AggregateSum, Field: "age", Alias: "ageSum"},
+		{Op: fireorm.AggregateAvg, Field: "age", Alias: "ageAvg"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"total":  int64(3),
+		"ageSum": int64(90),
+		"ageAvg": float64(30),
+	}, results)
+}
+
+func TestRunAggregations(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	for _, age := range []int{15, 25, 35, 45, 55} {
+		err := db.Save(ctx, &User{Name: "Report", Age: age})
+		assert.NoError(t, err)
+	}
+
+	byAge := func(operator string, age int) []fireorm.Query {
+		return []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "age", Operator: operator, Value: age}}}}
+	}
+	results, err := db.WithConcurrency(3).RunAggregations(ctx, map[string][]fireorm.Query{
+		"minors":  byAge("<", 18),
+		"adults":  byAge(">=", 18),
+		"seniors": byAge(">=", 50),
+	}, []fireorm.AggregateSpec{{Op: fireorm.AggregateCount, Alias: "count"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]interface{}{
+		"minors":  {"count": int64(1)},
+		"adults":  {"count": int64(4)},
+		"seniors": {"count": int64(1)},
+	}, results)
+}
+
+func TestRunAggregationsErrors(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	// Invalid specs fail before any request is sent
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	results, err := db.RunAggregations(ctx, map[string][]fireorm.Query{"first": nil, "second": nil}, nil)
+	assert.Empty(t, results)
+	assert.ErrorContains(t, err, "aggregation first")
+	assert.ErrorContains(t, err, "aggregation second")
+}
+
+func TestCountUpTo(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	for i := 0; i < 5; i++ {
+		err := db.Save(ctx, &User{Name: "Counted", Age: i})
+		assert.NoError(t, err)
+	}
+	counted := []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Counted"}}},
+	}
+
+	count, err := db.CountUpTo(ctx, counted, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count, "The count should be capped at upTo")
+
+	count, err = db.CountUpTo(ctx, counted, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), count, "The actual count should be returned when below upTo")
+
+	count, err = db.CountUpTo(ctx, append(counted, fireorm.Query{Limit: 2}), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count, "A smaller query limit should be kept")
+
+	_, err = db.CountUpTo(ctx, counted, 0)
+	assert.Error(t, err)
+}
+
+func TestAggregateSpecValidation(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	invalid := map[string][]fireorm.AggregateSpec{
+		"no specs":        nil,
+		"empty alias":     {{Op: fireorm.AggregateCount}},
+		"duplicate alias": {{Op: fireorm.AggregateCount, Alias: "n"}, {Op: fireorm.AggregateSum, Field: "age", Alias: "n"}},
+		"missing field":   {{Op: fireorm.AggregateAvg, Alias: "avg"}},
+		"unknown op":      {{Op: fireorm.AggregateOp(42), Alias: "x"}},
+	}
+	for name, specs := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := db.Aggregate(ctx, nil, specs)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCountByTimeBucket(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&Event{})
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{1, 5, 7, 26, 50, 51, 52, 80} {
+		err := db.Save(ctx, &Event{Name: "tick", CreatedAt: day.Add(offset * time.Hour)})
+		assert.NoError(t, err)
+	}
+	err := db.Save(ctx, &Event{Name: "other", CreatedAt: day.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+
+	ticks := []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "tick"}}}}
+	counts, err := db.WithConcurrency(2).CountByTimeBucket(ctx, "createdAt", day, day.Add(60*time.Hour), 24*time.Hour, ticks)
+	assert.NoError(t, err)
+	assert.Equal(t, map[time.Time]int64{
+		day:                     3,
+		day.Add(24 * time.Hour): 1,
+		day.Add(48 * time.Hour): 3,
+	}, counts, "The last bucket should be cut at end")
+
+	counts, err = db.CountByTimeBucket(ctx, "createdAt", day.Add(96*time.Hour), day.Add(98*time.Hour), time.Hour, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[time.Time]int64{day.Add(96 * time.Hour): 0, day.Add(97 * time.Hour): 0}, counts,
+		"Empty buckets should be counted as 0")
+}
+
+func TestCountByTimeBucketValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil)).Model(&Event{})
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := db.CountByTimeBucket(ctx, "", start, start.Add(time.Hour), time.Minute, nil)
+	assert.Error(t, err)
+	_, err = db.CountByTimeBucket(ctx, "createdAt", start, start.Add(time.Hour), 0, nil)
+	assert.Error(t, err)
+	_, err = db.CountByTimeBucket(ctx, "createdAt", start, start, time.Minute, nil)
+	assert.Error(t, err, "The range should not be empty")
+}
+
+func TestCountDistinct(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	for _, email := range []string{"a@example.com", "b@example.com", "a@example.com", "c@example.com", "b@example.com"} {
+		err := db.Save(ctx, &User{Name: "Customer", Email: email, Age: 30})
+		assert.NoError(t, err)
+	}
+	err := db.Save(ctx, &User{Name: "Other", Email: "d@example.com", Age: 30})
+	assert.NoError(t, err)
+	customers := []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Customer"}}}}
+
+	count, err := db.CountDistinct(ctx, "email", customers)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count, "Duplicate values should be counted once")
+
+	count, err = db.CountDistinct(ctx, "email", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+
+	count, err = db.CountDistinct(ctx, "age", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = db.CountDistinct(ctx, "missing", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count, "Documents without the field should not be counted")
+
+	count, err = db.WithDistinctLimit(2).Model(&User{}).CountDistinct(ctx, "email", customers)
+	assert.ErrorIs(t, err, fireorm.ErrDistinctLimit)
+	assert.Equal(t, int64(2), count)
+
+	count, err = db.WithDistinctLimit(3).Model(&User{}).CountDistinct(ctx, "email", customers)
+	assert.NoError(t, err, "Reaching the limit should not fail")
+	assert.Equal(t, int64(3), count)
+}
+
+func TestCountDistinctValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil))
+
+	_, err := db.Model(&User{}).CountDistinct(ctx, "", nil)
+	assert.Error(t, err)
+	_, err = db.CountDistinct(ctx, "email", nil)
+	assert.Error(t, err, "A model should be required")
+}
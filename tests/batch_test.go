@@ -0,0 +1,396 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetByIDs(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+
+	// Seed every fourth ID as missing
+	var ids []string
+	for i := 0; i < 2000; i++ {
+		ids = append(ids, fmt.Sprintf("bulk-%04d", i))
+	}
+	batch := client.Batch()
+	pending := 0
+	for i, id := range ids {
+		if i%4 == 3 {
+			continue
+		}
+		batch.Set(client.Collection("users").Doc(id), map[string]interface{}{"name": id, "age": i})
+		pending++
+		if pending == fireorm.BatchWriteLimit {
+			_, err := batch.Commit(ctx)
+			assert.NoError(t, err)
+			batch = client.Batch()
+			pending = 0
+		}
+	}
+	if pending > 0 {
+		_, err := batch.Commit(ctx)
+		assert.NoError(t, err)
+	}
+
+	var users []User
+	err := db.WithConcurrency(4).GetByIDs(ctx, ids, &users)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1500)
+
+	expected := 0
+	for _, user := range users {
+		for expected%4 == 3 {
+			expected++
+		}
+		assert.Equal(t, ids[expected], user.ID)
+		assert.Equal(t, ids[expected], user.Name)
+		expected++
+	}
+
+	err = db.GetByIDs(ctx, []string{"bulk-0000", ""}, &users)
+	assert.Error(t, err, "Expected an error for an empty ID")
+}
+
+func TestGetByIDsOrdered(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	for _, id := range []string{"present-1", "present-2", "present-3"} {
+		assert.NoError(t, db.Save(ctx, &User{ID: id, Name: id}))
+	}
+
+	ids := []string{"absent-1", "present-2", "absent-2", "present-1", "present-2", "present-3", "absent-3"}
+	users := []User{{ID: "stale"}}
+	missing, err := db.GetByIDsOrdered(ctx, ids, &users)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"absent-1", "absent-2", "absent-3"}, missing)
+	if assert.Len(t, users, len(ids), "Results should replace the slice with one element per ID") {
+		for i, id := range ids {
+			if strings.HasPrefix(id, "absent") {
+				assert.Equal(t, User{}, users[i], "Missing positions should be zero")
+			} else {
+				assert.Equal(t, id, users[i].ID, "Results should follow the order of the IDs")
+				assert.Equal(t, id, users[i].Name)
+			}
+		}
+	}
+
+	missing, err = db.GetByIDsOrdered(ctx, nil, &users)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+	assert.Empty(t, users)
+
+	_, err = db.GetByIDsOrdered(ctx, []string{"present-1", ""}, &users)
+	assert.Error(t, err, "Expected an error for an empty ID")
+}
+
+func TestDeleteCollection(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	articles := fireorm.New(fireorm.NewConnection(client)).Model(&Article{})
+
+	seed := func() []*Article {
+		var created []*Article
+		for i := 0; i < 5; i++ {
+			article := &Article{Title: fmt.Sprintf("Article %d", i)}
+			err := articles.Save(ctx, article)
+			assert.NoError(t, err)
+			docRef, err := articles.DocRef(article)
+			assert.NoError(t, err)
+			for j := 0; j < 2; j++ {
+				_, _, err = docRef.Collection("comments").Add(ctx, map[string]interface{}{"text": "comment"})
+				assert.NoError(t, err)
+			}
+			created = append(created, article)
+		}
+		return created
+	}
+
+	t.Run("Recursive", func(t *testing.T) {
+		created := seed()
+
+		deleted, err := articles.WithRecursiveDelete(true).DeleteCollection(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 15, deleted, "5 articles and 10 comments should be deleted")
+
+		var remaining []Article
+		err = articles.FindAll(ctx, nil, &remaining)
+		assert.NoError(t, err)
+		assert.Empty(t, remaining)
+
+		for _, article := range created {
+			docRef, err := articles.DocRef(article)
+			assert.NoError(t, err)
+			comments, err := docRef.Collection("comments").Documents(ctx).GetAll()
+			assert.NoError(t, err)
+			assert.Empty(t, comments)
+		}
+	})
+
+	t.Run("Non Recursive", func(t *testing.T) {
+		created := seed()
+
+		deleted, err := articles.DeleteCollection(ctx, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, deleted)
+
+		docRef, err := articles.DocRef(created[0])
+		assert.NoError(t, err)
+		comments, err := docRef.Collection("comments").Documents(ctx).GetAll()
+		assert.NoError(t, err)
+		assert.Len(t, comments, 2, "Subcollections are kept without recursion")
+	})
+
+	t.Run("Invalid Batch Size", func(t *testing.T) {
+		_, err := articles.DeleteCollection(ctx, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestSaveAll(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+
+	users := []User{
+		{Name: "Save All New 1", Email: "saveall1@example.com"},
+		{ID: "save-all-existing", Name: "Save All Existing", Email: "saveall2@example.com"},
+		{Name: "Save All New 2", Email: "saveall3@example.com"},
+	}
+	ids, err := db.SaveAll(ctx, users)
+	assert.NoError(t, err)
+	assert.Len(t, ids, len(users))
+	assert.NotEmpty(t, ids[0])
+	assert.Equal(t, "", ids[1], "Models with an ID should not get a generated one")
+	assert.NotEmpty(t, ids[2])
+	assert.Equal(t, ids[0], users[0].ID)
+	assert.Equal(t, ids[2], users[2].ID)
+
+	for _, user := range users {
+		retrieved := &User{ID: user.ID}
+		err := db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, user.Name, retrieved.Name)
+	}
+
+	pointers := []*User{{Name: "Save All Pointer"}}
+	ids, err = db.SaveAll(ctx, pointers)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{pointers[0].ID}, ids)
+
+	_, err = db.SaveAll(ctx, User{})
+	assert.Error(t, err, "Expected an error for a non-slice argument")
+}
+
+func TestBatchUpsert(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+
+	// Seed half of the documents with a field the model does not hold
+	for i := 0; i < 2; i++ {
+		_, err := client.Collection("users").Doc(fmt.Sprintf("upsert-%d", i)).Set(ctx, map[string]interface{}{
+			"name":     "Old",
+			"nickname": fmt.Sprintf("nick-%d", i),
+		})
+		assert.NoError(t, err)
+	}
+
+	users := []*User{
+		{ID: "upsert-0", Name: "Merged 0", Age: 10},
+		{ID: "upsert-1", Name: "Merged 1", Age: 11},
+		{Name: "Created 2", Age: 12},
+		{Name: "Created 3", Age: 13},
+	}
+	err := db.BatchUpsert(ctx, users)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, users[2].ID, "IDs should be generated for new models")
+	assert.NotEmpty(t, users[3].ID)
+
+	for i := 0; i < 2; i++ {
+		doc, err := client.Collection("users").Doc(fmt.Sprintf("upsert-%d", i)).Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("Merged %d", i), doc.Data()["name"])
+		assert.Equal(t, fmt.Sprintf("nick-%d", i), doc.Data()["nickname"], "Existing fields should be preserved")
+	}
+	for _, user := range users[2:] {
+		retrieved := &User{ID: user.ID}
+		err := db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, user.Name, retrieved.Name)
+	}
+}
+
+func TestGetByRefs(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client))
+	post1 := client.Doc("posts/post-1")
+	post2 := client.Doc("posts/post-2")
+	first := &Comment{Post: post1, Text: "On post 1"}
+	second := &Comment{Post: post2, Text: "On post 2"}
+	for _, comment := range []*Comment{first, second} {
+		err := db.UnderSameParent(ctx, comment).Save(ctx, comment)
+		assert.NoError(t, err)
+	}
+
+	refs := []*firestore.DocumentRef{
+		post2.Collection("comments").Doc(second.ID),
+		post1.Collection("comments").Doc("missing"),
+		post1.Collection("comments").Doc(first.ID),
+	}
+	var comments []Comment
+	err := db.GetByRefs(ctx, refs, &comments)
+	assert.NoError(t, err)
+	assert.Len(t, comments, 2, "Missing documents should be skipped")
+	assert.Equal(t, second.ID, comments[0].ID, "Documents should follow the order of refs")
+	assert.Equal(t, "On post 2", comments[0].Text)
+	assert.Equal(t, first.ID, comments[1].ID)
+	assert.Equal(t, post1.Path, comments[1].Post.Path)
+
+	err = db.GetByRefs(ctx, []*firestore.DocumentRef{nil}, &comments)
+	assert.Error(t, err)
+	err = db.GetByRefs(ctx, refs, comments)
+	assert.Error(t, err, "dest must be a pointer to a slice")
+}
+
+func TestRenameCollection(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	articles := fireorm.New(fireorm.NewConnection(client)).Model(&Article{})
+	ids := map[string]bool{}
+	for i := 0; i < 7; i++ {
+		article := &Article{Title: fmt.Sprintf("Article %d", i), Tags: []string{"renamed"}}
+		err := articles.Save(ctx, article)
+		assert.NoError(t, err)
+		ids[article.ID] = true
+	}
+
+	copied, err := articles.RenameCollection(ctx, "articles_v2", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, copied)
+	docs, err := client.Collection("articles_v2").Documents(ctx).GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, docs, 7)
+	for _, doc := range docs {
+		assert.True(t, ids[doc.Ref.ID], "Document IDs should be preserved")
+		assert.Equal(t, []interface{}{"renamed"}, doc.Data()["tags"])
+	}
+	var remaining []Article
+	err = articles.FindAll(ctx, nil, &remaining)
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 7, "The source should be kept without deleteOld")
+
+	copied, err = articles.RenameCollection(ctx, "articles_v2", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, copied, "Copying again should overwrite the existing documents")
+	docs, err = client.Collection("articles_v2").Documents(ctx).GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, docs, 7)
+	var deleted []Article
+	err = articles.FindAll(ctx, nil, &deleted)
+	assert.NoError(t, err)
+	assert.Empty(t, deleted, "The source should be deleted with deleteOld")
+
+	// Subcollections are not copied, so a recursive DB instance must keep them
+	recursive := articles.WithRecursiveDelete(true).Model(&Article{})
+	err = recursive.Save(ctx, &Article{ID: "article-sub", Title: "With views"})
+	assert.NoError(t, err)
+	_, err = client.Collection("articles").Doc("article-sub").Collection("views").Doc("view-1").Set(ctx, map[string]interface{}{"count": 1})
+	assert.NoError(t, err)
+	copied, err = recursive.RenameCollection(ctx, "articles_v2", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, copied)
+	view, err := client.Collection("articles").Doc("article-sub").Collection("views").Doc("view-1").Get(ctx)
+	if assert.NoError(t, err, "Subcollections of the source should not be deleted") {
+		assert.True(t, view.Exists())
+	}
+
+	// The new name is resolved like the model's collection name
+	prefixed := fireorm.New(fireorm.NewConnection(client)).WithCollectionPrefix("dev_").Model(&Article{})
+	err = prefixed.Save(ctx, &Article{Title: "Prefixed"})
+	assert.NoError(t, err)
+	copied, err = prefixed.RenameCollection(ctx, "archive", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, copied)
+	docs, err = client.Collection("dev_archive").Documents(ctx).GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, docs, 1, "The prefix should be added to the new name")
+}
+
+func TestRenameCollectionValidation(t *testing.T) {
+	ctx := context.Background()
+	articles := fireorm.New(fireorm.NewConnection(nil)).Model(&Article{})
+
+	_, err := articles.RenameCollection(ctx, "", false)
+	assert.Error(t, err)
+	_, err = articles.RenameCollection(ctx, "articles", false)
+	assert.Error(t, err, "A collection cannot be renamed to itself")
+	_, err = articles.WithCollectionPrefix("dev_").Model(&Article{}).RenameCollection(ctx, "articles", false)
+	assert.Error(t, err, "The new name should get the collection prefix")
+	_, err = articles.WithReadOnly().RenameCollection(ctx, "articles_v2", true)
+	assert.ErrorIs(t, err, fireorm.ErrReadOnly)
+}
+
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	var reported []int
+	db := fireorm.New(fireorm.NewConnection(client)).WithProgress(func(processed int) {
+		reported = append(reported, processed)
+	}).Model(&User{})
+
+	users := make([]User, 0, 600)
+	for i := 0; i < 600; i++ {
+		users = append(users, User{Name: "Bulk", Age: i})
+	}
+	_, err := db.SaveAll(ctx, users)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{fireorm.BatchWriteLimit, 600}, reported, "SaveAll should report after each batch")
+
+	reported = nil
+	err = db.SetUpdateBatchSize(250).Update(ctx, &User{}, []firestore.Update{{Path: "age", Value: 1}}, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Bulk"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{250, 500, 600}, reported, "Update by query should report cumulative counts")
+
+	reported = nil
+	deleted, err := db.DeleteCollection(ctx, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, 600, deleted)
+	assert.Equal(t, []int{200, 400, 600}, reported)
+}
@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryCache is an in-memory fireorm.Cache.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+func (c *memoryCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *memoryCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := memoryCacheEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = entry
+}
+
+// countingConnection counts the calls to GetClient, which every Firestore round trip goes through.
+// The count is atomic, as background refreshes call GetClient concurrently.
+type countingConnection struct {
+	*fireorm.Connection
+	clientCalls atomic.Int64
+}
+
+func (c *countingConnection) GetClient() *firestore.Client {
+	c.clientCalls.Add(1)
+	return c.Connection.GetClient()
+}
+
+func TestQueryCache(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	conn := &countingConnection{Connection: fireorm.NewConnection(client)}
+	cache := newMemoryCache()
+	db := fireorm.New(conn).WithQueryCache(cache, time.Minute).Model(&User{})
+
+	err := db.Save(ctx, &User{Name: "Cached", Email: "cached@example.com"})
+	assert.NoError(t, err)
+	queries := []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Cached"}}},
+	}
+
+	var users []User
+	err = db.FindAll(ctx, queries, &users)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	calls := conn.clientCalls.Load()
+	var cached []User
+	err = db.FindAll(ctx, queries, &cached)
+	assert.NoError(t, err)
+	assert.Equal(t, users, cached)
+	assert.Equal(t, calls, conn.clientCalls.Load(), "A cache hit should not reach Firestore")
+
+	var other []User
+	err = db.FindAll(ctx, []fireorm.Query{{Limit: 1}}, &other)
+	assert.NoError(t, err)
+	assert.Greater(t, conn.clientCalls.Load(), calls, "Other queries should not share the cached result")
+
+	err = db.Save(ctx, &User{Name: "Cached", Email: "cached2@example.com"})
+	assert.NoError(t, err)
+	calls = conn.clientCalls.Load()
+	err = db.FindAll(ctx, queries, &cached)
+	assert.NoError(t, err)
+	assert.Len(t, cached, 2, "Writes to the collection should invalidate the cached results")
+	assert.Greater(t, conn.clientCalls.Load(), calls)
+
+	expiring := fireorm.New(conn).WithQueryCache(newMemoryCache(), time.Millisecond).Model(&User{})
+	err = expiring.FindAll(ctx, queries, &cached)
+	assert.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	calls = conn.clientCalls.Load()
+	err = expiring.FindAll(ctx, queries, &cached)
+	assert.NoError(t, err)
+	assert.Greater(t, conn.clientCalls.Load(), calls, "Expired results should be fetched again")
+}
+
+func TestStaleCount(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	uncached := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	err := uncached.Save(ctx, &User{Name: "Counted"})
+	assert.NoError(t, err)
+	queries := []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Counted"}}},
+	}
+
+	conn := &countingConnection{Connection: fireorm.NewConnection(client)}
+	db := fireorm.New(conn).WithQueryCache(newMemoryCache(), 10*time.Millisecond).WithStaleCount(time.Minute).Model(&User{})
+	count, err := db.Count(ctx, queries)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	calls := conn.clientCalls.Load()
+	count, err = db.Count(ctx, queries)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, calls, conn.clientCalls.Load(), "A fresh count should be served from the cache")
+
+	// Writes through another instance do not invalidate the cache
+	err = uncached.Save(ctx, &User{Name: "Counted"})
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	count, err = db.Count(ctx, queries)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count, "A stale count should be returned immediately")
+	assert.Eventually(t, func() bool {
+		count, err := db.Count(ctx, queries)
+		return err == nil && count == 2
+	}, time.Second, 5*time.Millisecond, "The stale count should be refreshed in the background")
+
+	count, err = uncached.Count(ctx, queries)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count, "Counts without a cache should be read directly")
+}
+
+// nameProvider provides the name held at the time of the query.
+type nameProvider struct {
+	name atomic.Value
+}
+
+func (p *nameProvider) GetValue(ctx context.Context) (interface{}, error) {
+	return p.name.Load(), nil
+}
+
+func (p *nameProvider) SaveLastValue(ctx context.Context, change *firestore.DocumentChange) error {
+	return nil
+}
+
+func TestQueryCacheValueProvider(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).WithQueryCache(newMemoryCache(), time.Minute).Model(&User{})
+	assert.NoError(t, db.Save(ctx, &User{Name: "First"}))
+	assert.NoError(t, db.Save(ctx, &User{Name: "Second"}))
+	assert.NoError(t, db.Save(ctx, &User{Name: "Second"}))
+
+	provider := &nameProvider{}
+	provider.name.Store("First")
+	queries := []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", ValueProvider: provider}}},
+	}
+	var users []User
+	assert.NoError(t, db.FindAll(ctx, queries, &users))
+	assert.Len(t, users, 1)
+	count, err := db.Count(ctx, queries)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	provider.name.Store("Second")
+	users = nil
+	assert.NoError(t, db.FindAll(ctx, queries, &users))
+	if assert.Len(t, users, 2, "A new provider value should not be served the cached results") {
+		assert.Equal(t, "Second", users[0].Name)
+	}
+	count, err = db.Count(ctx, queries)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count, "A new provider value should not be served the cached count")
+	assert.Nil(t, queries[0].Where[0].Value, "The caller's queries should be left unchanged")
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type recordedCall struct {
+	method   string
+	metadata metadata.MD
+	request  interface{}
+}
+
+// callRecorder records the gRPC calls of a Firestore client and fails them, so no server is needed.
+type callRecorder struct {
+	mu    sync.Mutex
+	calls []recordedCall
+}
+
+func (r *callRecorder) record(ctx context.Context, method string, request interface{}) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, recordedCall{method: method, metadata: md, request: request})
+	// Permission errors are not retried by the SDK
+	return status.Error(codes.PermissionDenied, "recorded")
+}
+
+func (r *callRecorder) last() recordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.calls) == 0 {
+		return recordedCall{}
+	}
+	return r.calls[len(r.calls)-1]
+}
+
+func newRecordingClient(t *testing.T, recorder *callRecorder) *firestore.Client {
+	// The emulator connection would replace the recording one
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "")
+	conn, err := grpc.NewClient("localhost:1",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				return recorder.record(ctx, method, req)
+			}),
+		grpc.WithChainStreamInterceptor(
+			func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return nil, recorder.record(ctx, method, nil)
+			}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create gRPC connection: %v", err)
+	}
+	client, err := firestore.NewClient(context.Background(), "test-project", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("Failed to create Firestore client: %v", err)
+	}
+	return client
+}
+
+func TestCallOptions(t *testing.T) {
+	ctx := context.Background()
+	recorder := &callRecorder{}
+	client := newRecordingClient(t, recorder)
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	tuned := db.WithCallOptions(fireorm.CallOptions{
+		Metadata:           map[string]string{"x-tenant": "acme"},
+		TransactionOptions: []firestore.TransactionOption{firestore.ReadOnly},
+	})
+	assert.Equal(t, map[string]string{"x-tenant": "acme"}, tuned.GetCallOptions().Metadata)
+	assert.Empty(t, db.GetCallOptions().Metadata, "The base instance should be unchanged")
+
+	operations := map[string]func() error{
+		"GetByID":          func() error { return tuned.GetByID(ctx, &User{ID: "user1"}) },
+		"Save":             func() error { return tuned.Save(ctx, &User{ID: "user1", Name: "Ada"}) },
+		"FindAll":          func() error { return tuned.FindAll(ctx, nil, &[]User{}) },
+		"Delete":           func() error { return tuned.Delete(ctx, &User{ID: "user1"}) },
+		"GetByIDOrDefault": func() error { return tuned.GetByIDOrDefault(ctx, &User{ID: "user1"}, User{}) },
+	}
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, operation())
+			assert.Equal(t, []string{"acme"}, recorder.last().metadata.Get("x-tenant"),
+				"The metadata should be sent once with the call")
+		})
+	}
+
+	t.Run("Without Options", func(t *testing.T) {
+		assert.Error(t, db.GetByID(ctx, &User{ID: "user1"}))
+		assert.Empty(t, recorder.last().metadata.Get("x-tenant"))
+	})
+
+	t.Run("Transaction Options", func(t *testing.T) {
+		err := tuned.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			return nil
+		})
+		assert.Error(t, err)
+		call := recorder.last()
+		assert.Contains(t, call.method, "BeginTransaction")
+		request, ok := call.request.(*firestorepb.BeginTransactionRequest)
+		if assert.True(t, ok) {
+			assert.NotNil(t, request.GetOptions().GetReadOnly(), "The transaction should be read-only")
+		}
+		assert.Equal(t, []string{"acme"}, call.metadata.Get("x-tenant"))
+	})
+}
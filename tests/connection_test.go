@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRootCollections(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	connection := fireorm.NewConnection(client)
+	db := fireorm.New(connection)
+	err := db.Model(&User{}).Save(ctx, &User{Name: "Root"})
+	assert.NoError(t, err)
+	err = db.Model(&Article{}).Save(ctx, &Article{Title: "Root"})
+	assert.NoError(t, err)
+
+	names, err := connection.ListRootCollections(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, names, "users")
+	assert.Contains(t, names, "articles")
+}
+
+func TestListRootCollectionsWithoutClient(t *testing.T) {
+	_, err := fireorm.NewConnection(nil).ListRootCollections(context.Background())
+	assert.Error(t, err)
+}
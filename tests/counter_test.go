@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedCounter(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	articles := fireorm.New(fireorm.NewConnection(client)).Model(&Article{})
+	total, err := articles.CountShards(ctx, "views", 5)
+	assert.NoError(t, err)
+	assert.Zero(t, total, "A counter without increments should be 0")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, articles.IncrementSharded(ctx, "views", 5, 3))
+		}()
+	}
+	wg.Wait()
+	err = articles.IncrementSharded(ctx, "views", 5, -10)
+	assert.NoError(t, err)
+
+	total, err = articles.CountShards(ctx, "views", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), total)
+	shards, err := client.Collection("articles").Doc("views").Collection("shards").Documents(ctx).GetAll()
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(shards), 5)
+	assert.Greater(t, len(shards), 1, "Increments should be spread across shards")
+}
+
+func TestShardedCounterValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil))
+	articles := db.Model(&Article{})
+
+	assert.Error(t, articles.IncrementSharded(ctx, "", 5, 1))
+	assert.Error(t, articles.IncrementSharded(ctx, "a/b", 5, 1))
+	assert.Error(t, articles.IncrementSharded(ctx, "views", 0, 1))
+	_, err := articles.CountShards(ctx, "views", -1)
+	assert.Error(t, err)
+	_, err = db.CountShards(ctx, "views", 5)
+	assert.Error(t, err, "A model is required")
+	assert.ErrorIs(t, articles.WithReadOnly().IncrementSharded(ctx, "views", 5, 1), fireorm.ErrReadOnly)
+}
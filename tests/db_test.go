@@ -1,18 +1,25 @@
 package tests
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/smarter-day/fireorm"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type User struct {
@@ -22,6 +29,202 @@ type User struct {
 	Age   int    `firestore:"age"`
 }
 
+type Article struct {
+	ID    string   `firestore:"-"`
+	Title string   `firestore:"title"`
+	Tags  []string `firestore:"tags"`
+}
+
+type Profile struct {
+	ID          string `firestore:"-"`
+	First       string `firestore:"first"`
+	Last        string `firestore:"last"`
+	DisplayName string `firestore:"-"`
+}
+
+func (p *Profile) AfterLoad(ctx context.Context) error {
+	if p.First == "" {
+		return errors.New("first name is required")
+	}
+	p.DisplayName = p.First + " " + p.Last
+	return nil
+}
+
+type Membership struct {
+	ID       string `firestore:"-"`
+	Tenant   string `firestore:"tenant"`
+	Resource string `firestore:"resource"`
+	Role     string `firestore:"role"`
+}
+
+func (m *Membership) CompositeID() (string, error) {
+	if m.Tenant == "" || m.Resource == "" {
+		return "", errors.New("tenant and resource are required")
+	}
+	return m.Tenant + ":" + m.Resource, nil
+}
+
+type Shape struct {
+	ID   string `firestore:"-"`
+	Type string `firestore:"type"`
+}
+
+type Circle struct {
+	ID     string  `firestore:"-"`
+	Type   string  `firestore:"type"`
+	Radius float64 `firestore:"radius"`
+}
+
+func (Circle) CollectionName() string {
+	return "shapes"
+}
+
+type Square struct {
+	ID   string  `firestore:"-"`
+	Type string  `firestore:"type"`
+	Side float64 `firestore:"side"`
+}
+
+func (Square) CollectionName() string {
+	return "shapes"
+}
+
+type UserName struct {
+	ID   string `firestore:"-"`
+	Name string `firestore:"name"`
+	Age  int
+}
+
+type CatalogTags struct {
+	Items []string `firestore:"items"`
+}
+
+type Catalog struct {
+	ID     string              `firestore:"-"`
+	Name   string              `firestore:"name"`
+	Tags   CatalogTags         `firestore:"tags"`
+	Labels map[string][]string `firestore:"labels"`
+}
+
+// Customer is at schema version 2, which replaced the first and last names of version 1 with FullName.
+type Customer struct {
+	ID       string `firestore:"-"`
+	FullName string `firestore:"fullName"`
+}
+
+func (c *Customer) SchemaVersion() int {
+	return 2
+}
+
+func (c *Customer) Upgrade(fromVersion int, data map[string]interface{}) (map[string]interface{}, error) {
+	if fromVersion < 2 {
+		first, _ := data["first"].(string)
+		last, _ := data["last"].(string)
+		data["fullName"] = first + " " + last
+	}
+	return data, nil
+}
+
+// Account keeps its balance and tier unexported, set on read through SetField.
+type Account struct {
+	ID      string `firestore:"-"`
+	Owner   string `firestore:"owner"`
+	balance int64
+	tier    string
+}
+
+func (a *Account) SetField(name string, value interface{}) error {
+	switch name {
+	case "balance":
+		balance, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("balance must be an integer, got %T", value)
+		}
+		a.balance = balance
+	case "tier":
+		tier, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("tier must be a string, got %T", value)
+		}
+		a.tier = tier
+	default:
+		return fmt.Errorf("unknown field %s", name)
+	}
+	return nil
+}
+
+// Subscription defaults its status to active on save.
+type Subscription struct {
+	ID     string `firestore:"-"`
+	Plan   string `firestore:"plan"`
+	Status string `firestore:"status,omitempty"`
+}
+
+func (s *Subscription) ApplyDefaults() {
+	if s.Status == "" {
+		s.Status = "active"
+	}
+}
+
+type Note struct {
+	DocID string `firestore:"-" fireorm:"id"`
+	Text  string `firestore:"text"`
+}
+
+// LatestArticle reads articles ordered by descending title unless queried with another order.
+type LatestArticle struct {
+	ID    string   `firestore:"-"`
+	Title string   `firestore:"title"`
+	Tags  []string `firestore:"tags"`
+}
+
+func (LatestArticle) CollectionName() string {
+	return "articles"
+}
+
+func (LatestArticle) DefaultOrderBy() []fireorm.OrderClause {
+	return []fireorm.OrderClause{{Field: "title", Direction: firestore.Desc}}
+}
+
+// UserPath reads users with their document path.
+type UserPath struct {
+	ID    string `firestore:"-"`
+	Path  string `firestore:"-" fireorm:"path"`
+	Email string `firestore:"email"`
+}
+
+func (UserPath) CollectionName() string {
+	return "users"
+}
+
+// Comment is stored in the "comments" subcollection of the post it references.
+type Comment struct {
+	ID   string                 `firestore:"-"`
+	Path string                 `firestore:"-" fireorm:"path"`
+	Post *firestore.DocumentRef `firestore:"post"`
+	Text string                 `firestore:"text"`
+}
+
+// Bookmark decodes its documents itself and records that it did.
+type Bookmark struct {
+	ID      string `firestore:"-"`
+	URL     string `firestore:"url"`
+	Visits  int    `firestore:"visits"`
+	Decoded bool   `firestore:"-"`
+}
+
+func (b *Bookmark) DecodeFirestore(data map[string]interface{}) error {
+	url, ok := data["url"].(string)
+	if !ok {
+		return fmt.Errorf("url must be a string, got %T", data["url"])
+	}
+	visits, _ := data["visits"].(int64)
+	b.URL = url
+	b.Visits = int(visits)
+	b.Decoded = true
+	return nil
+}
+
 func startFirestoreEmulator() *exec.Cmd {
 	cmd := exec.Command("firebase", "emulators:start", "--only", "firestore")
 	cmd.Stdout = os.Stdout
@@ -53,7 +256,7 @@ func createFirestoreClient() *firestore.Client {
 }
 
 func resetFirestoreEmulator(ctx context.Context, client *firestore.Client) {
-	collections := []string{"users"}
+	collections := []string{"users", "articles", "contacts", "profiles", "memberships", "shapes", "events", "notes", "archived_users", "patients", "catalogs", "tickets", "customers", "posts/post-1/comments", "posts/post-2/comments", "bookmarks", "articles_v2", "articles/views/shards", "registered_items", "drafts", "jobs", "settings", "leaderboards", "books", "accounts", "_idempotency_keys", "ingested_keys", "subscriptions", "subscribers", "orders", "orders/order-1/lineItems", "reports", "outbox", "articles/article-sub/views", "dev_articles", "dev_archive"}
 	for _, collection := range collections {
 		iter := client.Collection(collection).Documents(ctx)
 		for {
@@ -207,6 +410,25 @@ func TestFireORM(t *testing.T) {
 		assert.NoError(t, err, "Deleting a non-existent document should not cause an error")
 	})
 
+	t.Run("Delete Strict", func(t *testing.T) {
+		err := db.DeleteStrict(ctx, &User{ID: "non-existent-id"})
+		assert.ErrorIs(t, err, fireorm.ErrNotFound, "Strict deletes should report missing documents")
+		assert.True(t, fireorm.IsNotFoundError(err))
+
+		user := &User{Name: "Strictly Deleted"}
+		err = db.Save(ctx, user)
+		assert.NoError(t, err)
+		err = db.DeleteStrict(ctx, user)
+		assert.NoError(t, err)
+		err = db.GetByID(ctx, &User{ID: user.ID})
+		assert.True(t, fireorm.IsNotFoundError(err), "The document should be deleted")
+
+		err = db.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			return tx.DeleteStrict(ctx, &User{ID: user.ID})
+		})
+		assert.ErrorIs(t, err, fireorm.ErrNotFound, "Strict deletes in a transaction should report missing documents")
+	})
+
 	t.Run("Query with No Results", func(t *testing.T) {
 		query := []fireorm.Query{
 			{
@@ -311,15 +533,1694 @@ func TestFireORM(t *testing.T) {
 		assert.Empty(t, updatedUsers, "No users should have age 20 after the update")
 	})
 
-	t.Run("Field Collision", func(t *testing.T) {
-		user := &User{Name: "Field Collision", Email: "collision@example.com", Age: 99}
+	t.Run("FindAllIndexedBy Email", func(t *testing.T) {
+		users := []User{
+			{Name: "Indexed One", Email: "indexed1@example.com", Age: 71},
+			{Name: "Indexed Two", Email: "indexed2@example.com", Age: 71},
+		}
+		for _, user := range users {
+			err := db.Save(ctx, &user)
+			assert.NoError(t, err)
+		}
+
+		query := []fireorm.Query{
+			{
+				Where: []fireorm.WhereClause{
+					{Field: "age", Operator: "==", Value: 71},
+				},
+			},
+		}
+		byEmail := map[string]User{}
+		err := db.FindAllIndexedBy(ctx, "email", query, &byEmail)
+		assert.NoError(t, err)
+		assert.Len(t, byEmail, 2)
+		assert.Equal(t, "Indexed One", byEmail["indexed1@example.com"].Name)
+		assert.Equal(t, "Indexed Two", byEmail["indexed2@example.com"].Name)
+		assert.NotEmpty(t, byEmail["indexed1@example.com"].ID)
+
+		byAge := map[interface{}]User{}
+		err = db.WithDuplicateKeyPolicy(fireorm.DuplicateKeyError).FindAllIndexedBy(ctx, "Age", query, &byAge)
+		assert.Error(t, err, "Expected an error for duplicate keys")
+
+		byAge = map[interface{}]User{}
+		err = db.FindAllIndexedBy(ctx, "Age", query, &byAge)
+		assert.NoError(t, err)
+		assert.Len(t, byAge, 1, "Last document should win for duplicate keys")
+
+		byAgeString := map[string]User{}
+		err = db.FindAllIndexedBy(ctx, "age", query, &byAgeString)
+		assert.Error(t, err, "Integer keys must not be converted to strings as runes")
+		assert.Empty(t, byAgeString)
+	})
+
+	t.Run("FindAllIndexedBy Unhashable Key", func(t *testing.T) {
+		articles := fireorm.New(connection).Model(&Article{})
+		err := articles.Save(ctx, &Article{Title: "Unhashable", Tags: []string{"go"}})
+		assert.NoError(t, err)
+
+		query := []fireorm.Query{
+			{
+				Where: []fireorm.WhereClause{
+					{Field: "title", Operator: "==", Value: "Unhashable"},
+				},
+			},
+		}
+		byTags := map[interface{}]Article{}
+		assert.NotPanics(t, func() {
+			err = articles.FindAllIndexedBy(ctx, "tags", query, &byTags)
+		})
+		assert.ErrorContains(t, err, "not comparable")
+	})
+
+	t.Run("Array Append and Remove", func(t *testing.T) {
+		articles := fireorm.New(connection).Model(&Article{})
+		article := &Article{Title: "Arrays", Tags: []string{"go"}}
+		err := articles.Save(ctx, article)
+		assert.NoError(t, err)
+
+		err = articles.ArrayAppend(ctx, article, "tags", "firestore", "orm", "go")
+		assert.NoError(t, err)
+
+		retrieved := &Article{ID: article.ID}
+		err = articles.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"go", "firestore", "orm"}, retrieved.Tags)
+
+		err = articles.ArrayRemove(ctx, article, "tags", "go", "orm")
+		assert.NoError(t, err)
+
+		retrieved = &Article{ID: article.ID}
+		err = articles.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"firestore"}, retrieved.Tags)
+
+		err = articles.ArrayAppend(ctx, &Article{}, "tags", "go")
+		assert.Error(t, err, "Expected an error for a model without ID")
+	})
+
+	t.Run("Raw Query", func(t *testing.T) {
+		users := []User{
+			{Name: "Raw A", Email: "raw.a@example.com", Age: 81},
+			{Name: "Raw B", Email: "raw.b@example.com", Age: 82},
+			{Name: "Raw C", Email: "raw.c@example.com", Age: 83},
+		}
+		for _, user := range users {
+			err := db.Save(ctx, &user)
+			assert.NoError(t, err)
+		}
+
+		q, err := db.RawQuery(ctx)
+		assert.NoError(t, err)
+
+		q, err = db.ApplyQueries(ctx, q, []fireorm.Query{
+			{
+				Where: []fireorm.WhereClause{
+					{Field: "age", Operator: ">", Value: 80},
+				},
+			},
+		})
+		assert.NoError(t, err)
+
+		docs, err := q.OrderBy("age", firestore.Desc).Select("name").Limit(2).Documents(ctx).GetAll()
+		assert.NoError(t, err)
+		assert.Len(t, docs, 2)
+		assert.Equal(t, "Raw C", docs[0].Data()["name"])
+		assert.Equal(t, "Raw B", docs[1].Data()["name"])
+		_, hasEmail := docs[0].Data()["email"]
+		assert.False(t, hasEmail, "Select should only return projected fields")
+	})
+
+	t.Run("Map of Structs Round Trip", func(t *testing.T) {
+		contacts := fireorm.New(connection).Model(&Contact{})
+		contact := &Contact{
+			Name: "Round Trip",
+			Addresses: map[string]Address{
+				"home": {Street: "1 Main St", City: "Springfield"},
+			},
+		}
+		err := contacts.Save(ctx, contact)
+		assert.NoError(t, err)
+
+		retrieved := &Contact{ID: contact.ID}
+		err = contacts.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, contact.Addresses, retrieved.Addresses)
+	})
+
+	t.Run("Save If Newer", func(t *testing.T) {
+		user := &User{Name: "Versioned", Email: "versioned@example.com", Age: 5}
 		err := db.Save(ctx, user)
 		assert.NoError(t, err)
 
+		older := &User{ID: user.ID, Name: "Older Event", Email: "versioned@example.com", Age: 4}
+		err = db.SaveIfNewer(ctx, older, "age")
+		assert.NoError(t, err)
+
 		retrieved := &User{ID: user.ID}
 		err = db.GetByID(ctx, retrieved)
 		assert.NoError(t, err)
-		assert.Equal(t, user.Name, retrieved.Name)
-		assert.Equal(t, user.Email, retrieved.Email)
+		assert.Equal(t, "Versioned", retrieved.Name, "Older event should be ignored")
+
+		same := &User{ID: user.ID, Name: "Same Event", Email: "versioned@example.com", Age: 5}
+		err = db.SaveIfNewer(ctx, same, "Age")
+		assert.NoError(t, err)
+
+		retrieved = &User{ID: user.ID}
+		err = db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "Versioned", retrieved.Name, "Equal event should be ignored")
+
+		newer := &User{ID: user.ID, Name: "Newer Event", Email: "versioned@example.com", Age: 6}
+		err = db.SaveIfNewer(ctx, newer, "age")
+		assert.NoError(t, err)
+
+		retrieved = &User{ID: user.ID}
+		err = db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "Newer Event", retrieved.Name)
+		assert.Equal(t, 6, retrieved.Age)
+
+		missing := &User{ID: "save-if-newer-missing", Name: "First Event", Age: 1}
+		err = db.SaveIfNewer(ctx, missing, "age")
+		assert.NoError(t, err)
+
+		retrieved = &User{ID: missing.ID}
+		err = db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "First Event", retrieved.Name)
+	})
+
+	t.Run("List Subcollections", func(t *testing.T) {
+		user := &User{Name: "Parent", Email: "parent@example.com"}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		docRef, err := db.DocRef(user)
+		assert.NoError(t, err)
+		_, err = docRef.Collection("orders").Doc("o1").Set(ctx, map[string]interface{}{"total": 10})
+		assert.NoError(t, err)
+		_, err = docRef.Collection("invoices").Doc("i1").Set(ctx, map[string]interface{}{"total": 20})
+		assert.NoError(t, err)
+
+		names, err := db.ListSubcollections(ctx, user)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"orders", "invoices"}, names)
+
+		_, err = db.ListSubcollections(ctx, &User{})
+		assert.Error(t, err, "Expected an error for a model without ID")
+	})
+
+	t.Run("Transactional Update by Query", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			user := &User{Name: fmt.Sprintf("Tx Bulk %d", i), Email: fmt.Sprintf("txbulk%d@example.com", i), Age: 91}
+			err := db.Save(ctx, user)
+			assert.NoError(t, err)
+		}
+
+		query := []fireorm.Query{
+			{
+				Where: []fireorm.WhereClause{
+					{Field: "age", Operator: "==", Value: 91},
+				},
+			},
+		}
+		err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			updates := []firestore.Update{
+				{Path: "age", Value: 92},
+			}
+			return db.WithTransaction(tx).Update(ctx, &User{}, updates, query)
+		})
+		assert.NoError(t, err)
+
+		var remaining []User
+		err = db.FindAll(ctx, query, &remaining)
+		assert.NoError(t, err)
+		assert.Empty(t, remaining)
+
+		var updated []User
+		err = db.FindAll(ctx, []fireorm.Query{
+			{
+				Where: []fireorm.WhereClause{
+					{Field: "age", Operator: "==", Value: 92},
+				},
+			},
+		}, &updated)
+		assert.NoError(t, err)
+		assert.Len(t, updated, 3)
+	})
+
+	t.Run("Update by Query Keeps Caller Limit", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			user := &User{Name: fmt.Sprintf("Limited %d", i), Email: fmt.Sprintf("limited%d@example.com", i), Age: 93}
+			err := db.Save(ctx, user)
+			assert.NoError(t, err)
+		}
+
+		query := []fireorm.Query{
+			{
+				Where: []fireorm.WhereClause{
+					{Field: "age", Operator: "==", Value: 93},
+				},
+				Limit: 2,
+			},
+		}
+		err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			return db.WithTransaction(tx).Update(ctx, &User{}, []firestore.Update{{Path: "age", Value: 94}}, query)
+		})
+		assert.NoError(t, err)
+
+		var updated []User
+		err = db.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "age", Operator: "==", Value: 94}}},
+		}, &updated)
+		assert.NoError(t, err)
+		assert.Len(t, updated, 2, "Only the caller's limit of documents should be updated in a transaction")
+
+		err = db.SetUpdateBatchSize(1).Update(ctx, &User{}, []firestore.Update{{Path: "age", Value: 95}}, query)
+		assert.NoError(t, err)
+
+		updated = nil
+		err = db.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "age", Operator: "==", Value: 95}}},
+		}, &updated)
+		assert.NoError(t, err)
+		assert.Len(t, updated, 2, "Batched updates should also stop at the caller's limit")
+	})
+
+	t.Run("Prefix Search", func(t *testing.T) {
+		names := []string{"Prefixa Alpha", "Prefixa Beta", "Prefixb Gamma", "Prefix"}
+		for _, name := range names {
+			err := db.Save(ctx, &User{Name: name, Email: "prefix@example.com"})
+			assert.NoError(t, err)
+		}
+
+		var results []User
+		err := db.FindAll(ctx, []fireorm.Query{
+			{Where: fireorm.PrefixWhere("name", "Prefixa")},
+		}, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		for _, user := range results {
+			assert.Contains(t, []string{"Prefixa Alpha", "Prefixa Beta"}, user.Name)
+		}
+	})
+
+	t.Run("FindAllJSON", func(t *testing.T) {
+		user := &User{Name: "JSON User", Email: "json@example.com", Age: 64}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		query := []fireorm.Query{
+			{
+				Where: []fireorm.WhereClause{
+					{Field: "email", Operator: "==", Value: "json@example.com"},
+				},
+			},
+		}
+		data, err := db.FindAllJSON(ctx, query)
+		assert.NoError(t, err)
+
+		var items []map[string]interface{}
+		err = json.Unmarshal(data, &items)
+		assert.NoError(t, err)
+		assert.Len(t, items, 1)
+		assert.Equal(t, user.ID, items[0]["id"])
+		assert.Equal(t, "JSON User", items[0]["name"])
+		assert.Equal(t, float64(64), items[0]["age"])
+
+		data, err = db.WithJSONIDKey("_id").FindAllJSON(ctx, query)
+		assert.NoError(t, err)
+		items = nil
+		err = json.Unmarshal(data, &items)
+		assert.NoError(t, err)
+		assert.Len(t, items, 1)
+		assert.Equal(t, user.ID, items[0]["_id"])
+		assert.NotContains(t, items[0], "id")
 	})
+
+	t.Run("AfterLoad Hook", func(t *testing.T) {
+		profiles := fireorm.New(connection).Model(&Profile{})
+		profile := &Profile{First: "Ada", Last: "Lovelace"}
+		err := profiles.Save(ctx, profile)
+		assert.NoError(t, err)
+
+		retrieved := &Profile{ID: profile.ID}
+		err = profiles.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "Ada Lovelace", retrieved.DisplayName)
+
+		found := &Profile{}
+		err = profiles.FindOne(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "first", Operator: "==", Value: "Ada"}}},
+		}, found)
+		assert.NoError(t, err)
+		assert.Equal(t, "Ada Lovelace", found.DisplayName)
+
+		var all []Profile
+		err = profiles.FindAll(ctx, nil, &all)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, all)
+		for _, p := range all {
+			assert.Equal(t, p.First+" "+p.Last, p.DisplayName)
+		}
+
+		invalid := &Profile{Last: "Nameless"}
+		err = profiles.Save(ctx, invalid)
+		assert.NoError(t, err)
+
+		err = profiles.GetByID(ctx, &Profile{ID: invalid.ID})
+		assert.Error(t, err, "AfterLoad errors should fail the load")
+
+		err = profiles.Delete(ctx, invalid)
+		assert.NoError(t, err)
+	})
+
+	t.Run("FindAllExplain", func(t *testing.T) {
+		user := &User{Name: "Explained", Email: "explain@example.com", Age: 55}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		var results []User
+		metrics, err := db.FindAllExplain(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "explain@example.com"}}},
+		}, &results)
+		if err != nil && status.Code(err) == codes.Unimplemented {
+			t.Skip("Query explain is not supported by the emulator")
+		}
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, user.ID, results[0].ID)
+		if len(metrics.IndexesUsed) == 0 && metrics.ResultsReturned == 0 {
+			t.Skip("Query explain metrics are not reported by the emulator")
+		}
+		assert.NotEmpty(t, metrics.IndexesUsed)
+		assert.Equal(t, int64(1), metrics.ResultsReturned)
+	})
+
+	t.Run("Nil Slice Modes", func(t *testing.T) {
+		articles := fireorm.New(connection).Model(&Article{})
+
+		omitted := &Article{Title: "Nil Slice Omitted"}
+		err := articles.WithNilSliceMode(fireorm.NilSliceOmit).Save(ctx, omitted)
+		assert.NoError(t, err)
+		empty := &Article{Title: "Nil Slice Empty"}
+		err = articles.WithNilSliceMode(fireorm.NilSliceAsEmpty).Save(ctx, empty)
+		assert.NoError(t, err)
+		null := &Article{Title: "Nil Slice Null"}
+		err = articles.Save(ctx, null)
+		assert.NoError(t, err)
+
+		var withEmptyTags []Article
+		err = articles.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "tags", Operator: "==", Value: []string{}}}},
+		}, &withEmptyTags)
+		assert.NoError(t, err)
+		assert.Len(t, withEmptyTags, 1)
+		assert.Equal(t, empty.ID, withEmptyTags[0].ID)
+
+		var withNullTags []Article
+		err = articles.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "tags", Operator: "==", Value: nil}}},
+		}, &withNullTags)
+		assert.NoError(t, err)
+		assert.Len(t, withNullTags, 1)
+		assert.Equal(t, null.ID, withNullTags[0].ID)
+
+		err = articles.WithNilSliceMode(fireorm.NilSliceOmit).Save(ctx, &Article{ID: empty.ID}, "tags")
+		assert.NoError(t, err, "Listed nil slices should be written even in NilSliceOmit mode")
+		raw, err := articles.GetByIDWithRaw(ctx, &Article{ID: empty.ID})
+		assert.NoError(t, err)
+		assert.Contains(t, raw, "tags")
+		assert.Nil(t, raw["tags"])
+	})
+
+	t.Run("GetByID With Raw", func(t *testing.T) {
+		user := &User{Name: "Raw Reader", Email: "raw.reader@example.com", Age: 44}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		retrieved := &User{ID: user.ID}
+		raw, err := db.GetByIDWithRaw(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "Raw Reader", retrieved.Name)
+		assert.Equal(t, retrieved.Name, raw["name"])
+		assert.Equal(t, retrieved.Email, raw["email"])
+		assert.Equal(t, int64(retrieved.Age), raw["age"])
+
+		err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			inTx := &User{ID: user.ID}
+			raw, err := db.WithTransaction(tx).GetByIDWithRaw(ctx, inTx)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, "Raw Reader", inTx.Name)
+			assert.Equal(t, inTx.Name, raw["name"])
+			return nil
+		})
+		assert.NoError(t, err)
+
+		_, err = db.GetByIDWithRaw(ctx, &User{ID: "raw-missing-id"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Composite ID", func(t *testing.T) {
+		memberships := fireorm.New(connection).Model(&Membership{})
+		membership := &Membership{Tenant: "acme", Resource: "billing", Role: "admin"}
+		err := memberships.Save(ctx, membership)
+		assert.NoError(t, err)
+		assert.Equal(t, "acme:billing", membership.ID)
+
+		retrieved := &Membership{Tenant: "acme", Resource: "billing"}
+		err = memberships.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "admin", retrieved.Role)
+		assert.Equal(t, "acme:billing", retrieved.ID)
+
+		err = memberships.Delete(ctx, &Membership{Tenant: "acme", Resource: "billing"})
+		assert.NoError(t, err)
+
+		err = memberships.GetByID(ctx, &Membership{Tenant: "acme", Resource: "billing"})
+		assert.Error(t, err, "Expected an error for a deleted document")
+
+		err = memberships.Save(ctx, &Membership{Tenant: "acme"})
+		assert.Error(t, err, "Expected an error for an incomplete composite ID")
+	})
+
+	t.Run("Polymorphic FindAll", func(t *testing.T) {
+		shapes := fireorm.New(connection).Model(&Shape{})
+		circle := &Circle{Type: "circle", Radius: 2}
+		err := shapes.Save(ctx, circle)
+		assert.NoError(t, err)
+		square := &Square{Type: "square", Side: 3}
+		err = shapes.Save(ctx, square)
+		assert.NoError(t, err)
+
+		factory := func(typeName string) interface{} {
+			switch typeName {
+			case "circle":
+				return &Circle{}
+			case "square":
+				return &Square{}
+			}
+			return nil
+		}
+
+		var results []interface{}
+		err = shapes.FindAllPoly(ctx, nil, "type", factory, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		for _, result := range results {
+			switch shape := result.(type) {
+			case *Circle:
+				assert.Equal(t, circle.ID, shape.ID)
+				assert.Equal(t, 2.0, shape.Radius)
+			case *Square:
+				assert.Equal(t, square.ID, shape.ID)
+				assert.Equal(t, 3.0, shape.Side)
+			default:
+				t.Errorf("unexpected result type %T", result)
+			}
+		}
+
+		results = nil
+		err = shapes.FindAllPoly(ctx, nil, "type", func(string) interface{} { return nil }, &results)
+		assert.Error(t, err, "Expected an error for unknown types")
+	})
+
+	t.Run("Server Timestamps", func(t *testing.T) {
+		events := fireorm.New(connection).Model(&Event{})
+		event := &Event{Name: "Created"}
+		err := events.Save(ctx, event)
+		assert.NoError(t, err)
+
+		retrieved := &Event{ID: event.ID}
+		err = events.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.False(t, retrieved.CreatedAt.IsZero(), "Server timestamp should be resolved after the write")
+		assert.Empty(t, fireorm.PendingServerTimestamps(retrieved))
+
+		_, err = client.Collection("events").Doc("pending-timestamp").Set(ctx, map[string]interface{}{
+			"name":      "Pending",
+			"createdAt": nil,
+		})
+		assert.NoError(t, err)
+
+		pending := &Event{ID: "pending-timestamp"}
+		err = events.GetByID(ctx, pending)
+		assert.NoError(t, err, "Unresolved server timestamps should not fail the decode")
+		assert.True(t, pending.CreatedAt.IsZero())
+		assert.Equal(t, []string{"CreatedAt"}, fireorm.PendingServerTimestamps(pending))
+	})
+
+	t.Run("Partial Save Clears Omitempty Field", func(t *testing.T) {
+		events := fireorm.New(connection).Model(&Event{})
+		event := &Event{Name: "Named"}
+		err := events.Save(ctx, event)
+		assert.NoError(t, err)
+
+		err = events.Save(ctx, &Event{ID: event.ID}, "name")
+		assert.NoError(t, err, "Listed omitempty fields should be written even when zero")
+
+		raw, err := events.GetByIDWithRaw(ctx, &Event{ID: event.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, "", raw["name"])
+	})
+
+	t.Run("Update Max and Min", func(t *testing.T) {
+		user := &User{Name: "High Water", Email: "highwater@example.com", Age: 5}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		for _, value := range []int{3, 8, 6} {
+			err = db.UpdateMax(ctx, &User{ID: user.ID}, "age", value)
+			assert.NoError(t, err)
+		}
+		retrieved := &User{ID: user.ID}
+		err = db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, 8, retrieved.Age, "Maximum should only ever increase")
+
+		for _, value := range []int{9, 2, 4} {
+			err = db.UpdateMin(ctx, &User{ID: user.ID}, "age", value)
+			assert.NoError(t, err)
+		}
+		retrieved = &User{ID: user.ID}
+		err = db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, retrieved.Age, "Minimum should only ever decrease")
+
+		err = db.UpdateMax(ctx, &User{}, "age", 1)
+		assert.Error(t, err, "Expected an error for a model without ID")
+	})
+
+	t.Run("Multiple Query Entries Are ANDed", func(t *testing.T) {
+		users := []User{
+			{Name: "And Match", Email: "and@example.com", Age: 61},
+			{Name: "And Wrong Age", Email: "and@example.com", Age: 62},
+			{Name: "And Wrong Email", Email: "and.other@example.com", Age: 61},
+		}
+		for _, user := range users {
+			err := db.Save(ctx, &user)
+			assert.NoError(t, err)
+		}
+
+		var results []User
+		err := db.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "and@example.com"}}},
+			{Where: []fireorm.WhereClause{{Field: "age", Operator: "==", Value: 61}}},
+		}, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "And Match", results[0].Name)
+	})
+
+	t.Run("Eventual Consistency", func(t *testing.T) {
+		user := &User{Name: "Fresh", Email: "fresh@example.com"}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		err = db.GetByID(ctx, &User{ID: user.ID})
+		assert.NoError(t, err, "Strong reads see the latest write")
+
+		err = db.WithConsistency(fireorm.ConsistencyEventual).GetByID(ctx, &User{ID: user.ID})
+		if err == nil {
+			t.Skip("Read times are not supported by the emulator")
+		}
+		assert.True(t, fireorm.IsNotFoundError(err), "Stale reads should not see a document created just now")
+	})
+
+	t.Run("Cursor Pagination With Ties", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			user := &User{Name: fmt.Sprintf("Tied %d", i), Email: "tied@example.com", Age: 33}
+			err := db.Save(ctx, user)
+			assert.NoError(t, err)
+		}
+
+		seen := map[string]bool{}
+		var cursor []interface{}
+		for page := 0; page < 5; page++ {
+			query := fireorm.Query{
+				Where:      []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "tied@example.com"}},
+				OrderBy:    []fireorm.OrderClause{{Field: "age", Direction: firestore.Asc}},
+				Limit:      2,
+				StartAfter: cursor,
+			}
+			var results []User
+			err := db.FindAll(ctx, []fireorm.Query{query}, &results)
+			assert.NoError(t, err)
+			if len(results) == 0 {
+				break
+			}
+			for _, user := range results {
+				assert.False(t, seen[user.ID], "Document %s returned twice", user.ID)
+				seen[user.ID] = true
+			}
+			last := results[len(results)-1]
+			cursor = []interface{}{last.Age, last.ID}
+		}
+		assert.Len(t, seen, 5, "Every tied document should be returned exactly once")
+	})
+
+	t.Run("Find Page", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			err := db.Save(ctx, &User{Name: fmt.Sprintf("Paged %d", i), Email: "paged@example.com", Age: i})
+			assert.NoError(t, err)
+		}
+		paged := fireorm.Query{
+			Where:   []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "paged@example.com"}},
+			OrderBy: []fireorm.OrderClause{{Field: "age", Direction: firestore.Asc}},
+		}
+
+		var page []User
+		hasMore, lastDoc, err := db.FindPage(ctx, []fireorm.Query{paged}, 3, &page)
+		assert.NoError(t, err)
+		assert.True(t, hasMore, "A following page should be reported")
+		assert.Len(t, page, 3)
+		assert.Equal(t, page[2].ID, lastDoc.Ref.ID)
+
+		next := paged
+		next.StartAfter = []interface{}{lastDoc}
+		var nextPage []User
+		hasMore, lastDoc, err = db.FindPage(ctx, []fireorm.Query{next}, 3, &nextPage)
+		assert.NoError(t, err)
+		assert.False(t, hasMore, "The last page should not report more results")
+		assert.Len(t, nextPage, 2)
+		assert.Equal(t, 4, nextPage[1].Age)
+		assert.Equal(t, nextPage[1].ID, lastDoc.Ref.ID)
+
+		var exact []User
+		hasMore, _, err = db.FindPage(ctx, []fireorm.Query{paged}, 5, &exact)
+		assert.NoError(t, err)
+		assert.False(t, hasMore, "A page holding exactly the remaining results has no following page")
+		assert.Len(t, exact, 5)
+
+		_, _, err = db.FindPage(ctx, []fireorm.Query{paged}, 0, &exact)
+		assert.Error(t, err)
+	})
+
+	t.Run("Custom ID Generator", func(t *testing.T) {
+		sortable := db.WithIDGenerator(fireorm.ULIDGenerator())
+		first := &User{Name: "First Sortable", Email: "sortable1@example.com"}
+		err := sortable.Save(ctx, first)
+		assert.NoError(t, err)
+		second := &User{Name: "Second Sortable", Email: "sortable2@example.com"}
+		err = sortable.Save(ctx, second)
+		assert.NoError(t, err)
+		assert.Len(t, first.ID, 26)
+		assert.Greater(t, second.ID, first.ID, "ULIDs should sort in creation order")
+
+		retrieved := &User{ID: second.ID}
+		err = db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "Second Sortable", retrieved.Name)
+
+		ids, err := db.WithIDGenerator(fireorm.UUIDGenerator()).SaveAll(ctx, []*User{{Name: "UUID User"}})
+		assert.NoError(t, err)
+		assert.Len(t, ids[0], 36)
+	})
+
+	t.Run("Read Only Mode", func(t *testing.T) {
+		user := &User{Name: "Migrating", Email: "migrating@example.com", Age: 50}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		readOnly := db.WithReadOnly()
+		err = readOnly.Save(ctx, &User{ID: user.ID, Name: "Blocked"})
+		assert.ErrorIs(t, err, fireorm.ErrReadOnly)
+
+		retrieved := &User{ID: user.ID}
+		err = readOnly.GetByID(ctx, retrieved)
+		assert.NoError(t, err, "Reads should keep working in read-only mode")
+		assert.Equal(t, "Migrating", retrieved.Name)
+
+		var results []User
+		err = readOnly.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "migrating@example.com"}}},
+		}, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("Time Truncation Round Trip", func(t *testing.T) {
+		events := fireorm.New(connection).Model(&Event{}).WithTimeTruncation(true)
+		createdAt := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+		event := &Event{Name: "Precise", CreatedAt: createdAt}
+		err := events.Save(ctx, event)
+		assert.NoError(t, err)
+
+		retrieved := &Event{ID: event.ID}
+		err = events.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.True(t, createdAt.Truncate(time.Microsecond).Equal(retrieved.CreatedAt),
+			"The stored time should equal the input truncated to microseconds")
+	})
+
+	t.Run("Tagged ID Field", func(t *testing.T) {
+		notes := fireorm.New(connection).Model(&Note{})
+		note := &Note{Text: "Tagged"}
+		err := notes.Save(ctx, note)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, note.DocID, "The generated ID should be stored in the tagged field")
+
+		retrieved := &Note{DocID: note.DocID}
+		err = notes.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "Tagged", retrieved.Text)
+
+		var results []Note
+		err = notes.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "text", Operator: "==", Value: "Tagged"}}},
+		}, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, note.DocID, results[0].DocID, "FindAll should populate the tagged ID field")
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		user := &User{Name: "Pending", Email: "pending@example.com", Age: 21}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		newID, err := db.Move(ctx, user, "archived_users")
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, newID)
+
+		err = db.GetByID(ctx, &User{ID: user.ID})
+		assert.True(t, fireorm.IsNotFoundError(err), "The source document should be deleted")
+		moved, err := client.Collection("archived_users").Doc(newID).Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "Pending", moved.Data()["name"])
+
+		// A document with the same ID in the target makes the move fail as a whole
+		blocked := &User{Name: "Blocked", Email: "blocked@example.com"}
+		err = db.Save(ctx, blocked)
+		assert.NoError(t, err)
+		_, err = client.Collection("archived_users").Doc(blocked.ID).Set(ctx, map[string]interface{}{"name": "Existing"})
+		assert.NoError(t, err)
+
+		_, err = db.Move(ctx, blocked, "archived_users")
+		assert.Error(t, err)
+		err = db.GetByID(ctx, &User{ID: blocked.ID})
+		assert.NoError(t, err, "The source document should remain after a failed move")
+		existing, err := client.Collection("archived_users").Doc(blocked.ID).Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "Existing", existing.Data()["name"], "The target document should be unchanged")
+	})
+
+	t.Run("Watch With Projection", func(t *testing.T) {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		events := make(chan fireorm.WatchEvent, 10)
+		done := make(chan error, 1)
+		query := []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "watched@example.com"}}},
+		}
+		go func() {
+			done <- db.Watch(watchCtx, query, UserName{}, func(event fireorm.WatchEvent) error {
+				events <- event
+				return nil
+			})
+		}()
+
+		user := &User{Name: "Watched", Email: "watched@example.com", Age: 64}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		select {
+		case event := <-events:
+			assert.Equal(t, fireorm.ChangeAdded, event.Kind)
+			assert.Equal(t, user.ID, event.ID)
+			projected, ok := event.Model.(*UserName)
+			assert.True(t, ok, "The handler should receive the projection type")
+			assert.Equal(t, &UserName{ID: user.ID, Name: "Watched"}, projected, "Only projected fields should be populated")
+		case err := <-done:
+			t.Fatalf("Watch stopped early: %v", err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for a watch event")
+		}
+
+		cancel()
+		assert.NoError(t, <-done, "Canceling the context should stop Watch without an error")
+	})
+
+	t.Run("Encrypted Fields", func(t *testing.T) {
+		patients := fireorm.New(connection).Model(&Patient{}).WithFieldCodec(reverseCodec)
+		patient := &Patient{Name: "Jane", SSN: "123-45-6789"}
+		err := patients.Save(ctx, patient)
+		assert.NoError(t, err)
+
+		stored, err := client.Collection("patients").Doc(patient.ID).Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "enc:9876-54-321", stored.Data()["ssn"], "The stored value should be encoded")
+		assert.Equal(t, "Jane", stored.Data()["name"])
+
+		retrieved := &Patient{ID: patient.ID}
+		err = patients.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "123-45-6789", retrieved.SSN, "Reads should decode the stored value")
+
+		err = patients.Save(ctx, &Patient{ID: patient.ID, SSN: "987-65-4321"}, "ssn")
+		assert.NoError(t, err)
+		var results []Patient
+		err = patients.FindAll(ctx, nil, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "987-65-4321", results[0].SSN, "Partial saves should encode the field too")
+	})
+
+	t.Run("Nested Array Membership", func(t *testing.T) {
+		catalogs := fireorm.New(connection).Model(&Catalog{})
+		goCatalog := &Catalog{Name: "Go", Tags: CatalogTags{Items: []string{"go", "orm"}}, Labels: map[string][]string{"v1.0": {"stable"}}}
+		err := catalogs.Save(ctx, goCatalog)
+		assert.NoError(t, err)
+		rustCatalog := &Catalog{Name: "Rust", Tags: CatalogTags{Items: []string{"rust"}}, Labels: map[string][]string{"v1.0": {"beta"}}}
+		err = catalogs.Save(ctx, rustCatalog)
+		assert.NoError(t, err)
+
+		var results []Catalog
+		err = catalogs.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "tags.items", Operator: "array-contains", Value: "orm"}}},
+		}, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, goCatalog.ID, results[0].ID)
+
+		results = nil
+		err = catalogs.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{FieldPath: firestore.FieldPath{"labels", "v1.0"}, Operator: "array-contains", Value: "beta"}}},
+		}, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, rustCatalog.ID, results[0].ID, "FieldPath segments may contain dots")
+	})
+
+	t.Run("Strip ID On Write", func(t *testing.T) {
+		tickets := fireorm.New(connection).Model(&Ticket{}).WithStripIDOnWrite()
+		ticket := &Ticket{Title: "Stripped"}
+		err := tickets.Save(ctx, ticket)
+		assert.NoError(t, err)
+		err = tickets.Save(ctx, &Ticket{ID: ticket.ID, Title: "Stripped Again"})
+		assert.NoError(t, err)
+
+		stored, err := client.Collection("tickets").Doc(ticket.ID).Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"title": "Stripped Again"}, stored.Data(), "The document should not store its own ID")
+
+		retrieved := &Ticket{ID: ticket.ID}
+		err = tickets.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, ticket.ID, retrieved.ID)
+
+		err = tickets.Save(ctx, &Ticket{ID: ticket.ID}, "id")
+		assert.Error(t, err, "The ID field cannot be written explicitly")
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+		_, err := client.Collection("users").Doc("diffed").Set(ctx, map[string]interface{}{
+			"name":  "Before",
+			"email": "diffed@example.com",
+		})
+		assert.NoError(t, err)
+
+		changes, err := db.Diff(ctx, &User{ID: "diffed", Name: "After", Email: "diffed@example.com", Age: 30})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]fireorm.FieldChange{
+			"name": {Old: "Before", New: "After"},
+			"age":  {Old: nil, New: 30},
+		}, changes, "Changed and new fields should be reported, unchanged ones left out")
+
+		changes, err = db.Diff(ctx, &User{ID: "diff-missing", Name: "Fresh", Email: "fresh@example.com"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]fireorm.FieldChange{
+			"name":  {New: "Fresh"},
+			"email": {New: "fresh@example.com"},
+			"age":   {New: 0},
+		}, changes, "All fields of a missing document should be reported as added")
+	})
+
+	t.Run("Under Same Parent", func(t *testing.T) {
+		post1 := client.Doc("posts/post-1")
+		post2 := client.Doc("posts/post-2")
+		for _, comment := range []*Comment{
+			{Post: post1, Text: "First"},
+			{Post: post1, Text: "Second"},
+			{Post: post2, Text: "Elsewhere"},
+		} {
+			err := fireorm.New(connection).UnderSameParent(ctx, comment).Save(ctx, comment)
+			assert.NoError(t, err)
+		}
+
+		stored, err := client.Collection("posts/post-1/comments").Documents(ctx).GetAll()
+		assert.NoError(t, err)
+		assert.Len(t, stored, 2, "Comments should be saved under their parent")
+
+		var siblings []Comment
+		err = fireorm.New(connection).UnderSameParent(ctx, &Comment{Post: post1}).FindAll(ctx, []fireorm.Query{
+			{OrderBy: []fireorm.OrderClause{{Field: "text", Direction: firestore.Asc}}},
+		}, &siblings)
+		assert.NoError(t, err)
+		assert.Len(t, siblings, 2)
+		assert.Equal(t, "First", siblings[0].Text)
+		assert.Equal(t, "Second", siblings[1].Text)
+		assert.Equal(t, post1.Path, siblings[1].Post.Path)
+		assert.Equal(t, "posts/post-1/comments/"+siblings[0].ID, siblings[0].Path, "The path field should hold the document path")
+
+		retrieved := &Comment{ID: siblings[1].ID, Post: post1}
+		err = fireorm.New(connection).UnderSameParent(ctx, retrieved).GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "posts/post-1/comments/"+retrieved.ID, retrieved.Path)
+	})
+
+	t.Run("Struct Where Value", func(t *testing.T) {
+		contacts := fireorm.New(connection).Model(&Contact{})
+		home := Address{Street: "Elm", City: "Shelbyville"}
+		err := contacts.Save(ctx, &Contact{Name: "Struct Query", Addresses: map[string]Address{"home": home}})
+		assert.NoError(t, err)
+
+		var found []Contact
+		err = contacts.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "addresses.home", Operator: "==", Value: home}}},
+		}, &found)
+		assert.NoError(t, err)
+		assert.Len(t, found, 1, "A struct value should match the map written for it")
+		assert.Equal(t, "Struct Query", found[0].Name)
+	})
+
+	t.Run("Strict Decoding", func(t *testing.T) {
+		_, err := client.Collection("users").Doc("drifted").Set(ctx, map[string]interface{}{
+			"name":     "Drifted",
+			"email":    "drifted@example.com",
+			"nickname": "Drifty",
+			"legacy":   true,
+		})
+		assert.NoError(t, err)
+
+		user := &User{ID: "drifted"}
+		err = db.GetByID(ctx, user)
+		assert.NoError(t, err, "Unknown fields are ignored by default")
+		assert.Equal(t, "Drifted", user.Name)
+
+		strict := db.WithStrictDecoding()
+		err = strict.GetByID(ctx, &User{ID: "drifted"})
+		assert.EqualError(t, err, "document drifted has fields not declared by the model: legacy, nickname")
+
+		var users []User
+		err = strict.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "drifted@example.com"}}},
+		}, &users)
+		assert.Error(t, err, "FindAll should decode strictly too")
+
+		clean := &User{Name: "Clean", Email: "clean@example.com"}
+		err = db.Save(ctx, clean)
+		assert.NoError(t, err)
+		err = strict.GetByID(ctx, &User{ID: clean.ID})
+		assert.NoError(t, err, "Documents matching the model should decode under strict mode")
+
+		_, err = client.Collection("users").Doc("drifted").Delete(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Default Order", func(t *testing.T) {
+		articles := fireorm.New(connection).Model(&LatestArticle{})
+		for _, title := range []string{"B", "C", "A"} {
+			err := articles.Save(ctx, &LatestArticle{Title: title, Tags: []string{"ordered"}})
+			assert.NoError(t, err)
+		}
+		tagged := fireorm.Query{Where: []fireorm.WhereClause{{Field: "tags", Operator: "array-contains", Value: "ordered"}}}
+
+		var found []LatestArticle
+		err := articles.FindAll(ctx, []fireorm.Query{tagged}, &found)
+		assert.NoError(t, err)
+		assert.Len(t, found, 3)
+		for i, title := range []string{"C", "B", "A"} {
+			assert.Equal(t, title, found[i].Title, "The default order should apply")
+		}
+		var first LatestArticle
+		err = articles.FindOne(ctx, []fireorm.Query{tagged}, &first)
+		assert.NoError(t, err)
+		assert.Equal(t, "C", first.Title)
+
+		ascending := []fireorm.Query{tagged, {OrderBy: []fireorm.OrderClause{{Field: "title", Direction: firestore.Asc}}}}
+		var overridden []LatestArticle
+		err = articles.FindAll(ctx, ascending, &overridden)
+		assert.NoError(t, err)
+		assert.Len(t, overridden, 3)
+		for i, title := range []string{"A", "B", "C"} {
+			assert.Equal(t, title, overridden[i].Title, "An explicit order should replace the default")
+		}
+		err = articles.FindOne(ctx, ascending, &first)
+		assert.NoError(t, err)
+		assert.Equal(t, "A", first.Title)
+
+		var page []LatestArticle
+		hasMore, lastDoc, err := articles.FindPage(ctx, []fireorm.Query{tagged}, 2, &page)
+		assert.NoError(t, err)
+		assert.True(t, hasMore)
+		if assert.Len(t, page, 2) {
+			assert.Equal(t, "C", page[0].Title, "Pages should follow the default order")
+			assert.Equal(t, "B", page[1].Title)
+		}
+		next := tagged
+		next.StartAfter = []interface{}{lastDoc}
+		page = nil
+		hasMore, _, err = articles.FindPage(ctx, []fireorm.Query{next}, 2, &page)
+		assert.NoError(t, err)
+		assert.False(t, hasMore)
+		if assert.Len(t, page, 1, "The cursor should continue in the default order") {
+			assert.Equal(t, "A", page[0].Title)
+		}
+	})
+
+	t.Run("Get By ID Select", func(t *testing.T) {
+		user := &User{Name: "Selma", Email: "selma@example.com", Age: 41}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		selected := &User{ID: user.ID}
+		err = db.GetByIDSelect(ctx, selected, "name", "age")
+		assert.NoError(t, err)
+		assert.Equal(t, "Selma", selected.Name)
+		assert.Equal(t, 41, selected.Age)
+		assert.Empty(t, selected.Email, "Fields not selected should not be read")
+
+		err = db.GetByIDSelect(ctx, &User{ID: "missing-user"}, "name")
+		assert.ErrorIs(t, err, fireorm.ErrNotFound)
+		err = db.GetByIDSelect(ctx, &User{ID: user.ID})
+		assert.Error(t, err, "At least one field should be required")
+
+		eventual := &User{ID: user.ID}
+		err = db.WithConsistency(fireorm.ConsistencyEventual).GetByIDSelect(ctx, eventual, "name")
+		assert.NoError(t, err, "Selecting fields should not depend on the consistency level")
+		assert.Equal(t, "Selma", eventual.Name)
+	})
+
+	t.Run("Find Union", func(t *testing.T) {
+		for _, name := range []string{"Una", "Ursula", "Uma"} {
+			err := db.Save(ctx, &User{Name: name, Email: strings.ToLower(name) + "@example.com"})
+			assert.NoError(t, err)
+		}
+		named := func(names ...interface{}) []fireorm.Query {
+			return []fireorm.Query{{
+				Where:   []fireorm.WhereClause{{Field: "name", Operator: "in", Value: names}},
+				OrderBy: []fireorm.OrderClause{{Field: "name", Direction: firestore.Asc}},
+			}}
+		}
+
+		var users []User
+		err := db.FindUnion(ctx, [][]fireorm.Query{named("Una", "Ursula"), named("Ursula", "Uma")}, &users)
+		assert.NoError(t, err)
+		var names []string
+		for _, user := range users {
+			names = append(names, user.Name)
+		}
+		assert.Equal(t, []string{"Una", "Ursula", "Uma"}, names, "Overlapping results should appear once, in query order")
+
+		var failed []User
+		err = db.FindUnion(ctx, [][]fireorm.Query{named("Una"), {{Limit: -1}}}, &failed)
+		assert.ErrorContains(t, err, "query 1:")
+		assert.Empty(t, failed)
+	})
+
+	t.Run("Find Snapshots", func(t *testing.T) {
+		user := &User{Name: "Snapshot", Email: "snapshot@example.com", Age: 33}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		snapshots, err := db.FindSnapshots(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Snapshot"}}},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, snapshots, 1)
+		assert.Equal(t, user.ID, snapshots[0].Ref.ID)
+		assert.Equal(t, "users", snapshots[0].Ref.Parent.ID)
+		assert.Equal(t, map[string]interface{}{"name": "Snapshot", "email": "snapshot@example.com", "age": int64(33)}, snapshots[0].Data())
+		assert.False(t, snapshots[0].UpdateTime.IsZero())
+
+		err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			txSnapshots, err := db.FindSnapshots(fireorm.ContextWithTransaction(ctx, tx), []fireorm.Query{
+				{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Snapshot"}}},
+			})
+			assert.NoError(t, err)
+			assert.Len(t, txSnapshots, 1)
+			return err
+		})
+		assert.NoError(t, err)
+
+		_, err = fireorm.New(connection).FindSnapshots(ctx, nil)
+		assert.Error(t, err, "A model is required")
+	})
+
+	t.Run("Update Only", func(t *testing.T) {
+		updateOnly := db.WithUpdateOnly()
+		err := updateOnly.Save(ctx, &User{ID: "stale-user-id", Name: "Ghost"})
+		assert.ErrorIs(t, err, fireorm.ErrNotFound, "Saving with a missing ID should fail")
+		_, err = client.Collection("users").Doc("stale-user-id").Get(ctx)
+		assert.True(t, fireorm.IsNotFoundError(err), "No document should be created")
+
+		user := &User{Name: "Uma"}
+		err = updateOnly.Save(ctx, user)
+		assert.NoError(t, err, "Saving without an ID should still create the document")
+		assert.NotEmpty(t, user.ID)
+
+		user.Name = "Uma Updated"
+		user.Age = 52
+		err = updateOnly.Save(ctx, user)
+		assert.NoError(t, err)
+		stored := &User{ID: user.ID}
+		assert.NoError(t, db.GetByID(ctx, stored))
+		assert.Equal(t, "Uma Updated", stored.Name)
+		assert.Equal(t, 52, stored.Age)
+	})
+
+	t.Run("Map Key Conversion", func(t *testing.T) {
+		boards := fireorm.New(connection).Model(&Leaderboard{})
+		board := &Leaderboard{Scores: map[int]string{1: "Alice", 2: "Bob"}}
+		err := boards.Save(ctx, board)
+		assert.Error(t, err, "Non-string map keys should be rejected without conversion")
+		assert.Empty(t, board.ID, "Nothing should be written")
+
+		err = boards.WithMapKeyConversion(true).Save(ctx, board)
+		assert.NoError(t, err)
+		doc, err := client.Collection("leaderboards").Doc(board.ID).Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"1": "Alice", "2": "Bob"}, doc.Data()["scores"])
+
+		read := &Leaderboard{ID: board.ID}
+		err = boards.GetByID(ctx, read)
+		assert.NoError(t, err)
+		assert.Equal(t, board.Scores, read.Scores, "Keys should be parsed back on read")
+	})
+
+	t.Run("Get By ID Or Default", func(t *testing.T) {
+		defaults := User{ID: "defaults-id", Name: "Default", Email: "default@example.com", Age: 18}
+		stored := &User{Name: "Stored", Email: "stored@example.com", Age: 40}
+		err := db.Save(ctx, stored)
+		assert.NoError(t, err)
+
+		existing := &User{ID: stored.ID}
+		err = db.GetByIDOrDefault(ctx, existing, defaults)
+		assert.NoError(t, err)
+		assert.Equal(t, *stored, *existing, "Existing documents should use the stored values")
+
+		missing := &User{ID: "missing-config"}
+		err = db.GetByIDOrDefault(ctx, missing, &defaults)
+		assert.NoError(t, err)
+		assert.Equal(t, User{ID: "missing-config", Name: "Default", Email: "default@example.com", Age: 18}, *missing,
+			"Missing documents should use the defaults with the model's ID")
+
+		err = db.GetByIDOrDefault(ctx, &User{ID: stored.ID}, Article{})
+		assert.Error(t, err, "Defaults of another type should be rejected")
+	})
+
+	t.Run("Field Allowlist", func(t *testing.T) {
+		user := &User{Name: "Rhea", Email: "rhea@example.com", Age: 35}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+		restricted := db.WithFieldAllowlist([]string{"name", "Age"})
+
+		read := &User{ID: user.ID, Email: "stale@example.com"}
+		err = restricted.GetByID(ctx, read)
+		assert.NoError(t, err)
+		assert.Equal(t, User{ID: user.ID, Name: "Rhea", Age: 35}, *read, "Disallowed fields should be zero")
+
+		raw, err := restricted.GetByIDWithRaw(ctx, &User{ID: user.ID})
+		assert.NoError(t, err)
+		assert.NotContains(t, raw, "email", "Raw data should only hold allowed fields")
+
+		var found []User
+		err = restricted.FindAll(ctx, []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Rhea"}}}}, &found)
+		assert.NoError(t, err)
+		if assert.Len(t, found, 1) {
+			assert.Equal(t, User{ID: user.ID, Name: "Rhea", Age: 35}, found[0])
+		}
+
+		snapshots, err := restricted.FindSnapshots(ctx, []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Rhea"}}}})
+		assert.NoError(t, err)
+		if assert.Len(t, snapshots, 1) {
+			assert.NotContains(t, snapshots[0].Data(), "email", "Queries should only select allowed fields")
+		}
+
+		err = restricted.GetByIDSelect(ctx, &User{ID: user.ID}, "email")
+		assert.Error(t, err, "Selecting only disallowed fields should fail")
+
+		unrestricted := &User{ID: user.ID}
+		err = restricted.WithFieldAllowlist(nil).GetByID(ctx, unrestricted)
+		assert.NoError(t, err)
+		assert.Equal(t, "rhea@example.com", unrestricted.Email, "A nil allowlist should remove the restriction")
+	})
+
+	t.Run("FindOne ID Parity", func(t *testing.T) {
+		notes := fireorm.New(connection).Model(&Note{})
+		note := &Note{Text: "Parity"}
+		err := notes.Save(ctx, note)
+		assert.NoError(t, err)
+		query := []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "text", Operator: "==", Value: "Parity"}}}}
+
+		var all []Note
+		err = notes.FindAll(ctx, query, &all)
+		assert.NoError(t, err)
+		found := &Note{DocID: "other"}
+		err = notes.FindOne(ctx, query, found)
+		assert.NoError(t, err)
+		if assert.Len(t, all, 1) {
+			assert.Equal(t, note.DocID, all[0].DocID)
+			assert.Equal(t, all[0], *found, "FindOne should decode like FindAll, including the tagged ID field")
+		}
+
+		user := &User{Name: "Parity", Email: "parity@example.com", Age: 41}
+		err = db.Save(ctx, user)
+		assert.NoError(t, err)
+		userQuery := []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "parity@example.com"}}}}
+		var users []User
+		err = db.FindAll(ctx, userQuery, &users)
+		assert.NoError(t, err)
+		foundUser := &User{}
+		err = db.FindOne(ctx, userQuery, foundUser)
+		assert.NoError(t, err)
+		if assert.Len(t, users, 1) {
+			assert.Equal(t, user.ID, foundUser.ID)
+			assert.Equal(t, users[0], *foundUser, "FindOne should decode like FindAll")
+		}
+	})
+
+	t.Run("Field Setters", func(t *testing.T) {
+		accounts := fireorm.New(connection).Model(&Account{})
+		_, err := client.Collection("accounts").Doc("account1").Set(ctx, map[string]interface{}{
+			"owner": "Ada", "balance": 120, "tier": "gold",
+		})
+		assert.NoError(t, err)
+
+		account := &Account{ID: "account1"}
+		err = accounts.GetByID(ctx, account)
+		assert.NoError(t, err)
+		assert.Equal(t, "Ada", account.Owner)
+		assert.Equal(t, int64(120), account.balance, "SetField should set the unexported balance")
+		assert.Equal(t, "gold", account.tier)
+
+		var all []Account
+		err = accounts.WithStrictDecoding().FindAll(ctx, nil, &all)
+		assert.NoError(t, err, "Fields passed to SetField should not fail strict decoding")
+		if assert.Len(t, all, 1) {
+			assert.Equal(t, int64(120), all[0].balance)
+		}
+
+		_, err = client.Collection("accounts").Doc("account2").Set(ctx, map[string]interface{}{
+			"owner": "Grace", "balance": "lots",
+		})
+		assert.NoError(t, err)
+		err = accounts.GetByID(ctx, &Account{ID: "account2"})
+		assert.ErrorContains(t, err, "balance must be an integer", "SetField errors should fail the read")
+	})
+
+	t.Run("Apply Defaults", func(t *testing.T) {
+		subscriptions := fireorm.New(connection).Model(&Subscription{})
+		subscription := &Subscription{Plan: "basic"}
+		err := subscriptions.Save(ctx, subscription)
+		assert.NoError(t, err)
+		assert.Equal(t, "active", subscription.Status)
+		stored, err := client.Collection("subscriptions").Doc(subscription.ID).Get(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "active", stored.Data()["status"], "The default should be persisted")
+		}
+
+		paused := &Subscription{Plan: "pro", Status: "paused"}
+		err = subscriptions.Save(ctx, paused)
+		assert.NoError(t, err)
+		retrieved := &Subscription{ID: paused.ID}
+		err = subscriptions.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "paused", retrieved.Status, "Set fields should be kept")
+
+		batch := []Subscription{{Plan: "team"}}
+		ids, err := subscriptions.SaveAll(ctx, batch)
+		assert.NoError(t, err)
+		if assert.Len(t, ids, 1) {
+			retrieved = &Subscription{ID: ids[0]}
+			err = subscriptions.GetByID(ctx, retrieved)
+			assert.NoError(t, err)
+			assert.Equal(t, "active", retrieved.Status, "Batch writes should apply defaults")
+		}
+	})
+
+	t.Run("Lowercase Fields", func(t *testing.T) {
+		subscribers := fireorm.New(connection).Model(&Subscriber{})
+		subscriber := &Subscriber{Name: "Ada", Email: "Ada.Lovelace@Example.com"}
+		err := subscribers.Save(ctx, subscriber)
+		assert.NoError(t, err)
+
+		found := &Subscriber{}
+		err = subscribers.FindOne(ctx, []fireorm.Query{{Where: []fireorm.WhereClause{
+			{Field: "email", Operator: "==", Value: "ADA.LOVELACE@EXAMPLE.COM"},
+		}}}, found)
+		assert.NoError(t, err, "An uppercase query should find the mixed-case email")
+		assert.Equal(t, subscriber.ID, found.ID)
+		assert.Equal(t, "ada.lovelace@example.com", found.Email, "The email should be stored lowercased")
+
+		subscriber.Email = "ADA@Example.org"
+		err = subscribers.Save(ctx, subscriber, "email")
+		assert.NoError(t, err)
+		err = subscribers.GetByID(ctx, found)
+		assert.NoError(t, err)
+		assert.Equal(t, "ada@example.org", found.Email, "Partial saves should lowercase too")
+	})
+
+	t.Run("Gzip Fields", func(t *testing.T) {
+		reports := fireorm.New(connection).Model(&Report{})
+		payload := []byte(strings.Repeat(`{"metric":"latency","p99":120}`, 5000))
+		report := &Report{Payload: payload, Body: string(payload)}
+		err := reports.Save(ctx, report)
+		assert.NoError(t, err)
+
+		stored, err := client.Collection("reports").Doc(report.ID).Get(ctx)
+		if assert.NoError(t, err) {
+			compressed, ok := stored.Data()["payload"].([]byte)
+			assert.True(t, ok)
+			assert.Less(t, len(compressed), len(payload)/10, "The payload should be stored compressed")
+		}
+
+		retrieved := &Report{ID: report.ID}
+		err = reports.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, retrieved.Payload, "The payload should be read back intact")
+		assert.Equal(t, string(payload), retrieved.Body)
+
+		var all []Report
+		err = reports.FindAll(ctx, nil, &all)
+		assert.NoError(t, err)
+		if assert.Len(t, all, 1) {
+			assert.Equal(t, payload, all[0].Payload)
+		}
+
+		// Values expanding beyond MaxGzipFieldSize are rejected rather than allocated
+		var bomb bytes.Buffer
+		writer := gzip.NewWriter(&bomb)
+		_, err = writer.Write(make([]byte, fireorm.MaxGzipFieldSize+1))
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+		_, err = client.Collection("reports").Doc("bomb").Set(ctx, map[string]interface{}{"payload": bomb.Bytes()})
+		assert.NoError(t, err)
+		err = reports.GetByID(ctx, &Report{ID: "bomb"})
+		assert.ErrorContains(t, err, "exceeds")
+	})
+
+	t.Run("Path Field", func(t *testing.T) {
+		user := &User{Name: "Path Owner", Email: "path@example.com"}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+		paths := fireorm.New(connection).Model(&UserPath{})
+
+		retrieved := &UserPath{ID: user.ID}
+		err = paths.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "users/"+user.ID, retrieved.Path, "GetByID should set the path field")
+
+		var found UserPath
+		err = paths.FindOne(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "path@example.com"}}},
+		}, &found)
+		assert.NoError(t, err)
+		assert.Equal(t, "users/"+user.ID, found.Path, "FindOne should set the path field")
+
+		var all []UserPath
+		err = paths.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "path@example.com"}}},
+		}, &all)
+		assert.NoError(t, err)
+		assert.Len(t, all, 1)
+		assert.Equal(t, "users/"+user.ID, all[0].Path, "FindAll should set the path field")
+	})
+
+	t.Run("Excluded Fields", func(t *testing.T) {
+		excluding := db.WithExcludedFields("Age")
+		user := &User{Name: "Excluded", Email: "excluded@example.com", Age: 99}
+		err := excluding.Save(ctx, user)
+		assert.NoError(t, err)
+
+		stored, err := client.Collection("users").Doc(user.ID).Get(ctx)
+		assert.NoError(t, err)
+		assert.NotContains(t, stored.Data(), "age", "Excluded fields should not be persisted")
+		assert.Equal(t, "Excluded", stored.Data()["name"])
+
+		err = excluding.Save(ctx, user, "age")
+		assert.Error(t, err, "Excluded fields cannot be saved explicitly")
+
+		_, err = excluding.SaveAll(ctx, []*User{{Name: "Excluded Batch", Age: 5}})
+		assert.NoError(t, err)
+		var batch []User
+		err = db.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Excluded Batch"}}},
+		}, &batch)
+		assert.NoError(t, err)
+		assert.Len(t, batch, 1)
+		assert.Equal(t, 0, batch[0].Age, "Batch writes should honor exclusions")
+	})
+
+	t.Run("Custom Decoder", func(t *testing.T) {
+		bookmarks := fireorm.New(connection).Model(&Bookmark{})
+		bookmark := &Bookmark{URL: "https://example.com", Visits: 3}
+		err := bookmarks.Save(ctx, bookmark)
+		assert.NoError(t, err)
+
+		retrieved := &Bookmark{ID: bookmark.ID}
+		err = bookmarks.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.True(t, retrieved.Decoded, "GetByID should use the custom decoder")
+		assert.Equal(t, "https://example.com", retrieved.URL)
+		assert.Equal(t, 3, retrieved.Visits)
+		assert.Equal(t, bookmark.ID, retrieved.ID, "The ID should still be set")
+
+		var found Bookmark
+		err = bookmarks.FindOne(ctx, nil, &found)
+		assert.NoError(t, err)
+		assert.True(t, found.Decoded, "FindOne should use the custom decoder")
+
+		var all []Bookmark
+		err = bookmarks.FindAll(ctx, nil, &all)
+		assert.NoError(t, err)
+		assert.Len(t, all, 1)
+		assert.True(t, all[0].Decoded, "FindAll should use the custom decoder")
+
+		_, err = client.Collection("bookmarks").Doc("broken").Set(ctx, map[string]interface{}{"url": 42})
+		assert.NoError(t, err)
+		err = bookmarks.GetByID(ctx, &Bookmark{ID: "broken"})
+		assert.ErrorContains(t, err, "url must be a string", "Decoder errors should be returned")
+	})
+
+	t.Run("Schema Upgrade", func(t *testing.T) {
+		customers := fireorm.New(connection).Model(&Customer{})
+		_, err := client.Collection("customers").Doc("v1-customer").Set(ctx, map[string]interface{}{
+			"first":                    "Ada",
+			"last":                     "Lovelace",
+			fireorm.SchemaVersionField: 1,
+		})
+		assert.NoError(t, err)
+
+		retrieved := &Customer{ID: "v1-customer"}
+		err = customers.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, "Ada Lovelace", retrieved.FullName, "Older documents should be upgraded on read")
+
+		err = customers.Save(ctx, retrieved)
+		assert.NoError(t, err)
+		stored, err := client.Collection("customers").Doc("v1-customer").Get(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), stored.Data()[fireorm.SchemaVersionField], "Saves should stamp the current version")
+	})
+
+	t.Run("Field Collision", func(t *testing.T) {
+		user := &User{Name: "Field Collision", Email: "collision@example.com", Age: 99}
+		err := db.Save(ctx, user)
+		assert.NoError(t, err)
+
+		retrieved := &User{ID: user.ID}
+		err = db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, user.Name, retrieved.Name)
+		assert.Equal(t, user.Email, retrieved.Email)
+	})
+}
+
+func TestUpdateBatchSize(t *testing.T) {
+	db := fireorm.New(fireorm.NewConnection(nil))
+	assert.Equal(t, 100, db.GetUpdateBatchSize())
+
+	assert.Equal(t, 250, db.SetUpdateBatchSize(250).GetUpdateBatchSize())
+	assert.Equal(t, fireorm.BatchWriteLimit, db.SetUpdateBatchSize(fireorm.BatchWriteLimit).GetUpdateBatchSize())
+	assert.Equal(t, fireorm.BatchWriteLimit, db.SetUpdateBatchSize(1000).GetUpdateBatchSize(), "Over-limit sizes should be clamped")
+	assert.Equal(t, 100, db.SetUpdateBatchSize(0).GetUpdateBatchSize(), "Invalid sizes should be ignored")
+	assert.Equal(t, 100, db.GetUpdateBatchSize(), "The original instance should be unchanged")
+}
+
+func TestConsistency(t *testing.T) {
+	db := fireorm.New(fireorm.NewConnection(nil))
+	assert.Equal(t, fireorm.ConsistencyStrong, db.GetConsistency())
+
+	eventual := db.WithConsistency(fireorm.ConsistencyEventual)
+	assert.Equal(t, fireorm.ConsistencyEventual, eventual.GetConsistency())
+	assert.Equal(t, fireorm.ConsistencyStrong, db.GetConsistency(), "The original instance should be unchanged")
+
+	now := time.Date(2024, 5, 1, 12, 0, 30, 123456789, time.UTC)
+	readTime := fireorm.EventualReadTime(now)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 0, 15, 123456000, time.UTC), readTime)
+	assert.Zero(t, readTime.Nanosecond()%int(time.Microsecond), "Read times must have microsecond precision")
+}
+
+func TestCollectionAffixes(t *testing.T) {
+	db := fireorm.New(fireorm.NewConnection(nil))
+
+	name, err := db.Model(&User{}).WithCollectionSuffix("_staging").CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "users_staging", name)
+
+	name, err = db.WithCollectionPrefix("tenant1_").WithCollectionSuffix("_staging").Model(&User{}).CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant1_users_staging", name)
+
+	name, err = db.WithCollectionSuffix("_dev").Model(&Circle{}).CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "shapes_dev", name, "Suffixes apply to custom collection names too")
+
+	name, err = db.Model(&User{}).CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "users", name)
+}
+
+func TestUnderSameParent(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	db := fireorm.New(fireorm.NewConnection(client))
+
+	name, err := db.UnderSameParent(ctx, &Comment{Post: client.Doc("posts/post-1")}).CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "posts/post-1/comments", name)
+
+	name, err = db.WithCollectionPrefix("dev_").UnderSameParent(ctx, &Comment{Post: client.Doc("threads/t1/posts/p1")}).CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "threads/t1/posts/p1/dev_comments", name, "Only the model's collection name is affixed")
+
+	type TwoRefs struct {
+		Author *firestore.DocumentRef `firestore:"author"`
+		Post   *firestore.DocumentRef `firestore:"post" fireorm:"parent"`
+	}
+	name, err = db.UnderSameParent(ctx, &TwoRefs{Post: client.Doc("posts/post-1")}).CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "posts/post-1/tworefss", name, "The tagged parent field should be used")
+
+	_, err = db.UnderSameParent(ctx, &Comment{}).CollectionName()
+	assert.Error(t, err, "A nil parent should be rejected")
+	err = db.UnderSameParent(ctx, &User{}).Save(ctx, &User{Name: "Orphan"})
+	assert.Error(t, err, "Models without a parent field should be rejected")
+	_, err = db.UnderSameParent(ctx, &struct {
+		A *firestore.DocumentRef
+		B *firestore.DocumentRef
+	}{}).CollectionName()
+	assert.Error(t, err, "Ambiguous parent fields should be rejected")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	ctx := context.Background()
+	// Without a client every call that reaches Firestore dereferences a nil pointer
+	db := fireorm.New(fireorm.NewConnection(nil))
+
+	calls := map[string]func() error{
+		"GetByID non-struct": func() error { return db.GetByID(ctx, 42) },
+		"GetByID nil client": func() error { return db.GetByID(ctx, &User{ID: "user1"}) },
+		"Save nil model":     func() error { return db.Save(ctx, nil) },
+		"Save nil client":    func() error { return db.Save(ctx, &User{ID: "user1"}) },
+		"Update nil model": func() error {
+			return db.Update(ctx, nil, []firestore.Update{{Path: "name", Value: "x"}})
+		},
+		"Delete nil model":    func() error { return db.Delete(ctx, nil) },
+		"FindOne nil client":  func() error { return db.FindOne(ctx, nil, &User{}) },
+		"FindAll nil client":  func() error { return db.FindAll(ctx, nil, &[]User{}) },
+		"GetByIDs nil client": func() error { return db.GetByIDs(ctx, []string{"user1"}, &[]User{}) },
+		"GetByIDsOrdered nil client": func() error {
+			_, err := db.GetByIDsOrdered(ctx, []string{"user1"}, &[]User{})
+			return err
+		},
+		"RawQuery nil client": func() error {
+			_, err := db.Model(&User{}).RawQuery(ctx)
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			var err error
+			assert.NotPanics(t, func() { err = call() })
+			assert.Error(t, err)
+		})
+	}
+
+	err := db.Save(ctx, nil)
+	assert.ErrorContains(t, err, "Save: panic occurred")
+}
+
+func TestCompositeIDErrors(t *testing.T) {
+	ctx := context.Background()
+	memberships := fireorm.New(fireorm.NewConnection(nil)).Model(&Membership{})
+	incomplete := &Membership{Tenant: "acme"}
+	updates := []firestore.Update{{Path: "role", Value: "viewer"}}
+
+	calls := map[string]func() error{
+		"Update":      func() error { return memberships.Update(ctx, incomplete, updates) },
+		"ArrayAppend": func() error { return memberships.ArrayAppend(ctx, incomplete, "roles", "viewer") },
+		"ArrayRemove": func() error { return memberships.ArrayRemove(ctx, incomplete, "roles", "viewer") },
+		"UpdateMax":   func() error { return memberships.UpdateMax(ctx, incomplete, "level", 1) },
+		"UpdateMin":   func() error { return memberships.UpdateMin(ctx, incomplete, "level", 1) },
+		"SaveIfNewer": func() error { return memberships.SaveIfNewer(ctx, incomplete, "Role") },
+		"DocRef": func() error {
+			_, err := memberships.DocRef(incomplete)
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorContains(t, call(), "tenant and resource are required", "The CompositeID error should be returned")
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	readOnly := fireorm.New(fireorm.NewConnection(nil)).Model(&User{}).WithReadOnly()
+	user := &User{ID: "user1", Name: "Frozen"}
+	updates := []firestore.Update{{Path: "name", Value: "Changed"}}
+
+	calls := map[string]func() error{
+		"Save":        func() error { return readOnly.Save(ctx, user) },
+		"SaveIfNewer": func() error { return readOnly.SaveIfNewer(ctx, user, "Age") },
+		"Update":      func() error { return readOnly.Update(ctx, user, updates) },
+		"Delete":      func() error { return readOnly.Delete(ctx, user) },
+		"ArrayAppend": func() error { return readOnly.ArrayAppend(ctx, user, "tags", "go") },
+		"UpdateMax":   func() error { return readOnly.UpdateMax(ctx, user, "age", 1) },
+		"SaveAll": func() error {
+			_, err := readOnly.SaveAll(ctx, []User{*user})
+			return err
+		},
+		"DeleteCollection": func() error {
+			_, err := readOnly.DeleteCollection(ctx, 10)
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, call(), fireorm.ErrReadOnly)
+		})
+	}
+}
+
+func TestTaggedIDField(t *testing.T) {
+	db := fireorm.New(fireorm.NewConnection(nil))
+
+	note := &Note{}
+	fireorm.SetIDField(note, "note1")
+	assert.Equal(t, "note1", note.DocID)
+	assert.Equal(t, "note1", db.GetID(note))
+
+	user := &User{}
+	fireorm.SetIDField(user, "user1")
+	assert.Equal(t, "user1", user.ID, "Models without a tagged field keep using the ID field")
+	assert.Equal(t, "user1", db.GetID(user))
 }
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+type decodeTarget struct {
+	Name     string             `firestore:"name"`
+	Age      int                `firestore:"age"`
+	Score    float32            `firestore:"score"`
+	Active   bool               `firestore:"active"`
+	Tags     []string           `firestore:"tags"`
+	Address  *Address           `firestore:"address"`
+	Visits   map[string]int     `firestore:"visits"`
+	Seen     time.Time          `firestore:"seen"`
+	Extra    interface{}        `firestore:"extra"`
+	Nickname string             // Matched by Go name
+	Skipped  string             `firestore:"-"`
+	Nested   map[string]Address `firestore:"nested"`
+}
+
+func TestDecodeMap(t *testing.T) {
+	seen := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var dest decodeTarget
+	err := fireorm.DecodeMap(map[string]interface{}{
+		"name":     "Alice",
+		"age":      int64(30),
+		"score":    int64(7),
+		"active":   true,
+		"tags":     []interface{}{"a", "b"},
+		"address":  map[string]interface{}{"street": "Main", "city": "Springfield"},
+		"visits":   map[string]interface{}{"home": int64(3)},
+		"seen":     seen,
+		"extra":    []interface{}{int64(1)},
+		"nickname": "Al",
+		"Skipped":  "ignored",
+		"nested":   map[string]interface{}{"work": map[string]interface{}{"city": "Shelbyville"}},
+		"unknown":  "ignored",
+	}, &dest)
+	assert.NoError(t, err)
+	assert.Equal(t, decodeTarget{
+		Name:     "Alice",
+		Age:      30,
+		Score:    7,
+		Active:   true,
+		Tags:     []string{"a", "b"},
+		Address:  &Address{Street: "Main", City: "Springfield"},
+		Visits:   map[string]int{"home": 3},
+		Seen:     seen,
+		Extra:    []interface{}{int64(1)},
+		Nickname: "Al",
+		Nested:   map[string]Address{"work": {City: "Shelbyville"}},
+	}, dest)
+
+	dest = decodeTarget{Name: "Kept", Tags: []string{"x"}}
+	err = fireorm.DecodeMap(map[string]interface{}{"name": nil, "tags": nil}, &dest)
+	assert.NoError(t, err)
+	assert.Equal(t, "Kept", dest.Name, "Null leaves non-nullable fields unchanged")
+	assert.Nil(t, dest.Tags, "Null clears nullable fields")
+
+	err = fireorm.DecodeMap(map[string]interface{}{"age": "thirty"}, &dest)
+	assert.Error(t, err)
+
+	err = fireorm.DecodeMap(map[string]interface{}{"age": int64(1) << 40}, &struct {
+		Age int8 `firestore:"age"`
+	}{})
+	assert.Error(t, err, "Overflowing integers should be rejected")
+
+	err = fireorm.DecodeMap(map[string]interface{}{"seen": "2024-05-01T12:00:00Z"}, &dest)
+	assert.NoError(t, err)
+	assert.True(t, seen.Equal(dest.Seen), "RFC 3339 strings should decode into time fields")
+	err = fireorm.DecodeMap(map[string]interface{}{"seen": "yesterday"}, &dest)
+	assert.Error(t, err)
+
+	err = fireorm.DecodeMap(map[string]interface{}{}, dest)
+	assert.Error(t, err, "dest must be a pointer")
+}
+
+type auditFields struct {
+	CreatedBy string `firestore:"createdBy"`
+	Version   int    `firestore:"version"`
+}
+
+type embeddedTarget struct {
+	auditFields
+	*Address
+	Name    string `firestore:"name"`
+	Version int    `firestore:"version"` // Shadows the embedded field
+}
+
+func TestDecodeMapEmbedded(t *testing.T) {
+	var dest embeddedTarget
+	err := fireorm.DecodeMap(map[string]interface{}{
+		"name":      "Alice",
+		"createdBy": "admin",
+		"version":   int64(2),
+		"street":    "Main",
+		"city":      "Springfield",
+	}, &dest)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", dest.Name)
+	assert.Equal(t, "admin", dest.CreatedBy, "Fields of embedded structs should be decoded")
+	assert.Equal(t, 2, dest.Version)
+	assert.Zero(t, dest.auditFields.Version, "Outer fields should take precedence over embedded ones")
+	if assert.NotNil(t, dest.Address, "Embedded struct pointers should be allocated") {
+		assert.Equal(t, Address{Street: "Main", City: "Springfield"}, *dest.Address)
+	}
+
+	var empty embeddedTarget
+	assert.NoError(t, fireorm.DecodeMap(map[string]interface{}{"name": "Bob"}, &empty))
+	assert.Nil(t, empty.Address, "Embedded struct pointers should only be allocated when set")
+}
+
+func TestErrPartialDecode(t *testing.T) {
+	first := errors.New("bad age")
+	err := &fireorm.ErrPartialDecode{Errors: map[string]error{"b": errors.New("bad name"), "a": first}}
+	assert.Equal(t, "2 documents could not be decoded: a: bad age; b: bad name", err.Error())
+	assert.ErrorIs(t, err, first, "The document errors should be unwrapped")
+}
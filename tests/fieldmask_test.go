@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateAllowed(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	user := &User{Name: "Masked", Email: "masked@example.com", Age: 30}
+	assert.NoError(t, db.Save(ctx, user))
+
+	updates := []firestore.Update{{Path: "name", Value: "Renamed"}, {Path: "email", Value: "forbidden@example.com"}}
+	assert.NoError(t, db.UpdateAllowed(ctx, user, updates, []string{"name", "age"}))
+	stored := &User{ID: user.ID}
+	assert.NoError(t, db.GetByID(ctx, stored))
+	assert.Equal(t, "Renamed", stored.Name)
+	assert.Equal(t, "masked@example.com", stored.Email, "The disallowed field should not be updated")
+
+	err := db.WithStrictFieldMask().Model(&User{}).UpdateAllowed(ctx, user, []firestore.Update{
+		{Path: "name", Value: "Strict"},
+		{Path: "email", Value: "forbidden@example.com"},
+	}, []string{"name"})
+	assert.ErrorContains(t, err, "email")
+	assert.NoError(t, db.GetByID(ctx, stored))
+	assert.Equal(t, "Renamed", stored.Name, "A strict mask should write nothing")
+
+	assert.NoError(t, db.UpdateAllowed(ctx, user, []firestore.Update{{Path: "email", Value: "forbidden@example.com"}}, nil),
+		"Dropping every update should write nothing")
+}
+
+func TestUpdateAllowedFieldMask(t *testing.T) {
+	ctx := context.Background()
+	recorder := &callRecorder{}
+	client := newRecordingClient(t, recorder)
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	user := &User{ID: "user-1"}
+	updates := []firestore.Update{
+		{Path: "name", Value: "Renamed"},
+		{Path: "profile.bio", Value: "Hello"},
+		{FieldPath: firestore.FieldPath{"profile", "verified"}, Value: true},
+		{Path: "email", Value: "forbidden@example.com"},
+		{Path: "roles", Value: []string{"admin"}},
+	}
+	assert.Error(t, db.UpdateAllowed(ctx, user, updates, []string{"name", "profile"}))
+	request, ok := recorder.last().request.(*firestorepb.CommitRequest)
+	if assert.True(t, ok, "The update should be committed") && assert.Len(t, request.GetWrites(), 1) {
+		assert.ElementsMatch(t, []string{"name", "profile.bio", "profile.verified"},
+			request.GetWrites()[0].GetUpdateMask().GetFieldPaths(), "Disallowed paths should be filtered out")
+	}
+
+	recorder.calls = nil
+	assert.Error(t, db.UpdateAllowed(ctx, user, updates, []string{"profile.bio"}))
+	request, ok = recorder.last().request.(*firestorepb.CommitRequest)
+	if assert.True(t, ok) && assert.Len(t, request.GetWrites(), 1) {
+		assert.Equal(t, []string{"profile.bio"}, request.GetWrites()[0].GetUpdateMask().GetFieldPaths(),
+			"Allowing a nested path should not allow its siblings")
+	}
+
+	recorder.calls = nil
+	err := db.WithStrictFieldMask().Model(&User{}).UpdateAllowed(ctx, user, updates, []string{"name", "profile"})
+	assert.EqualError(t, err, "updates of fields not allowed: email, roles")
+	assert.Empty(t, recorder.calls, "A strict mask should send nothing when updates are not allowed")
+
+	assert.NoError(t, db.UpdateAllowed(ctx, user, updates, []string{}))
+	assert.Empty(t, recorder.calls, "Dropping every update should send nothing")
+	assert.Error(t, db.UpdateAllowed(ctx, user, []firestore.Update{{Value: 1}}, []string{"name"}))
+	assert.ErrorIs(t, db.WithReadOnly().UpdateAllowed(ctx, user, updates, []string{"name"}), fireorm.ErrReadOnly)
+}
@@ -0,0 +1,366 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+type Ticket struct {
+	ID    string `firestore:"id"`
+	Title string `firestore:"title"`
+}
+
+type Patient struct {
+	ID   string `firestore:"-"`
+	Name string `firestore:"name"`
+	SSN  string `firestore:"ssn" fireorm:"ssn,encrypted"`
+}
+
+// reverseCodec is a reversible stand-in for an encryption codec.
+var reverseCodec = fireorm.Codec{
+	Encode: func(value interface{}) (interface{}, error) {
+		return "enc:" + reverse(value.(string)), nil
+	},
+	Decode: func(value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok || !strings.HasPrefix(s, "enc:") {
+			return nil, fmt.Errorf("unexpected stored value %v", value)
+		}
+		return reverse(strings.TrimPrefix(s, "enc:")), nil
+	},
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+type Address struct {
+	Street string `firestore:"street"`
+	City   string `firestore:"city"`
+}
+
+type Event struct {
+	ID        string    `firestore:"-"`
+	Name      string    `firestore:"name,omitempty"`
+	CreatedAt time.Time `firestore:"createdAt,serverTimestamp"`
+}
+
+type Contact struct {
+	ID        string             `firestore:"-"`
+	Name      string             `firestore:"name"`
+	Addresses map[string]Address `firestore:"addresses"`
+}
+
+func TestStructToMap(t *testing.T) {
+	t.Run("Map of Structs", func(t *testing.T) {
+		contact := &Contact{
+			Name: "Mapped",
+			Addresses: map[string]Address{
+				"home": {Street: "1 Main St", City: "Springfield"},
+				"work": {Street: "2 Side St", City: "Shelbyville"},
+			},
+		}
+		data, err := fireorm.StructToMap(contact)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"home": map[string]interface{}{"street": "1 Main St", "city": "Springfield"},
+			"work": map[string]interface{}{"street": "2 Side St", "city": "Shelbyville"},
+		}, data["addresses"])
+	})
+
+	t.Run("Nil Map of Structs", func(t *testing.T) {
+		data, err := fireorm.StructToMap(&Contact{Name: "Empty"})
+		assert.NoError(t, err)
+		assert.Nil(t, data["addresses"])
+	})
+}
+
+func TestCompareValues(t *testing.T) {
+	now := time.Now()
+
+	cmp, err := fireorm.CompareValues(int64(3), 2.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cmp)
+
+	cmp, err = fireorm.CompareValues(2, int64(2))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cmp)
+
+	// Adjacent int64 versions above 2^53 collapse to the same float64
+	cmp, err = fireorm.CompareValues(int64(1700000000000000001), int64(1700000000000000000))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cmp)
+
+	cmp, err = fireorm.CompareValues(uint64(1<<63), int64(1<<62))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cmp)
+
+	cmp, err = fireorm.CompareValues(int64(-1), uint64(0))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, cmp)
+
+	cmp, err = fireorm.CompareValues(now, now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, cmp)
+
+	_, err = fireorm.CompareValues(now, 1)
+	assert.Error(t, err)
+
+	_, err = fireorm.CompareValues("a", "b")
+	assert.Error(t, err)
+}
+
+func TestStructToMapNilSlices(t *testing.T) {
+	nilTags := &Article{Title: "Nil"}
+	emptyTags := &Article{Title: "Empty", Tags: []string{}}
+	populatedTags := &Article{Title: "Populated", Tags: []string{"go"}}
+
+	t.Run("Default Stores Null", func(t *testing.T) {
+		data, err := fireorm.StructToMap(nilTags)
+		assert.NoError(t, err)
+		assert.Contains(t, data, "tags")
+		assert.Nil(t, data["tags"])
+
+		data, err = fireorm.StructToMap(emptyTags)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{}, data["tags"])
+	})
+
+	t.Run("Omit", func(t *testing.T) {
+		opts := fireorm.EncodeOptions{NilSlices: fireorm.NilSliceOmit}
+		data, err := fireorm.StructToMapWithOptions(nilTags, opts)
+		assert.NoError(t, err)
+		assert.NotContains(t, data, "tags")
+
+		data, err = fireorm.StructToMapWithOptions(emptyTags, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{}, data["tags"])
+	})
+
+	t.Run("As Empty", func(t *testing.T) {
+		opts := fireorm.EncodeOptions{NilSlices: fireorm.NilSliceAsEmpty}
+		data, err := fireorm.StructToMapWithOptions(nilTags, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{}, data["tags"])
+	})
+
+	t.Run("Populated Unchanged", func(t *testing.T) {
+		for _, mode := range []fireorm.NilSliceMode{fireorm.NilSliceAsNull, fireorm.NilSliceOmit, fireorm.NilSliceAsEmpty} {
+			data, err := fireorm.StructToMapWithOptions(populatedTags, fireorm.EncodeOptions{NilSlices: mode})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"go"}, data["tags"])
+		}
+	})
+}
+
+func TestStructToMapTagOptions(t *testing.T) {
+	data, err := fireorm.StructToMap(&Event{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"createdAt": firestore.ServerTimestamp}, data)
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	data, err = fireorm.StructToMap(&Event{Name: "Launch", CreatedAt: createdAt})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Launch", "createdAt": createdAt}, data)
+}
+
+func TestPendingServerTimestamps(t *testing.T) {
+	assert.Equal(t, []string{"CreatedAt"}, fireorm.PendingServerTimestamps(&Event{}))
+	assert.Empty(t, fireorm.PendingServerTimestamps(&Event{CreatedAt: time.Now()}))
+	assert.Empty(t, fireorm.PendingServerTimestamps(&User{}))
+}
+
+func TestStructToMapTimeTruncation(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	event := Event{Name: "Precise", CreatedAt: createdAt}
+
+	data, err := fireorm.StructToMap(event)
+	assert.NoError(t, err)
+	assert.Equal(t, createdAt, data["createdAt"], "Times are kept as is by default")
+
+	data, err = fireorm.StructToMapWithOptions(event, fireorm.EncodeOptions{TruncateTimes: true})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC), data["createdAt"])
+}
+
+func TestStructToMapFieldCodec(t *testing.T) {
+	patient := Patient{Name: "Jane", SSN: "123-45-6789"}
+
+	data, err := fireorm.StructToMapWithOptions(patient, fireorm.EncodeOptions{FieldCodec: &reverseCodec})
+	assert.NoError(t, err)
+	assert.Equal(t, "enc:9876-54-321", data["ssn"])
+	assert.Equal(t, "Jane", data["name"], "Fields that are not encrypted should be untouched")
+
+	_, err = fireorm.StructToMap(patient)
+	assert.Error(t, err, "Encrypted fields must not be written without a codec")
+}
+
+func TestStructToMapStripID(t *testing.T) {
+	ticket := Ticket{ID: "ticket1", Title: "Broken build"}
+
+	data, err := fireorm.StructToMap(ticket)
+	assert.NoError(t, err)
+	assert.Equal(t, "ticket1", data["id"], "Tagged ID fields are stored by default")
+
+	data, err = fireorm.StructToMapWithOptions(ticket, fireorm.EncodeOptions{StripID: true})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"title": "Broken build"}, data)
+
+	data, err = fireorm.StructToMapWithOptions(Note{DocID: "note1", Text: "Tagged"}, fireorm.EncodeOptions{StripID: true})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"text": "Tagged"}, data)
+}
+
+// Subscriber stores its email and aliases lowercased.
+type Subscriber struct {
+	ID      string   `firestore:"-"`
+	Name    string   `firestore:"name"`
+	Email   string   `firestore:"email" fireorm:"email,lowercase"`
+	Aliases []string `firestore:"aliases" fireorm:"lowercase"`
+}
+
+func TestStructToMapLowercase(t *testing.T) {
+	subscriber := Subscriber{Name: "Ada", Email: "Ada.Lovelace@Example.COM", Aliases: []string{"ADA@example.com"}}
+
+	data, err := fireorm.StructToMap(subscriber)
+	assert.NoError(t, err)
+	assert.Equal(t, "ada.lovelace@example.com", data["email"])
+	assert.Equal(t, []interface{}{"ada@example.com"}, data["aliases"])
+	assert.Equal(t, "Ada", data["name"], "Fields without the option should keep their case")
+}
+
+// Report stores its payload and body gzip-compressed.
+type Report struct {
+	ID      string `firestore:"-"`
+	Payload []byte `firestore:"payload" fireorm:"payload,gzip"`
+	Body    string `firestore:"body" fireorm:"gzip"`
+}
+
+func TestStructToMapGzip(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"event":"click","count":1}`, 1000))
+	data, err := fireorm.StructToMap(Report{Payload: payload, Body: string(payload)})
+	assert.NoError(t, err)
+
+	for _, field := range []string{"payload", "body"} {
+		compressed, ok := data[field].([]byte)
+		if assert.True(t, ok, "%s should be stored as bytes", field) {
+			assert.Less(t, len(compressed), len(payload)/10, "%s should be stored compressed", field)
+			reader, err := gzip.NewReader(bytes.NewReader(compressed))
+			if assert.NoError(t, err) {
+				raw, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.Equal(t, payload, raw)
+			}
+		}
+	}
+
+	data, err = fireorm.StructToMap(Report{})
+	assert.NoError(t, err)
+	assert.Nil(t, data["payload"], "Empty values should be stored as is")
+	assert.Equal(t, "", data["body"])
+}
+
+type Leaderboard struct {
+	ID       string                  `firestore:"-"`
+	Scores   map[int]string          `firestore:"scores"`
+	Rounds   []map[uint8]int         `firestore:"rounds"`
+	Flags    map[bool]*Address       `firestore:"flags"`
+	Deadline map[time.Time]string    `firestore:"deadline"`
+	Nested   map[string]map[int]bool `firestore:"nested"`
+}
+
+func TestStructToMapMapKeys(t *testing.T) {
+	deadline := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	board := Leaderboard{
+		Scores:   map[int]string{1: "Alice", -2: "Bob"},
+		Rounds:   []map[uint8]int{{3: 30}},
+		Flags:    map[bool]*Address{true: {City: "Springfield"}},
+		Deadline: map[time.Time]string{deadline: "final"},
+		Nested:   map[string]map[int]bool{"a": {7: true}},
+	}
+
+	_, err := fireorm.StructToMap(board)
+	if assert.Error(t, err, "Non-string map keys should be rejected before writing") {
+		assert.Contains(t, err.Error(), "field Scores")
+		assert.Contains(t, err.Error(), "int keys")
+	}
+
+	data, err := fireorm.StructToMapWithOptions(board, fireorm.EncodeOptions{ConvertMapKeys: true})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"1": "Alice", "-2": "Bob"}, data["scores"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"3": 30}}, data["rounds"])
+	assert.Equal(t, map[string]interface{}{"true": map[string]interface{}{"street": "", "city": "Springfield"}}, data["flags"],
+		"Tagged struct values should be converted by their tags")
+	assert.Equal(t, map[string]interface{}{"2024-05-01T12:00:00Z": "final"}, data["deadline"], "Text marshalers should format keys")
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"7": true}}, data["nested"])
+
+	var decoded Leaderboard
+	assert.NoError(t, fireorm.DecodeMap(data, &decoded))
+	assert.Equal(t, board, decoded, "Converted keys should be parsed back")
+
+	err = fireorm.DecodeMap(map[string]interface{}{"scores": map[string]interface{}{"first": "Alice"}}, &decoded)
+	assert.Error(t, err, "Keys that do not parse should be rejected")
+
+	_, err = fireorm.StructToMapWithOptions(struct {
+		Weights map[float64]int `firestore:"weights"`
+	}{Weights: map[float64]int{0.5: 1}}, fireorm.EncodeOptions{ConvertMapKeys: true})
+	assert.Error(t, err, "Keys that cannot be formatted should be rejected")
+}
+
+func TestStructToMapHeldMapKeys(t *testing.T) {
+	type untyped struct {
+		Extra  interface{}            `firestore:"extra"`
+		Items  []interface{}          `firestore:"items"`
+		Fields map[string]interface{} `firestore:"fields"`
+	}
+	model := untyped{
+		Extra:  map[int]string{1: "one"},
+		Items:  []interface{}{"plain", map[int]bool{2: true}},
+		Fields: map[string]interface{}{"nested": []interface{}{map[bool]int{true: 3}}},
+	}
+
+	_, err := fireorm.StructToMap(model)
+	assert.ErrorContains(t, err, "int keys", "Non-string map keys held by interfaces should be rejected before writing")
+	_, err = fireorm.StructToMap(untyped{Items: model.Items})
+	assert.ErrorContains(t, err, "field Items")
+	_, err = fireorm.StructToMap(untyped{Fields: model.Fields})
+	assert.ErrorContains(t, err, "bool keys")
+
+	data, err := fireorm.StructToMapWithOptions(model, fireorm.EncodeOptions{ConvertMapKeys: true})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"1": "one"}, data["extra"])
+	assert.Equal(t, []interface{}{"plain", map[string]interface{}{"2": true}}, data["items"])
+	assert.Equal(t, map[string]interface{}{"nested": []interface{}{map[string]interface{}{"true": 3}}}, data["fields"])
+
+	data, err = fireorm.StructToMap(untyped{Items: []interface{}{"plain"}, Fields: map[string]interface{}{"a": 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"plain"}, data["items"], "String-keyed values should be stored as is")
+	assert.Equal(t, map[string]interface{}{"a": 1}, data["fields"])
+}
+
+func TestStructToMapExcludedFields(t *testing.T) {
+	user := User{ID: "user1", Name: "Alice", Email: "alice@example.com", Age: 30}
+
+	data, err := fireorm.StructToMapWithOptions(user, fireorm.EncodeOptions{ExcludedFields: []string{"Age", "email"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Alice"}, data, "Fields should be excluded by Go name and by tag name")
+
+	contact := Contact{Name: "Bob", Addresses: map[string]Address{"home": {Street: "Main", City: "Springfield"}}}
+	data, err = fireorm.StructToMapWithOptions(contact, fireorm.EncodeOptions{ExcludedFields: []string{"city"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"street": "Main", "city": "Springfield"}, data["addresses"].(map[string]interface{})["home"],
+		"Exclusions only apply to top-level fields")
+}
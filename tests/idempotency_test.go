@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveIdempotent(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	first := &User{Name: "Ingested", Email: "ingested@example.com", Age: 20}
+	err := db.SaveIdempotent(ctx, first, "event-1")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, first.ID)
+
+	retry := &User{Name: "Ingested", Email: "ingested@example.com", Age: 20}
+	err = db.SaveIdempotent(ctx, retry, "event-1")
+	assert.NoError(t, err, "A processed key should be skipped without error")
+	assert.Empty(t, retry.ID, "A skipped save should leave the model unchanged")
+
+	var users []User
+	err = db.FindAll(ctx, []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "ingested@example.com"}}}}, &users)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1, "Saving the same key twice should create one document")
+
+	record, err := client.Collection(fireorm.DefaultIdempotencyCollection).Doc("event-1").Get(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "users", record.Data()["collection"])
+		assert.Equal(t, first.ID, record.Data()["documentId"])
+	}
+
+	// Concurrent deliveries of the same key save once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, db.SaveIdempotent(ctx, &User{Name: "Concurrent", Email: "concurrent@example.com"}, "event-2"))
+		}()
+	}
+	wg.Wait()
+	users = nil
+	err = db.FindAll(ctx, []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "concurrent@example.com"}}}}, &users)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	custom := db.WithIdempotencyCollection("ingested_keys")
+	assert.Equal(t, "ingested_keys", custom.GetIdempotencyCollection())
+	err = custom.Model(&User{}).SaveIdempotent(ctx, &User{Name: "Custom"}, "event-1")
+	assert.NoError(t, err, "Keys should be scoped to the idempotency collection")
+	record, err = client.Collection("ingested_keys").Doc("event-1").Get(ctx)
+	assert.NoError(t, err)
+	assert.True(t, record.Exists())
+}
+
+func TestSaveIdempotentValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil)).Model(&User{})
+	assert.Equal(t, fireorm.DefaultIdempotencyCollection, db.GetIdempotencyCollection())
+
+	assert.Error(t, db.SaveIdempotent(ctx, &User{}, ""))
+	assert.Error(t, db.SaveIdempotent(ctx, &User{}, "a/b"), "Keys should be document IDs")
+	assert.Error(t, db.WithIdempotencyCollection("").SaveIdempotent(ctx, &User{}, "key"))
+	assert.ErrorIs(t, db.WithReadOnly().SaveIdempotent(ctx, &User{}, "key"), fireorm.ErrReadOnly)
+}
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUUIDGenerator(t *testing.T) {
+	generate := fireorm.UUIDGenerator()
+	uuidV4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := generate()
+		assert.Regexp(t, uuidV4, id)
+		assert.False(t, seen[id], "UUIDs should be unique")
+		seen[id] = true
+	}
+}
+
+func TestULIDGenerator(t *testing.T) {
+	generate := fireorm.ULIDGenerator()
+	ulid := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+	previous := generate()
+	assert.Regexp(t, ulid, previous)
+	for i := 0; i < 10000; i++ {
+		id := generate()
+		assert.Regexp(t, ulid, id)
+		if !assert.Greater(t, id, previous, "ULIDs generated in a row should be strictly increasing") {
+			break
+		}
+		previous = id
+	}
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseIndexRequired(t *testing.T) {
+	url := "https://console.firebase.google.com/v1/r/project/test-project/firestore/indexes?create_composite=ClRwcm9qZWN0cw"
+	// The error Firestore returns for a query without its composite index
+	missingIndex := status.Error(codes.FailedPrecondition, "The query requires an index. You can create it here: "+url)
+	queries := []fireorm.Query{
+		{OrderBy: []fireorm.OrderClause{{Field: "age", Direction: firestore.Desc}}},
+		{OrderBy: []fireorm.OrderClause{{Field: "name", Direction: firestore.Asc}}},
+	}
+
+	indexErr, ok := fireorm.ParseIndexRequired(missingIndex, queries)
+	assert.True(t, ok)
+	assert.Equal(t, url, indexErr.URL)
+	assert.Equal(t, []fireorm.OrderClause{
+		{Field: "age", Direction: firestore.Desc},
+		{Field: "name", Direction: firestore.Asc},
+	}, indexErr.OrderBy)
+	assert.ErrorIs(t, indexErr, missingIndex)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(errors.Unwrap(indexErr)))
+	assert.Contains(t, indexErr.Error(), "[age, name]")
+	assert.Contains(t, indexErr.Error(), url)
+
+	var asIndexErr *fireorm.ErrIndexRequired
+	wrapped := fmt.Errorf("listing users: %w", indexErr)
+	assert.True(t, errors.As(wrapped, &asIndexErr))
+	again, ok := fireorm.ParseIndexRequired(wrapped, nil)
+	assert.True(t, ok, "Already parsed errors should be found through wrapping")
+	assert.Same(t, indexErr, again)
+
+	_, ok = fireorm.ParseIndexRequired(status.Error(codes.FailedPrecondition, "transaction expired"), queries)
+	assert.False(t, ok, "Other failed preconditions are not index errors")
+	_, ok = fireorm.ParseIndexRequired(status.Error(codes.NotFound, url), queries)
+	assert.False(t, ok)
+	_, ok = fireorm.ParseIndexRequired(nil, queries)
+	assert.False(t, ok)
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
+)
+
+func TestModelIterator(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	for i := 0; i < 5; i++ {
+		err := db.Save(ctx, &User{Name: fmt.Sprintf("Iterated %d", i), Age: i})
+		assert.NoError(t, err)
+	}
+
+	it := db.Iterator(ctx, []fireorm.Query{
+		{OrderBy: []fireorm.OrderClause{{Field: "age", Direction: firestore.Asc}}},
+	})
+	defer it.Stop()
+
+	var names []string
+	for {
+		var user User
+		err := it.Next(&user)
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		assert.NotEmpty(t, user.ID, "Iterated models should have their ID set")
+		names = append(names, user.Name)
+	}
+	assert.Equal(t, []string{"Iterated 0", "Iterated 1", "Iterated 2", "Iterated 3", "Iterated 4"}, names)
+	assert.ErrorIs(t, it.Next(&User{}), iterator.Done, "Next should keep returning Done once exhausted")
+
+	invalid := db.Iterator(ctx, []fireorm.Query{{Limit: -5}})
+	defer invalid.Stop()
+	assert.Error(t, invalid.Next(&User{}), "Query errors should be returned by Next")
+}
+
+func TestDecodeErrorPolicy(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	for _, name := range []string{"Alice", "Bob"} {
+		assert.NoError(t, db.Save(ctx, &User{ID: name, Name: name, Age: 30}))
+	}
+	_, err := client.Collection("users").Doc("Broken").Set(ctx, map[string]interface{}{"name": "Broken", "age": "thirty"})
+	assert.NoError(t, err)
+
+	var users []User
+	err = db.FindAll(ctx, nil, &users)
+	assert.Error(t, err, "The default policy should fail on the malformed document")
+
+	users = nil
+	err = db.WithDecodeErrorPolicy(fireorm.DecodeErrorSkip).Model(&User{}).FindAll(ctx, nil, &users)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2, "The malformed document should be skipped")
+
+	users = nil
+	err = db.WithDecodeErrorPolicy(fireorm.DecodeErrorCollect).Model(&User{}).FindAll(ctx, nil, &users)
+	var partial *fireorm.ErrPartialDecode
+	if assert.ErrorAs(t, err, &partial) {
+		assert.Len(t, partial.Errors, 1)
+		assert.Contains(t, partial.Errors, "Broken")
+	}
+	assert.Len(t, users, 2, "The other documents should be stored")
+
+	for _, policy := range []fireorm.DecodeErrorPolicy{fireorm.DecodeErrorFail, fireorm.DecodeErrorSkip, fireorm.DecodeErrorCollect} {
+		it := db.WithDecodeErrorPolicy(policy).Model(&User{}).Iterator(ctx, nil)
+		decoded, failed := 0, 0
+		for {
+			var user User
+			err := it.Next(&user)
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				failed++
+				continue
+			}
+			decoded++
+		}
+		it.Stop()
+		assert.Equal(t, 2, decoded, "policy %d", policy)
+		if policy == fireorm.DecodeErrorFail {
+			assert.Equal(t, 1, failed, "Next should return the decode error")
+		} else {
+			assert.Zero(t, failed, "Next should pass over the malformed document")
+		}
+		if policy == fireorm.DecodeErrorCollect {
+			assert.ErrorAs(t, it.DecodeErrors(), &partial)
+		} else {
+			assert.NoError(t, it.DecodeErrors())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+type Book struct {
+	ID     string   `firestore:"-"`
+	Title  string   `firestore:"title"`
+	Author string   `firestore:"author"`
+	Genres []string `firestore:"genres"`
+}
+
+func (b *Book) SearchKeywords() []string {
+	return append(fireorm.KeywordPrefixes(b.Title), append([]string{b.Author}, b.Genres...)...)
+}
+
+func TestKeywordPrefixes(t *testing.T) {
+	assert.Equal(t, []string{"a", "ad", "ada", "l", "lo", "lov", "love"}, fireorm.KeywordPrefixes("Ada  LOVE", "ada"))
+	assert.Empty(t, fireorm.KeywordPrefixes(" "))
+	assert.Equal(t, []string{"é", "ét", "éte"}, fireorm.KeywordPrefixes("Éte"), "Prefixes should split runes, not bytes")
+}
+
+func TestStructToMapKeywords(t *testing.T) {
+	book := Book{Title: "Dune", Author: " Frank Herbert ", Genres: []string{"SF", "sf", ""}}
+	data, err := fireorm.StructToMap(book)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "du", "dun", "dune", "frank herbert", "sf"}, data[fireorm.KeywordsField],
+		"Keywords should be lowercased, trimmed and deduplicated")
+
+	data, err = fireorm.StructToMap(&Book{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, data[fireorm.KeywordsField], "Models without keywords should store an empty array")
+
+	assert.Equal(t, fireorm.Query{Where: []fireorm.WhereClause{{Field: fireorm.KeywordsField, Operator: "array-contains", Value: "dun"}}},
+		fireorm.KeywordQuery(" DUN "))
+	assert.Error(t, fireorm.ValidateModel(&struct {
+		Book
+		Keywords []string `firestore:"_keywords"`
+	}{}), "The keywords field should be reserved")
+}
+
+func TestSearchKeywords(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	books := fireorm.New(fireorm.NewConnection(client)).Model(&Book{})
+	dune := &Book{Title: "Dune Messiah", Author: "Frank Herbert", Genres: []string{"SF"}}
+	assert.NoError(t, books.Save(ctx, dune))
+	assert.NoError(t, books.Save(ctx, &Book{Title: "Emma", Author: "Jane Austen", Genres: []string{"Romance"}}))
+
+	doc, err := client.Collection("books").Doc(dune.ID).Get(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, doc.Data()[fireorm.KeywordsField], "mess", "Save should store the keywords")
+
+	var found []Book
+	assert.NoError(t, books.FindAll(ctx, []fireorm.Query{fireorm.KeywordQuery("Mess")}, &found))
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, dune.ID, found[0].ID)
+	}
+
+	dune.Title = "Children of Dune"
+	assert.NoError(t, books.Save(ctx, dune, "title"))
+	found = nil
+	assert.NoError(t, books.FindAll(ctx, []fireorm.Query{fireorm.KeywordQuery("children")}, &found))
+	assert.Len(t, found, 1, "Partial saves should rewrite the keywords")
+	found = nil
+	assert.NoError(t, books.WithStrictDecoding().FindAll(ctx, []fireorm.Query{fireorm.KeywordQuery("romance")}, &found))
+	assert.Len(t, found, 1, "The keywords field should not fail strict decoding")
+}
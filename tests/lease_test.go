@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// Job is claimed by workers through its lease.
+type Job struct {
+	ID         string     `firestore:"-"`
+	Payload    string     `firestore:"payload"`
+	LeaseUntil *time.Time `firestore:"leaseUntil"`
+}
+
+func TestClaim(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&Job{})
+	job := &Job{Payload: "send email"}
+	err := db.Save(ctx, job)
+	assert.NoError(t, err)
+
+	worker := &Job{ID: job.ID}
+	claimed, err := db.Claim(ctx, worker, "LeaseUntil", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, claimed, "An unclaimed job should be claimed")
+	assert.Equal(t, "send email", worker.Payload, "The claimed document should be loaded")
+	assert.NotNil(t, worker.LeaseUntil)
+
+	claimed, err = db.Claim(ctx, &Job{ID: job.ID}, "leaseUntil", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, claimed, "A freshly claimed job should not be claimed again")
+
+	expired := time.Now().Add(-time.Second)
+	err = db.Save(ctx, &Job{ID: job.ID, Payload: "send email", LeaseUntil: &expired})
+	assert.NoError(t, err)
+	results := make(chan bool, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := db.Claim(ctx, &Job{ID: job.ID}, "leaseUntil", time.Minute)
+			assert.NoError(t, err)
+			results <- claimed
+		}()
+	}
+	wg.Wait()
+	close(results)
+	winners := 0
+	for claimed := range results {
+		if claimed {
+			winners++
+		}
+	}
+	assert.Equal(t, 1, winners, "An expired lease should be claimed by exactly one worker")
+
+	_, err = db.Claim(ctx, &Job{ID: "missing"}, "leaseUntil", time.Minute)
+	assert.ErrorIs(t, err, fireorm.ErrNotFound)
+}
+
+func TestClaimValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil)).Model(&Job{})
+
+	_, err := db.Claim(ctx, &Job{ID: "job"}, "leaseUntil", 0)
+	assert.Error(t, err)
+	_, err = db.Claim(ctx, &Job{ID: "job"}, "Payload", time.Minute)
+	assert.Error(t, err, "The lease field should be a time")
+	_, err = db.Claim(ctx, &Job{ID: "job"}, "Missing", time.Minute)
+	assert.Error(t, err)
+	_, err = db.WithReadOnly().Claim(ctx, &Job{ID: "job"}, "leaseUntil", time.Minute)
+	assert.ErrorIs(t, err, fireorm.ErrReadOnly)
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingSink records the events emitted to it and writes transactional events to the "outbox" collection.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []fireorm.MutationEvent
+	err    error
+}
+
+func (s *recordingSink) Emit(ctx context.Context, event fireorm.MutationEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return s.err
+}
+
+func (s *recordingSink) OutboxCollection() string {
+	return "outbox"
+}
+
+func (s *recordingSink) last() fireorm.MutationEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) == 0 {
+		return fireorm.MutationEvent{}
+	}
+	return s.events[len(s.events)-1]
+}
+
+func TestMutationSink(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	sink := &recordingSink{}
+	db := fireorm.New(fireorm.NewConnection(client)).WithMutationSink(sink).Model(&User{})
+
+	user := &User{Name: "Mutated", Email: "mutated@example.com", Age: 30}
+	assert.NoError(t, db.Save(ctx, user))
+	event := sink.last()
+	assert.Equal(t, fireorm.MutationSave, event.Op)
+	assert.Equal(t, "users", event.Collection)
+	assert.Equal(t, user.ID, event.ID)
+	assert.Equal(t, "Mutated", event.Data["name"])
+
+	user.Age = 31
+	assert.NoError(t, db.Save(ctx, user, "age"))
+	event = sink.last()
+	assert.Equal(t, fireorm.MutationSave, event.Op)
+	assert.Equal(t, user.ID, event.ID)
+	assert.Len(t, event.Data, 1, "A partial save should report the saved fields")
+	assert.EqualValues(t, 31, event.Data["age"])
+
+	assert.NoError(t, db.Update(ctx, user, []firestore.Update{{Path: "name", Value: "Renamed"}}))
+	event = sink.last()
+	assert.Equal(t, fireorm.MutationUpdate, event.Op)
+	assert.Equal(t, user.ID, event.ID)
+	assert.Equal(t, map[string]interface{}{"name": "Renamed"}, event.Data)
+
+	other := &User{Name: "Other", Email: "other@example.com", Age: 30}
+	assert.NoError(t, db.Save(ctx, other))
+	emitted := len(sink.events)
+	err := db.Update(ctx, &User{}, []firestore.Update{{Path: "age", Value: 40}},
+		[]fireorm.Query{{Where: []fireorm.WhereClause{{Field: "age", Operator: ">=", Value: 30}}}})
+	assert.NoError(t, err)
+	if assert.Len(t, sink.events, emitted+2, "An update by query should report each document") {
+		ids := []string{sink.events[emitted].ID, sink.events[emitted+1].ID}
+		assert.ElementsMatch(t, []string{user.ID, other.ID}, ids)
+		assert.Equal(t, fireorm.MutationUpdate, sink.events[emitted].Op)
+	}
+
+	assert.NoError(t, db.Delete(ctx, other))
+	event = sink.last()
+	assert.Equal(t, fireorm.MutationDelete, event.Op)
+	assert.Equal(t, other.ID, event.ID)
+	assert.Nil(t, event.Data)
+
+	// Inside a transaction, events are written to the outbox instead of being emitted
+	emitted = len(sink.events)
+	var created *User
+	err = db.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+		created = &User{Name: "Transactional", Email: "tx@example.com"}
+		if err := tx.Model(&User{}).Save(ctx, created); err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Update(ctx, user, []firestore.Update{{Path: "age", Value: 50}}); err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Delete(ctx, user)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, sink.events, emitted, "Transactional mutations should not be emitted")
+
+	docs, err := client.Collection("outbox").Documents(ctx).GetAll()
+	assert.NoError(t, err)
+	ops := map[string]string{}
+	for _, doc := range docs {
+		ops[doc.Data()["op"].(string)] = doc.Data()["id"].(string)
+		assert.Equal(t, "users", doc.Data()["collection"])
+		assert.NotNil(t, doc.Data()["createdAt"])
+	}
+	assert.Equal(t, map[string]string{"save": created.ID, "update": user.ID, "delete": user.ID}, ops)
+
+	// A failing transaction leaves no event behind
+	failure := errors.New("rollback")
+	err = db.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+		if err := tx.Model(&User{}).Save(ctx, &User{Name: "Rolled back"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+	docs, err = client.Collection("outbox").Documents(ctx).GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, docs, 3)
+
+	// Sink errors are returned after the write
+	sink.err = errors.New("unavailable")
+	failed := &User{Name: "Unreported"}
+	assert.ErrorContains(t, db.Save(ctx, failed), "unavailable")
+	assert.NoError(t, db.GetByID(ctx, &User{ID: failed.ID}))
+}
+
+func TestMutationSinkFailedWrite(t *testing.T) {
+	ctx := context.Background()
+	client := newRecordingClient(t, &callRecorder{})
+	defer client.Close()
+
+	sink := &recordingSink{}
+	db := fireorm.New(fireorm.NewConnection(client)).WithMutationSink(sink).Model(&User{})
+	assert.Error(t, db.Save(ctx, &User{Name: "Failed"}))
+	assert.Error(t, db.Update(ctx, &User{ID: "user-1"}, []firestore.Update{{Path: "name", Value: "Failed"}}))
+	assert.Error(t, db.Delete(ctx, &User{ID: "user-1"}))
+	assert.Empty(t, sink.events, "Failed writes should not be reported")
+
+	assert.Error(t, db.WithMutationSink(nil).Save(ctx, &User{Name: "Unreported"}))
+	assert.Empty(t, sink.events)
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	articles := fireorm.New(fireorm.NewConnection(client)).Model(&Article{})
+	titles := map[string]string{}
+	for i := 0; i < 7; i++ {
+		article := &Article{Title: fmt.Sprintf("Article %d", i), Tags: []string{"exported"}}
+		err := articles.Save(ctx, article)
+		assert.NoError(t, err)
+		titles[article.ID] = article.Title
+	}
+
+	var buf bytes.Buffer
+	exported, err := articles.Export(ctx, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, exported)
+
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		var item map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &item))
+		id, _ := item["id"].(string)
+		assert.Equal(t, titles[id], item["title"], "Each line should hold the document ID and data")
+		assert.Equal(t, []interface{}{"exported"}, item["tags"])
+		lines++
+	}
+	assert.Equal(t, 7, lines)
+
+	buf.Reset()
+	exported, err = articles.Export(ctx, &buf, []fireorm.Query{{
+		Where: []fireorm.WhereClause{{Field: "title", Operator: ">=", Value: "Article 3"}},
+		Limit: 2,
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, exported, "Queries and limits should apply to the export")
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	input := strings.Join([]string{
+		`{"id": "a1", "title": "First", "tags": ["imported"]}`,
+		``,
+		`{"id": "a2", "title": "Second", "tags": []}`,
+		`{"title": "No ID"}`,
+		`{"id": "a3", "title": `,
+		`{"id": "a4", "title": 4}`,
+		`{"id": "a5", "title": "Last", "unknown": true}`,
+	}, "\n")
+	articles := fireorm.New(fireorm.NewConnection(client)).Model(&Article{})
+	imported, err := articles.Import(ctx, strings.NewReader(input))
+	assert.Equal(t, 3, imported)
+	assert.Error(t, err, "Malformed lines should be reported")
+	for _, line := range []string{"line 4:", "line 5:", "line 6:"} {
+		assert.Contains(t, err.Error(), line)
+	}
+
+	article := &Article{ID: "a1"}
+	assert.NoError(t, articles.GetByID(ctx, article))
+	assert.Equal(t, "First", article.Title)
+	assert.Equal(t, []string{"imported"}, article.Tags)
+	doc, err := client.Collection("articles").Doc("a5").Get(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "Last", doc.Data()["title"])
+	assert.NotContains(t, doc.Data(), "unknown", "Fields the model does not declare should be dropped")
+	_, err = client.Collection("articles").Doc("a4").Get(ctx)
+	assert.True(t, fireorm.IsNotFoundError(err), "Malformed lines should be skipped")
+
+	var buf bytes.Buffer
+	exported, err := articles.Export(ctx, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, exported)
+	resetFirestoreEmulator(ctx, client)
+	imported, err = articles.Import(ctx, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, imported, "Exported documents should import back")
+}
+
+func TestImportValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil)).Model(&Article{})
+	_, err := db.WithReadOnly().Import(ctx, strings.NewReader(`{"id": "a1"}`))
+	assert.ErrorIs(t, err, fireorm.ErrReadOnly)
+}
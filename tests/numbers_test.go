@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+type Setting struct {
+	ID    string                 `firestore:"-"`
+	Name  string                 `firestore:"name"`
+	Value interface{}            `firestore:"value"`
+	Extra map[string]interface{} `firestore:"extra"`
+}
+
+func TestNumberNormalization(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	settings := fireorm.New(fireorm.NewConnection(client)).Model(&Setting{})
+	setting := &Setting{
+		Name:  "limits",
+		Value: 3,
+		Extra: map[string]interface{}{
+			"max":    10,
+			"ratio":  0.5,
+			"whole":  2.0,
+			"label":  "default",
+			"nested": map[string]interface{}{"min": 1, "steps": []interface{}{1, 2, 3}},
+		},
+	}
+	assert.NoError(t, settings.Save(ctx, setting))
+
+	read := &Setting{ID: setting.ID}
+	assert.NoError(t, settings.GetByID(ctx, read))
+	assert.Equal(t, int64(3), read.Value, "Integers should read back as int64 by default")
+	assert.Equal(t, int64(10), read.Extra["max"])
+	assert.Equal(t, 0.5, read.Extra["ratio"])
+	assert.Equal(t, 2.0, read.Extra["whole"])
+	nested, _ := read.Extra["nested"].(map[string]interface{})
+	assert.Equal(t, int64(1), nested["min"])
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3)}, nested["steps"])
+
+	normalized := &Setting{ID: setting.ID}
+	assert.NoError(t, settings.WithNumberNormalization().GetByID(ctx, normalized))
+	assert.Equal(t, 3, normalized.Value, "Normalized integers should read back as int")
+	assert.Equal(t, setting.Extra, normalized.Extra, "Maps of ints should round-trip under normalization")
+	assert.IsType(t, float64(0), normalized.Extra["whole"], "Integral floats should stay float64")
+
+	var found []Setting
+	assert.NoError(t, settings.WithNumberNormalization().FindAll(ctx, nil, &found))
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, 10, found[0].Extra["max"], "Normalization should apply to queries too")
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitions(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	articles := fireorm.New(fireorm.NewConnection(client)).Model(&Article{})
+	for i := 0; i < 60; i++ {
+		assert.NoError(t, articles.Save(ctx, &Article{Title: fmt.Sprintf("Article %d", i)}))
+	}
+
+	partitions, err := articles.Partitions(ctx, 4)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, partitions)
+	assert.LessOrEqual(t, len(partitions), 4)
+	assert.Nil(t, partitions[0].StartAt, "The first partition should be open at the start")
+	assert.Nil(t, partitions[len(partitions)-1].EndBefore, "The last partition should be open at the end")
+
+	results := make([][]Article, len(partitions))
+	errs := make([]error, len(partitions))
+	var wg sync.WaitGroup
+	for i, partition := range partitions {
+		wg.Add(1)
+		go func(i int, partition fireorm.Query) {
+			defer wg.Done()
+			errs[i] = articles.FindAll(ctx, []fireorm.Query{partition}, &results[i])
+		}(i, partition)
+	}
+	wg.Wait()
+
+	seen := map[string]int{}
+	for i := range partitions {
+		assert.NoError(t, errs[i])
+		for _, article := range results[i] {
+			seen[article.ID]++
+		}
+	}
+	assert.Len(t, seen, 60, "Partitions should cover every document")
+	for id, count := range seen {
+		assert.Equal(t, 1, count, "Document %s should belong to a single partition", id)
+	}
+
+	single, err := articles.Partitions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []fireorm.Query{{}}, single, "A single partition should cover the whole collection")
+}
+
+func TestPartitionsValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil))
+	_, err := db.Model(&Article{}).Partitions(ctx, 0)
+	assert.Error(t, err, "The desired count should be positive")
+	_, err = db.Partitions(ctx, 2)
+	assert.Error(t, err, "A model should be required")
+}
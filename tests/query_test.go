@@ -0,0 +1,291 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixWhere(t *testing.T) {
+	clauses := fireorm.PrefixWhere("name", "Jo")
+	assert.Equal(t, []fireorm.WhereClause{
+		{Field: "name", Operator: ">=", Value: "Jo"},
+		{Field: "name", Operator: "<", Value: "Jo\uf8ff"},
+	}, clauses)
+}
+
+func TestApplyQueriesLimit(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	base, err := db.RawQuery(ctx)
+	assert.NoError(t, err)
+
+	t.Run("Unspecified", func(t *testing.T) {
+		q, err := db.ApplyQueries(ctx, base, []fireorm.Query{{Limit: 0}})
+		assert.NoError(t, err)
+		assert.Equal(t, base, q)
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		q, err := db.ApplyQueries(ctx, base, []fireorm.Query{{Limit: fireorm.QueryLimitUnlimited}})
+		assert.NoError(t, err)
+		assert.Equal(t, base, q)
+	})
+
+	t.Run("Positive", func(t *testing.T) {
+		q, err := db.ApplyQueries(ctx, base, []fireorm.Query{{Limit: 5}})
+		assert.NoError(t, err)
+		assert.Equal(t, base.Limit(5), q)
+		assert.NotEqual(t, base, q)
+	})
+
+	t.Run("Invalid Negative", func(t *testing.T) {
+		_, err := db.ApplyQueries(ctx, base, []fireorm.Query{{Limit: -2}})
+		assert.Error(t, err)
+	})
+}
+
+func TestApplyQueriesAndSemantics(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	base, err := db.RawQuery(ctx)
+	assert.NoError(t, err)
+
+	split, err := db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "age", Operator: ">", Value: 30}}},
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Alice"}}},
+	})
+	assert.NoError(t, err)
+
+	combined, err := db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{
+			{Field: "age", Operator: ">", Value: 30},
+			{Field: "name", Operator: "==", Value: "Alice"},
+		}},
+	})
+	assert.NoError(t, err)
+
+	expected := base.Where("age", ">", 30).Where("name", "==", "Alice")
+	assert.Equal(t, expected, split)
+	assert.Equal(t, expected, combined)
+}
+
+func TestApplyQueriesCursorTiebreaker(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	base, err := db.RawQuery(ctx)
+	assert.NoError(t, err)
+
+	t.Run("Appended With Cursor", func(t *testing.T) {
+		q, err := db.ApplyQueries(ctx, base, []fireorm.Query{{
+			OrderBy:    []fireorm.OrderClause{{Field: "age", Direction: firestore.Desc}},
+			StartAfter: []interface{}{30, "user-id"},
+		}})
+		assert.NoError(t, err)
+		expected := base.OrderBy("age", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc).StartAfter(30, "user-id")
+		assert.Equal(t, expected, q)
+	})
+
+	t.Run("Not Duplicated", func(t *testing.T) {
+		q, err := db.ApplyQueries(ctx, base, []fireorm.Query{{
+			OrderBy: []fireorm.OrderClause{
+				{Field: "age", Direction: firestore.Asc},
+				{Field: firestore.DocumentID, Direction: firestore.Asc},
+			},
+			EndBefore: []interface{}{30},
+		}})
+		assert.NoError(t, err)
+		expected := base.OrderBy("age", firestore.Asc).OrderBy(firestore.DocumentID, firestore.Asc).EndBefore(30)
+		assert.Equal(t, expected, q)
+	})
+
+	t.Run("Not Appended Without Cursor", func(t *testing.T) {
+		q, err := db.ApplyQueries(ctx, base, []fireorm.Query{{
+			OrderBy: []fireorm.OrderClause{{Field: "age", Direction: firestore.Asc}},
+		}})
+		assert.NoError(t, err)
+		assert.Equal(t, base.OrderBy("age", firestore.Asc), q)
+	})
+}
+
+func TestApplyQueriesSingleDisjunction(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	base, err := db.RawQuery(ctx)
+	assert.NoError(t, err)
+
+	_, err = db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{
+			{Field: "name", Operator: "in", Value: []string{"Alice", "Bob"}},
+			{Field: "age", Operator: "in", Value: []int{30, 40}},
+		}},
+	})
+	assert.EqualError(t, err, `a query can contain at most one 'in' or 'array-contains-any' clause, found "in" on name and "in" on age`)
+
+	_, err = db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "in", Value: []string{"Alice"}}}},
+		{Where: []fireorm.WhereClause{{Field: "tags", Operator: "array-contains-any", Value: []string{"go"}}}},
+	})
+	assert.Error(t, err, "Clauses from separate query entries are combined into one query")
+
+	q, err := db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{
+			{Field: "status", Operator: "in", Value: []string{"active", "pending"}},
+			{Field: "tenant", Operator: "==", Value: "acme"},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.Where("status", "in", []string{"active", "pending"}).Where("tenant", "==", "acme"), q)
+}
+
+func TestApplyQueriesNestedFields(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&Catalog{})
+	base, err := db.RawQuery(ctx)
+	assert.NoError(t, err)
+
+	q, err := db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "tags.items", Operator: "array-contains", Value: "go"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.WherePath(firestore.FieldPath{"tags", "items"}, "array-contains", "go"), q,
+		"Dotted fields should address nested fields")
+
+	q, err = db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{FieldPath: firestore.FieldPath{"labels", "v1.0"}, Operator: "array-contains", Value: "stable"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.WherePath(firestore.FieldPath{"labels", "v1.0"}, "array-contains", "stable"), q)
+}
+
+func TestApplyQueriesStructValues(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&Contact{})
+	base, err := db.RawQuery(ctx)
+	assert.NoError(t, err)
+	home := Address{Street: "Main", City: "Springfield"}
+	stored := map[string]interface{}{"street": "Main", "city": "Springfield"}
+
+	q, err := db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "addresses.home", Operator: "==", Value: home}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.WherePath(firestore.FieldPath{"addresses", "home"}, "==", stored), q,
+		"Struct values should be converted like the stored data")
+
+	q, err = db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "addresses.home", Operator: "in", Value: []*Address{&home, nil}}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.WherePath(firestore.FieldPath{"addresses", "home"}, "in", []interface{}{stored, nil}), q)
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	q, err = db.WithTimeTruncation(true).ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "createdAt", Operator: ">=", Value: createdAt}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.Where("createdAt", ">=", createdAt.Truncate(time.Microsecond)), q)
+
+	q, err = db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Bob"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.Where("name", "==", "Bob"), q, "Other values should be unchanged")
+}
+
+func TestApplyQueriesTimeValues(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&Event{})
+	base, err := db.RawQuery(ctx)
+	assert.NoError(t, err)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	want := base.Where("createdAt", ">=", start).Where("createdAt", "<", end)
+
+	inputs := map[string][2]interface{}{
+		"times":        {start, end},
+		"RFC 3339":     {"2024-01-01T00:00:00Z", "2024-02-01T00:00:00Z"},
+		"Unix seconds": {start.Unix(), int(end.Unix())},
+		"float Unix":   {float64(start.Unix()), float64(end.Unix())},
+	}
+	for name, bounds := range inputs {
+		t.Run(name, func(t *testing.T) {
+			q, err := db.ApplyQueries(ctx, base, []fireorm.Query{{Where: []fireorm.WhereClause{
+				{Field: "createdAt", Operator: ">=", Value: bounds[0]},
+				{Field: "createdAt", Operator: "<", Value: bounds[1]},
+			}}})
+			assert.NoError(t, err)
+			assert.Equal(t, want, q)
+		})
+	}
+
+	q, err := db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "createdAt", Operator: "in", Value: []interface{}{"2024-01-01T00:00:00Z", start.Unix()}}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.Where("createdAt", "in", []interface{}{start, start}), q, "Slices should be converted element by element")
+
+	_, err = db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "createdAt", Operator: ">=", Value: "last week"}}},
+	})
+	assert.ErrorContains(t, err, "invalid value for time field createdAt")
+	_, err = db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "createdAt", Operator: ">=", Value: true}}},
+	})
+	assert.Error(t, err)
+
+	q, err = db.ApplyQueries(ctx, base, []fireorm.Query{
+		{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "2024-01-01T00:00:00Z"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, base.Where("name", "==", "2024-01-01T00:00:00Z"), q, "Other fields should be unchanged")
+}
+
+func TestApplyQueriesLowercaseFields(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&Subscriber{})
+	base, err := db.RawQuery(ctx)
+	assert.NoError(t, err)
+
+	q, err := db.ApplyQueries(ctx, base, []fireorm.Query{{Where: []fireorm.WhereClause{
+		{Field: "email", Operator: "==", Value: "ADA@Example.com"},
+		{Field: "name", Operator: "==", Value: "Ada"},
+	}}})
+	assert.NoError(t, err)
+	assert.Equal(t, base.Where("email", "==", "ada@example.com").Where("name", "==", "Ada"), q,
+		"Values compared with lowercase fields should be lowercased")
+
+	q, err = db.ApplyQueries(ctx, base, []fireorm.Query{{Where: []fireorm.WhereClause{
+		{Field: "aliases", Operator: "array-contains-any", Value: []string{"A@X.com", "b@x.com"}},
+	}}})
+	assert.NoError(t, err)
+	assert.Equal(t, base.Where("aliases", "array-contains-any", []interface{}{"a@x.com", "b@x.com"}), q)
+}
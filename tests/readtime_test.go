@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadTime(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	base := fireorm.New(fireorm.NewConnection(client))
+	user := &User{Name: "Before", Email: "before@example.com", Age: 30}
+	assert.NoError(t, base.Model(&User{}).Save(ctx, user))
+	article := &Article{Title: "Before", Tags: []string{"report"}}
+	assert.NoError(t, base.Model(&Article{}).Save(ctx, article))
+
+	// Read times are truncated to the second, so move past the second of the writes before taking the snapshot
+	time.Sleep(time.Second)
+	report := base.WithReadTime(time.Now())
+
+	user.Name = "After"
+	assert.NoError(t, base.Model(&User{}).Save(ctx, user))
+	article.Title = "After"
+	assert.NoError(t, base.Model(&Article{}).Save(ctx, article))
+
+	reportedUser := &User{ID: user.ID}
+	assert.NoError(t, report.Model(&User{}).GetByID(ctx, reportedUser))
+	assert.Equal(t, "Before", reportedUser.Name, "Reads should see the state at the read time")
+
+	var reportedArticles []Article
+	assert.NoError(t, report.Model(&Article{}).GetByIDs(ctx, []string{article.ID, "missing"}, &reportedArticles))
+	if assert.Len(t, reportedArticles, 1) {
+		assert.Equal(t, "Before", reportedArticles[0].Title, "Derived instances should share the read time")
+	}
+
+	latest := &User{ID: user.ID}
+	assert.NoError(t, base.Model(&User{}).GetByID(ctx, latest))
+	assert.Equal(t, "After", latest.Name, "The base instance should read the latest data")
+}
+
+func TestReadTimeQueries(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	readTime := time.Date(2024, 5, 1, 12, 30, 15, 500, time.UTC)
+	report := fireorm.New(fireorm.NewConnection(client)).WithReadTime(readTime)
+	users := report.Model(&User{})
+	assert.Equal(t, readTime.Truncate(time.Second), users.GetReadTime(), "Model should keep the read time")
+
+	var found []User
+	err := users.FindAll(ctx, nil, &found)
+	assert.ErrorIs(t, err, fireorm.ErrReadTimeQuery, "Queries cannot be read at a read time")
+	_, err = users.Count(ctx, nil)
+	assert.ErrorIs(t, err, fireorm.ErrReadTimeQuery)
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
+)
+
+// RegisteredItem is configured with RegisterModel rather than tags or methods.
+type RegisteredItem struct {
+	Key       string     `firestore:"-"`
+	Name      string     `firestore:"name"`
+	CreatedAt time.Time  `firestore:"createdAt"`
+	UpdatedAt time.Time  `firestore:"updatedAt"`
+	DeletedAt *time.Time `firestore:"deletedAt"`
+}
+
+func init() {
+	err := fireorm.RegisterModel(&RegisteredItem{}, fireorm.ModelConfig{
+		CollectionName:  "registered_items",
+		IDField:         "Key",
+		CreatedAtField:  "CreatedAt",
+		UpdatedAtField:  "UpdatedAt",
+		SoftDeleteField: "DeletedAt",
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterModel(t *testing.T) {
+	client := createFirestoreClient()
+	defer client.Close()
+	db := fireorm.New(fireorm.NewConnection(client))
+
+	colName, err := db.Model(&RegisteredItem{}).CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "registered_items", colName)
+	colName, err = db.WithCollectionPrefix("test_").Model(&RegisteredItem{}).CollectionName()
+	assert.NoError(t, err)
+	assert.Equal(t, "test_registered_items", colName, "Prefixes should still apply")
+
+	item := &RegisteredItem{}
+	fireorm.SetIDField(item, "item-1")
+	assert.Equal(t, "item-1", item.Key)
+	ref, err := db.Model(item).DocRef(item)
+	assert.NoError(t, err)
+	assert.Equal(t, "item-1", ref.ID)
+	assert.Equal(t, "registered_items", ref.Parent.ID)
+
+	omitted := &struct {
+		DeletedAt *time.Time `firestore:"deletedAt,omitempty"`
+	}{}
+	invalid := map[string]struct {
+		model  interface{}
+		config fireorm.ModelConfig
+	}{
+		"missing ID field":         {&RegisteredItem{}, fireorm.ModelConfig{IDField: "Missing"}},
+		"non-string ID field":      {&RegisteredItem{}, fireorm.ModelConfig{IDField: "CreatedAt"}},
+		"non-time timestamp":       {&RegisteredItem{}, fireorm.ModelConfig{UpdatedAtField: "Name"}},
+		"non-pointer soft delete":  {&RegisteredItem{}, fireorm.ModelConfig{SoftDeleteField: "CreatedAt"}},
+		"omitted soft-delete time": {omitted, fireorm.ModelConfig{SoftDeleteField: "DeletedAt"}},
+		"not a struct":             {"items", fireorm.ModelConfig{}},
+	}
+	for name, tc := range invalid {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, fireorm.RegisterModel(tc.model, tc.config))
+		})
+	}
+}
+
+func TestRegisteredModelOperations(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&RegisteredItem{})
+	item := &RegisteredItem{Name: "First"}
+	err := db.Save(ctx, item)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, item.Key, "The generated ID should be set on the registered ID field")
+	assert.False(t, item.CreatedAt.IsZero())
+	assert.Equal(t, item.CreatedAt, item.UpdatedAt)
+	doc, err := client.Collection("registered_items").Doc(item.Key).Get(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "First", doc.Data()["name"])
+
+	created := item.CreatedAt
+	item.Name = "Renamed"
+	err = db.Save(ctx, item, "name")
+	assert.NoError(t, err)
+	loaded := &RegisteredItem{Key: item.Key}
+	err = db.GetByID(ctx, loaded)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed", loaded.Name)
+	assert.True(t, created.Equal(loaded.CreatedAt), "The creation time should be kept")
+	assert.True(t, loaded.UpdatedAt.After(created), "Saving selected fields should update the update time")
+
+	other := &RegisteredItem{Name: "Second"}
+	err = db.Save(ctx, other)
+	assert.NoError(t, err)
+	err = db.Delete(ctx, item)
+	assert.NoError(t, err)
+	var live []RegisteredItem
+	err = db.FindAll(ctx, nil, &live)
+	assert.NoError(t, err)
+	assert.Len(t, live, 1, "Soft-deleted documents should be filtered out")
+	assert.Equal(t, other.Key, live[0].Key)
+	doc, err = client.Collection("registered_items").Doc(item.Key).Get(ctx)
+	assert.NoError(t, err, "Soft-deleted documents should be kept")
+	assert.NotNil(t, doc.Data()["deletedAt"])
+
+	err = db.Delete(ctx, &RegisteredItem{Key: "missing"})
+	assert.NoError(t, err)
+	err = db.DeleteStrict(ctx, &RegisteredItem{Key: "missing"})
+	assert.ErrorIs(t, err, fireorm.ErrNotFound)
+}
+
+// Draft is soft-deleted with WithSoftDelete.
+type Draft struct {
+	ID        string     `firestore:"-"`
+	Title     string     `firestore:"title"`
+	DeletedAt *time.Time `firestore:"deletedAt"`
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).WithSoftDelete("deletedAt").Model(&Draft{})
+	draft := &Draft{Title: "Deleted"}
+	err := db.Save(ctx, draft)
+	assert.NoError(t, err)
+	err = db.Delete(ctx, draft)
+	assert.NoError(t, err)
+
+	err = db.GetByID(ctx, &Draft{ID: draft.ID})
+	assert.ErrorIs(t, err, fireorm.ErrNotFound, "Soft-deleted documents should not be found by ID")
+	_, err = db.GetByIDWithRaw(ctx, &Draft{ID: draft.ID})
+	assert.ErrorIs(t, err, fireorm.ErrNotFound)
+	var drafts []Draft
+	err = db.FindAll(ctx, nil, &drafts)
+	assert.NoError(t, err)
+	assert.Empty(t, drafts)
+
+	// Counts and the other reads exclude soft-deleted documents too
+	count, err := db.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, count, "Soft-deleted documents should not be counted")
+	count, err = db.CountUpTo(ctx, nil, 10)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+	results, err := db.Aggregate(ctx, nil, []fireorm.AggregateSpec{{Op: fireorm.AggregateCount, Alias: "count"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), results["count"])
+	data, err := db.FindAllJSON(ctx, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(t, "[]", string(data))
+	_, err = db.FindAllExplain(ctx, nil, &drafts)
+	assert.NoError(t, err)
+	assert.Empty(t, drafts)
+	var polys []interface{}
+	err = db.FindAllPoly(ctx, nil, "title", func(string) interface{} { return &Draft{} }, &polys)
+	assert.NoError(t, err)
+	assert.Empty(t, polys)
+	assert.ErrorIs(t, db.Iterator(ctx, nil).Next(&Draft{}), iterator.Done)
+
+	cached := db.WithQueryCache(newMemoryCache(), time.Minute).Model(&Draft{})
+	count, err = cached.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+	count, err = cached.Unscoped().Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count, "Unscoped counts should not share the cached count")
+
+	unscoped := db.Unscoped()
+	loaded := &Draft{ID: draft.ID}
+	err = unscoped.GetByID(ctx, loaded)
+	assert.NoError(t, err, "Unscoped reads should return soft-deleted documents")
+	assert.Equal(t, "Deleted", loaded.Title)
+	assert.NotNil(t, loaded.DeletedAt)
+	err = unscoped.FindAll(ctx, nil, &drafts)
+	assert.NoError(t, err)
+	assert.Len(t, drafts, 1)
+
+	err = unscoped.Delete(ctx, draft)
+	assert.NoError(t, err)
+	_, err = client.Collection("drafts").Doc(draft.ID).Get(ctx)
+	assert.True(t, fireorm.IsNotFoundError(err), "Unscoped deletes should be permanent")
+
+	live := &Draft{Title: "Live"}
+	err = db.Save(ctx, live)
+	assert.NoError(t, err)
+	err = db.GetByID(ctx, &Draft{ID: live.ID})
+	assert.NoError(t, err)
+}
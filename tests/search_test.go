@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchAcross(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client))
+	user := &User{Name: "Golang", Email: "gopher@example.com", Age: 13}
+	assert.NoError(t, db.Model(&User{}).Save(ctx, user))
+	assert.NoError(t, db.Model(&User{}).Save(ctx, &User{Name: "Rust", Email: "crab@example.com"}))
+	article := &Article{Title: "Golang", Tags: []string{"go"}}
+	assert.NoError(t, db.Model(&Article{}).Save(ctx, article))
+
+	var results []fireorm.SearchResult
+	err := db.SearchAcross(ctx, []fireorm.CollectionQuery{
+		{Model: &User{}, Queries: []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Golang"}}}}},
+		{Model: &Article{}, Queries: []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "title", Operator: "==", Value: "Golang"}}}}},
+	}, &results)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "users", results[0].Collection)
+		assert.Equal(t, user.ID, results[0].ID)
+		if found, ok := results[0].Model.(*User); assert.True(t, ok, "Users should be decoded into their model") {
+			assert.Equal(t, *user, *found)
+		}
+		assert.Equal(t, "articles", results[1].Collection)
+		assert.Equal(t, article.ID, results[1].ID)
+		if found, ok := results[1].Model.(*Article); assert.True(t, ok) {
+			assert.Equal(t, "Golang", found.Title)
+		}
+	}
+
+	err = db.SearchAcross(ctx, []fireorm.CollectionQuery{
+		{Model: &User{}, Queries: []fireorm.Query{{Where: []fireorm.WhereClause{{Field: "name", Operator: "==", Value: "Nobody"}}}}},
+	}, &results)
+	assert.NoError(t, err)
+	assert.Empty(t, results, "Results should be replaced")
+}
+
+func TestSearchAcrossValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil))
+
+	assert.Error(t, db.SearchAcross(ctx, []fireorm.CollectionQuery{{Model: &User{}}}, nil))
+	var results []fireorm.SearchResult
+	assert.Error(t, db.SearchAcross(ctx, []fireorm.CollectionQuery{{Queries: []fireorm.Query{{Limit: 1}}}}, &results),
+		"Every collection query should have a model")
+}
@@ -0,0 +1,31 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentTooLarge(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&Article{})
+
+	article := &Article{ID: "large", Title: strings.Repeat("x", fireorm.MaxDocumentSize), Tags: []string{"blob"}}
+	err := db.Save(ctx, article)
+	var tooLarge *fireorm.ErrDocumentTooLarge
+	assert.True(t, errors.As(err, &tooLarge), "Oversized documents should be rejected before the write")
+	assert.Equal(t, "articles/large", tooLarge.Path)
+	assert.Equal(t, "title", tooLarge.LargestField)
+	assert.Greater(t, tooLarge.Size, fireorm.MaxDocumentSize)
+	assert.ErrorContains(t, err, "document articles/large is too large")
+
+	_, err = db.SaveAll(ctx, []*Article{{Title: "Small"}, {Tags: []string{strings.Repeat("y", fireorm.MaxDocumentSize/2), strings.Repeat("z", fireorm.MaxDocumentSize/2)}}})
+	assert.True(t, errors.As(err, &tooLarge), "Batch writes should be checked too")
+	assert.Equal(t, "tags", tooLarge.LargestField)
+}
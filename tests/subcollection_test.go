@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// Order is an aggregate root whose line items are stored in its lineItems subcollection.
+type Order struct {
+	ID        string     `firestore:"-"`
+	Customer  string     `firestore:"customer"`
+	LineItems []LineItem `firestore:"-"`
+}
+
+type LineItem struct {
+	ID       string `firestore:"-"`
+	SKU      string `firestore:"sku"`
+	Quantity int    `firestore:"quantity"`
+}
+
+func TestGetAggregate(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&Order{})
+	assert.NoError(t, db.Save(ctx, &Order{ID: "order-1", Customer: "Ada"}))
+	lineItems := client.Collection("orders").Doc("order-1").Collection("lineItems")
+	for id, quantity := range map[string]int{"item-1": 2, "item-2": 1, "item-3": 5} {
+		_, err := lineItems.Doc(id).Set(ctx, map[string]interface{}{"sku": "sku-" + id, "quantity": quantity})
+		assert.NoError(t, err)
+	}
+
+	order := &Order{ID: "order-1", LineItems: []LineItem{{SKU: "stale"}}}
+	err := db.GetAggregate(ctx, order, []fireorm.SubcollectionSpec{{
+		Name:    "lineItems",
+		Field:   "LineItems",
+		Queries: []fireorm.Query{{OrderBy: []fireorm.OrderClause{{Field: "quantity", Direction: firestore.Desc}}}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada", order.Customer)
+	assert.Equal(t, []LineItem{
+		{ID: "item-3", SKU: "sku-item-3", Quantity: 5},
+		{ID: "item-1", SKU: "sku-item-1", Quantity: 2},
+		{ID: "item-2", SKU: "sku-item-2", Quantity: 1},
+	}, order.LineItems, "The line items should replace the field's elements")
+
+	empty := &Order{ID: "order-2"}
+	assert.NoError(t, db.Save(ctx, empty))
+	err = db.GetAggregate(ctx, empty, []fireorm.SubcollectionSpec{{Name: "lineItems", Field: "LineItems"}})
+	assert.NoError(t, err)
+	assert.Empty(t, empty.LineItems)
+
+	err = db.GetAggregate(ctx, &Order{ID: "missing"}, []fireorm.SubcollectionSpec{{Name: "lineItems", Field: "LineItems"}})
+	assert.Error(t, err, "A missing document should fail like GetByID")
+}
+
+func TestGetAggregateValidation(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil)).Model(&Order{})
+
+	invalid := map[string]fireorm.SubcollectionSpec{
+		"empty name":    {Field: "LineItems"},
+		"nested name":   {Name: "a/b", Field: "LineItems"},
+		"missing field": {Name: "lineItems", Field: "Items"},
+		"not a slice":   {Name: "lineItems", Field: "Customer"},
+	}
+	for name, spec := range invalid {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, db.GetAggregate(ctx, &Order{ID: "order-1"}, []fireorm.SubcollectionSpec{spec}))
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRunInTransaction(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+	resetFirestoreEmulator(ctx, client)
+
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	assert.Equal(t, fireorm.DefaultMaxTransactionRetries, db.GetMaxTransactionRetries())
+
+	user := &User{Name: "Contended", Email: "contended@example.com", Age: 1}
+	err := db.Save(ctx, user)
+	assert.NoError(t, err)
+
+	t.Run("Retries Aborted Attempts", func(t *testing.T) {
+		attempts := 0
+		err := db.WithMaxTransactionRetries(2).RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			attempts++
+			current := &User{ID: user.ID}
+			if err := tx.GetByID(ctx, current); err != nil {
+				return err
+			}
+			if attempts == 1 {
+				return status.Error(codes.Aborted, "simulated contention")
+			}
+			current.Age++
+			return tx.Save(ctx, current)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts, "The callback should be invoked again after an abort")
+
+		retrieved := &User{ID: user.ID}
+		err = db.GetByID(ctx, retrieved)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, retrieved.Age, "Only the successful attempt should be committed")
+	})
+
+	t.Run("Gives Up After Max Retries", func(t *testing.T) {
+		attempts := 0
+		err := db.WithMaxTransactionRetries(2).RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			attempts++
+			return status.Error(codes.Aborted, "simulated contention")
+		})
+		assert.Equal(t, codes.Aborted, status.Code(err))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Concurrent Read Modify Write", func(t *testing.T) {
+		counter := &User{Name: "Counter", Age: 0}
+		assert.NoError(t, db.Save(ctx, counter))
+
+		// Both first attempts read the document before either writes it, so one of them must be retried
+		var bothRead sync.WaitGroup
+		bothRead.Add(2)
+		var attempts atomic.Int32
+		increment := func() error {
+			first := true
+			return db.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+				attempts.Add(1)
+				current := &User{ID: counter.ID}
+				if err := tx.GetForUpdate(ctx, current); err != nil {
+					return err
+				}
+				if first {
+					first = false
+					bothRead.Done()
+					bothRead.Wait()
+				}
+				current.Age++
+				return tx.Save(ctx, current)
+			})
+		}
+
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() { errs <- increment() }()
+		}
+		assert.NoError(t, <-errs)
+		assert.NoError(t, <-errs)
+
+		retrieved := &User{ID: counter.ID}
+		assert.NoError(t, db.GetByID(ctx, retrieved))
+		assert.Equal(t, 2, retrieved.Age, "No increment should be lost")
+		assert.GreaterOrEqual(t, int(attempts.Load()), 3, "The conflicting transaction should be retried")
+	})
+
+	t.Run("Transaction From Context", func(t *testing.T) {
+		err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			txCtx := fireorm.ContextWithTransaction(ctx, tx)
+			assert.True(t, db.HasTransaction(txCtx))
+			if err := db.Save(txCtx, &User{Name: "Context Tx", Email: "context.tx@example.com"}); err != nil {
+				return err
+			}
+			return errors.New("roll back")
+		})
+		assert.EqualError(t, err, "roll back")
+
+		var results []User
+		err = db.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "context.tx@example.com"}}},
+		}, &results)
+		assert.NoError(t, err)
+		assert.Empty(t, results, "The save should have used the rolled back transaction from the context")
+
+		err = db.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			assert.True(t, db.HasTransaction(ctx), "RunInTransaction should pass the transaction in the context")
+			return db.Save(ctx, &User{Name: "Context Tx", Email: "context.tx@example.com"})
+		})
+		assert.NoError(t, err)
+		err = db.FindAll(ctx, []fireorm.Query{
+			{Where: []fireorm.WhereClause{{Field: "email", Operator: "==", Value: "context.tx@example.com"}}},
+		}, &results)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("Read After Write", func(t *testing.T) {
+		err := db.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			current := &User{ID: user.ID}
+			if err := tx.GetByID(ctx, current); err != nil {
+				return err
+			}
+			if err := tx.Save(ctx, current); err != nil {
+				return err
+			}
+			// The context shares the write state of the transaction-scoped DB instance
+			return db.GetByID(ctx, &User{ID: user.ID})
+		})
+		assert.ErrorIs(t, err, fireorm.ErrReadAfterWrite)
+	})
+
+	t.Run("Does Not Retry Other Errors", func(t *testing.T) {
+		attempts := 0
+		err := db.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			attempts++
+			return errors.New("validation failed")
+		})
+		assert.EqualError(t, err, "validation failed")
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Custom Retry Classifier", func(t *testing.T) {
+		errProxy := errors.New("upstream connect error")
+		classified := db.WithMaxTransactionRetries(3).WithRetryClassifier(func(err error) bool {
+			return errors.Is(err, errProxy)
+		})
+		attempts := 0
+		err := classified.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			attempts++
+			if attempts < 3 {
+				return errProxy
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts, "Errors accepted by the classifier should be retried")
+
+		attempts = 0
+		err = classified.RunInTransaction(ctx, func(ctx context.Context, tx fireorm.IDB) error {
+			attempts++
+			return status.Error(codes.Aborted, "simulated contention")
+		})
+		assert.Equal(t, codes.Aborted, status.Code(err))
+		assert.Equal(t, 1, attempts, "The classifier should replace the default retried codes")
+	})
+}
+
+func TestGetForUpdateRequiresTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil)).Model(&User{})
+	err := db.GetForUpdate(ctx, &User{ID: "user"})
+	assert.ErrorIs(t, err, fireorm.ErrNoTransaction)
+}
+
+func TestTransactionFromContext(t *testing.T) {
+	ctx := context.Background()
+	db := fireorm.New(fireorm.NewConnection(nil)).Model(&User{})
+
+	_, ok := fireorm.TransactionFromContext(ctx)
+	assert.False(t, ok)
+	assert.False(t, db.HasTransaction(ctx))
+
+	tx := &firestore.Transaction{}
+	txCtx := fireorm.ContextWithTransaction(ctx, tx)
+	fromCtx, ok := fireorm.TransactionFromContext(txCtx)
+	assert.True(t, ok)
+	assert.Same(t, tx, fromCtx)
+	assert.True(t, db.HasTransaction(txCtx))
+	assert.False(t, db.GetConnection().HasTransaction(), "The DB instance itself should be unchanged")
+}
+
+func TestReadAfterWrite(t *testing.T) {
+	ctx := context.Background()
+	client := createFirestoreClient()
+	defer client.Close()
+
+	// Writes are only buffered in the transaction until commit, so no emulator is needed
+	db := fireorm.New(fireorm.NewConnection(client)).Model(&User{})
+	transaction := &firestore.Transaction{}
+	tx := db.WithTransaction(transaction)
+	assert.False(t, tx.GetConnection().(*fireorm.Connection).HasWritten())
+
+	err := tx.Save(ctx, &User{ID: "written", Name: "Written"})
+	assert.NoError(t, err)
+	assert.True(t, tx.GetConnection().(*fireorm.Connection).HasWritten())
+
+	err = tx.GetByID(ctx, &User{ID: "written"})
+	assert.ErrorIs(t, err, fireorm.ErrReadAfterWrite)
+	var users []User
+	err = tx.FindAll(ctx, nil, &users)
+	assert.ErrorIs(t, err, fireorm.ErrReadAfterWrite)
+	_, err = tx.Aggregate(ctx, nil, []fireorm.AggregateSpec{{Op: fireorm.AggregateCount, Alias: "count"}})
+	assert.ErrorIs(t, err, fireorm.ErrReadAfterWrite)
+	err = tx.Iterator(ctx, nil).Next(&User{})
+	assert.ErrorIs(t, err, fireorm.ErrReadAfterWrite)
+	err = db.WithTransaction(transaction).GetByID(ctx, &User{ID: "written"})
+	assert.ErrorIs(t, err, fireorm.ErrReadAfterWrite, "Instances bound to the same transaction should share the write state")
+	err = fireorm.New(fireorm.NewConnection(client, transaction)).Model(&User{}).GetByID(ctx, &User{ID: "written"})
+	assert.ErrorIs(t, err, fireorm.ErrReadAfterWrite)
+
+	txCtx := fireorm.ContextWithTransaction(ctx, &firestore.Transaction{})
+	err = db.Delete(txCtx, &User{ID: "written"})
+	assert.NoError(t, err)
+	err = db.GetByIDs(txCtx, []string{"written"}, &users)
+	assert.ErrorIs(t, err, fireorm.ErrReadAfterWrite, "Operations using the same context should share the write state")
+	assert.False(t, db.WithTransaction(&firestore.Transaction{}).GetConnection().(*fireorm.Connection).HasWritten(), "A new transaction starts without writes")
+}
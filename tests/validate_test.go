@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/smarter-day/fireorm"
+	"github.com/stretchr/testify/assert"
+)
+
+type Timestamps struct {
+	Created string `firestore:"created"`
+}
+
+type DuplicateTags struct {
+	Name     string `firestore:"name"`
+	FullName string `firestore:"name"`
+}
+
+// VersionedCustomer stores a field under the name fireorm uses for schema versions.
+type VersionedCustomer struct {
+	Customer
+	Version int `firestore:"_schemaVersion"`
+}
+
+func TestValidateModel(t *testing.T) {
+	valid := []interface{}{
+		&User{},
+		Article{},
+		&Note{},
+		&Customer{},
+		&Comment{},
+		&struct {
+			Timestamps
+			Name    string             `firestore:"name,omitempty"`
+			Address *Address           `firestore:"address"`
+			Places  map[string]Address `firestore:"places"`
+		}{},
+	}
+	for _, model := range valid {
+		assert.NoError(t, fireorm.ValidateModel(model), "%T should be valid", model)
+	}
+
+	invalid := map[string]interface{}{
+		"duplicate tags": &struct {
+			Name     string `firestore:"name"`
+			FullName string `firestore:"name"`
+		}{},
+		"tag colliding with a Go name": &struct {
+			Email string
+			Mail  string `firestore:"Email"`
+		}{},
+		"embedded collision": &struct {
+			Timestamps
+			Created string `firestore:"created"`
+		}{},
+		"nested duplicate": &struct {
+			Address struct {
+				Street string `firestore:"street"`
+				Line1  string `firestore:"street"`
+			} `firestore:"address"`
+		}{},
+		"blank name": &struct {
+			Name string `firestore:" "`
+		}{},
+		"dotted name": &struct {
+			Name string `firestore:"user.name"`
+		}{},
+		"reserved name": &struct {
+			Name string `firestore:"__name__"`
+		}{},
+		"schema version name": &VersionedCustomer{},
+		"two ID fields": &struct {
+			A string `fireorm:"id"`
+			B string `fireorm:"id"`
+		}{},
+		"non-string ID": &struct{ ID int }{},
+		"not a struct":  "users",
+	}
+	for name, model := range invalid {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, fireorm.ValidateModel(model))
+		})
+	}
+
+	err := fireorm.ValidateModel(&DuplicateTags{})
+	assert.EqualError(t, err, `model DuplicateTags: fields Name and FullName are both stored as "name"`)
+	assert.NoError(t, fireorm.ValidateModel(&struct {
+		Version int `firestore:"_schemaVersion"`
+	}{}), "The schema version name is only reserved for models implementing SchemaUpgrader")
+}
@@ -0,0 +1,216 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// DefaultMaxTransactionRetries is the number of times RunInTransaction retries an aborted transaction by default.
+// With the first attempt, this matches the Firestore SDK's default of 5 attempts.
+const DefaultMaxTransactionRetries = 4
+
+// TransactionRetryBackoff is the delay before the first retry of an aborted transaction.
+// It doubles with every further retry.
+const TransactionRetryBackoff = 50 * time.Millisecond
+
+// ErrReadAfterWrite is returned by reads attempted in a transaction that has already been written to.
+// Firestore requires all reads of a transaction to happen before any of its writes.
+var ErrReadAfterWrite = errors.New("cannot read after writing in the same transaction: " +
+	"Firestore transactions require all reads to happen before any writes")
+
+// ErrNoTransaction is returned by operations that only work within a transaction, such as GetForUpdate.
+var ErrNoTransaction = errors.New("operation requires a transaction, use RunInTransaction")
+
+// WithMaxTransactionRetries returns a new DB instance where RunInTransaction retries an aborted transaction
+// up to n times. Negative values are treated as 0, so the transaction is attempted only once.
+func (db *DB) WithMaxTransactionRetries(n int) IDB {
+	if n < 0 {
+		n = 0
+	}
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.maxTransactionRetries = n
+	return newInstance
+}
+
+// GetMaxTransactionRetries returns the number of times RunInTransaction retries an aborted transaction.
+func (db *DB) GetMaxTransactionRetries() int {
+	return db.options.maxTransactionRetries
+}
+
+// WithRetryClassifier returns a new DB instance where RunInTransaction retries the transactions failing with
+// errors for which retryable returns true, instead of those failing with codes.Aborted. It is meant for
+// infrastructures reporting transient failures differently, e.g. through proxies. Pass nil to restore the default.
+func (db *DB) WithRetryClassifier(retryable func(err error) bool) IDB {
+	newInstance := &DB{
+		options: db.options,
+	}
+	newInstance.options.retryClassifier = retryable
+	return newInstance
+}
+
+// retryable reports whether RunInTransaction retries a transaction that failed with err.
+func (db *DB) retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if db.options.retryClassifier != nil {
+		return db.options.retryClassifier(err)
+	}
+	return status.Code(err) == codes.Aborted
+}
+
+// GetForUpdate reads the document identified by the model's ID like GetByID, for a transaction that goes on to
+// update it (read-modify-write). It only works within a transaction, returning ErrNoTransaction otherwise, and
+// makes the locking explicit: Firestore's server SDKs lock the documents read in a transaction until it commits.
+// Other transactions can still read a locked document, but a write to it waits for the lock. When two
+// transactions read the same document and then both write it, neither can proceed: Firestore aborts one of
+// them, and RunInTransaction retries it with the committed value. Contention thus happens when a document read
+// in a transaction is written by another one, and grows with the time between the read and the commit, so
+// transactions should read late and commit quickly.
+func (db *DB) GetForUpdate(ctx context.Context, model interface{}) (err error) {
+	defer recoverError("GetForUpdate", &err)
+	ctx, db = db.prepare(ctx)
+	if !db.GetConnection().HasTransaction() {
+		return ErrNoTransaction
+	}
+	return db.GetByID(ctx, model)
+}
+
+// RunInTransaction runs fn in a Firestore transaction, passing it a DB instance bound to the transaction.
+// When the transaction fails with codes.Aborted (or an error accepted by WithRetryClassifier), whether returned
+// by fn or by the commit because of contention, fn is invoked again in a fresh transaction, up to GetMaxTransactionRetries() times with exponential backoff.
+// fn must therefore read all the state it depends on through the transaction and have no other side effects.
+// The context passed to fn carries the transaction (see ContextWithTransaction).
+// If the DB instance or ctx already has a transaction, fn runs in it directly and is not retried.
+func (db *DB) RunInTransaction(ctx context.Context, fn func(ctx context.Context, tx IDB) error) (err error) {
+	defer recoverError("RunInTransaction", &err)
+	ctx, db = db.prepare(ctx)
+	if db.GetConnection().HasTransaction() {
+		return fn(ctx, db)
+	}
+
+	backoff := TransactionRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = db.GetConnection().GetClient().RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			conn := NewConnection(db.GetConnection().GetClient(), tx)
+			txDB := &DB{options: db.options}
+			txDB.SetConnection(conn)
+			return fn(context.WithValue(ctx, transactionContextKey{}, conn), txDB)
+		}, db.transactionOptions(firestore.MaxAttempts(1))...)
+		if !db.retryable(err) || attempt >= db.GetMaxTransactionRetries() {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("transaction aborted and not retried: %v", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// transactionContextKey is the context key of the transaction connection stored by ContextWithTransaction.
+type transactionContextKey struct{}
+
+// ContextWithTransaction returns a copy of ctx carrying tx. DB operations called with the returned context
+// run in tx, as if the DB instance had been created with WithTransaction, unless it already has a transaction.
+// All operations using the returned context share the transaction's write state (see ErrReadAfterWrite).
+func ContextWithTransaction(ctx context.Context, tx *firestore.Transaction) context.Context {
+	return context.WithValue(ctx, transactionContextKey{}, NewConnection(nil, tx))
+}
+
+// TransactionFromContext returns the transaction stored in ctx by ContextWithTransaction, if any.
+func TransactionFromContext(ctx context.Context) (*firestore.Transaction, bool) {
+	conn, ok := ctx.Value(transactionContextKey{}).(*Connection)
+	if !ok || !conn.HasTransaction() {
+		return nil, false
+	}
+	return conn.GetTransaction(), true
+}
+
+// HasTransaction reports whether operations called with ctx run in a transaction,
+// either the DB instance's own or one carried by ctx.
+func (db *DB) HasTransaction(ctx context.Context) bool {
+	return db.contextTransaction(ctx).GetConnection().HasTransaction()
+}
+
+// contextTransaction returns db bound to the transaction carried by ctx, or db itself if it already has a
+// transaction or ctx carries none.
+func (db *DB) contextTransaction(ctx context.Context) *DB {
+	if ctx == nil || db.GetConnection() == nil || db.GetConnection().HasTransaction() {
+		return db
+	}
+	conn, ok := ctx.Value(transactionContextKey{}).(*Connection)
+	if !ok || !conn.HasTransaction() {
+		return db
+	}
+	newInstance := &DB{options: db.options}
+	newInstance.SetConnection(NewConnection(db.GetConnection().GetClient(), conn.transaction))
+	return newInstance
+}
+
+// checkTransactionRead returns ErrReadAfterWrite if the connection's transaction has already been written to.
+func (db *DB) checkTransactionRead() error {
+	if db.GetConnection().HasTransaction() && transactionWritten(db.GetConnection().GetTransaction()) {
+		return ErrReadAfterWrite
+	}
+	return nil
+}
+
+// transactionWrite adds a write to the connection's transaction and records it (see markTransactionWritten).
+func (db *DB) transactionWrite(write func(tx *firestore.Transaction) error) error {
+	tx := db.GetConnection().GetTransaction()
+	if err := write(tx); err != nil {
+		return err
+	}
+	markTransactionWritten(tx)
+	return nil
+}
+
+// transactionWrites holds the attempts of transactions that have been written to (see transactionAttempt), so
+// that every DB instance and context bound to a transaction shares its write state. Entries are keyed by address
+// so that they do not keep the transactions alive, and each one is dropped by a finalizer once its transaction
+// has been collected.
+var transactionWrites sync.Map
+
+// markTransactionWritten records that a write has been added to the current attempt of tx.
+func markTransactionWritten(tx *firestore.Transaction) {
+	if tx == nil {
+		return
+	}
+	if _, loaded := transactionWrites.Swap(uintptr(unsafe.Pointer(tx)), transactionAttempt(tx)); !loaded {
+		runtime.SetFinalizer(tx, func(tx *firestore.Transaction) {
+			transactionWrites.Delete(uintptr(unsafe.Pointer(tx)))
+		})
+	}
+}
+
+// transactionWritten reports whether a write has been added to the current attempt of tx.
+func transactionWritten(tx *firestore.Transaction) bool {
+	attempt, written := transactionWrites.Load(uintptr(unsafe.Pointer(tx)))
+	return written && attempt == transactionAttempt(tx)
+}
+
+// transactionAttempt returns the ID of the current attempt of tx. The Firestore SDK retries a transaction with
+// the same *firestore.Transaction, beginning each attempt under a new ID that it does not export, so the write
+// state recorded for an attempt does not carry over to the next one.
+func transactionAttempt(tx *firestore.Transaction) string {
+	id := reflect.ValueOf(tx).Elem().FieldByName("id")
+	if id.Kind() != reflect.Slice || id.Type().Elem().Kind() != reflect.Uint8 {
+		return ""
+	}
+	return string(id.Bytes())
+}
@@ -0,0 +1,152 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// invalidFieldNameChars are the characters that cannot appear in a field name used as an update path.
+const invalidFieldNameChars = ".~*/[]`"
+
+// ValidateModel checks the model's "firestore" and "fireorm" tags and returns a descriptive error for the first
+// problem found: two fields stored under the same name, blank names or names with characters that cannot be
+// used in update paths (any of .~*/[] and the backtick), names reserved by Firestore (__name__ and any other
+// name starting and ending with two underscores) or by fireorm, and conflicting ID declarations (several
+// fields tagged with the IDTagOption, or an ID field that is not a string). Nested structs are checked too.
+// It is meant to be called at startup, so misconfigured models fail fast.
+func ValidateModel(model interface{}) error {
+	t := reflect.TypeOf(model)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("model must be a struct or pointer to a struct, got %T", model)
+	}
+	if err := validateIDField(t); err != nil {
+		return err
+	}
+
+	reserved := map[string]bool{}
+	if _, ok := reflect.New(t).Interface().(SchemaUpgrader); ok {
+		reserved[SchemaVersionField] = true
+	}
+	if _, ok := reflect.New(t).Interface().(KeywordProvider); ok {
+		reserved[KeywordsField] = true
+	}
+	return validateFields(t, t.Name(), reserved, map[reflect.Type]bool{})
+}
+
+// validateIDField checks the ID declarations of the model type.
+func validateIDField(t reflect.Type) error {
+	var tagged []string
+	for i := 0; i < t.NumField(); i++ {
+		if HasFireormOption(t.Field(i), IDTagOption) {
+			tagged = append(tagged, t.Field(i).Name)
+		}
+	}
+	if len(tagged) > 1 {
+		return fmt.Errorf("model %s: fields %s are all tagged as the ID field", t.Name(), strings.Join(tagged, ", "))
+	}
+
+	name := "ID"
+	if len(tagged) == 1 {
+		name = tagged[0]
+	}
+	fieldDef, ok := t.FieldByName(name)
+	if ok && len(fieldDef.Index) == 1 && fieldDef.Type.Kind() != reflect.String {
+		return fmt.Errorf("model %s: ID field %s must be a string, got %s", t.Name(), name, fieldDef.Type)
+	}
+	return nil
+}
+
+// validateFields checks the stored names of the fields of struct type t, including the fields of embedded
+// structs, which Firestore flattens into t, and then the fields of nested structs.
+func validateFields(t reflect.Type, path string, reserved map[string]bool, visited map[reflect.Type]bool) error {
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+
+	seen := map[string]string{}
+	var nested []reflect.StructField
+	var check func(t reflect.Type) error
+	check = func(t reflect.Type) error {
+		for i := 0; i < t.NumField(); i++ {
+			fieldDef := t.Field(i)
+			name, _ := FirestoreFieldName(fieldDef)
+			if name == "-" || (!fieldDef.IsExported() && !fieldDef.Anonymous) {
+				continue
+			}
+			if fieldDef.Anonymous && name == "" && indirectType(fieldDef.Type).Kind() == reflect.Struct {
+				if err := check(indirectType(fieldDef.Type)); err != nil {
+					return err
+				}
+				continue
+			}
+			if !fieldDef.IsExported() {
+				continue
+			}
+
+			if name == "" {
+				name = fieldDef.Name
+			}
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("model %s: field %s has a blank firestore name", path, fieldDef.Name)
+			}
+			if strings.ContainsAny(name, invalidFieldNameChars) {
+				return fmt.Errorf("model %s: field %s has firestore name %q containing one of %q",
+					path, fieldDef.Name, name, invalidFieldNameChars)
+			}
+			if len(name) > 4 && strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__") {
+				return fmt.Errorf("model %s: field %s uses the reserved firestore name %q", path, fieldDef.Name, name)
+			}
+			if reserved[name] {
+				return fmt.Errorf("model %s: field %s uses the firestore name %q reserved by fireorm", path, fieldDef.Name, name)
+			}
+			if other, ok := seen[name]; ok {
+				return fmt.Errorf("model %s: fields %s and %s are both stored as %q", path, other, fieldDef.Name, name)
+			}
+			seen[name] = fieldDef.Name
+			nested = append(nested, fieldDef)
+		}
+		return nil
+	}
+	if err := check(t); err != nil {
+		return err
+	}
+
+	for _, fieldDef := range nested {
+		elem := fieldDef.Type
+		for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array || elem.Kind() == reflect.Map {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct || isFirestoreValueType(elem) {
+			continue
+		}
+		// Reserved fireorm names only apply to the top level of a document
+		if err := validateFields(elem, path+"."+fieldDef.Name, nil, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indirectType returns the element type of pointer types and t otherwise.
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// isFirestoreValueType reports whether the struct type is stored as a Firestore value rather than a map.
+func isFirestoreValueType(t reflect.Type) bool {
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(firestore.DocumentRef{}):
+		return true
+	}
+	return false
+}
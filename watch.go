@@ -0,0 +1,113 @@
+package fireorm
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"reflect"
+)
+
+// ChangeKind describes how a document changed in a Watch event.
+type ChangeKind int
+
+const (
+	// ChangeAdded means the document started matching the query, including the documents of the first snapshot.
+	ChangeAdded ChangeKind = iota
+	// ChangeModified means a matching document was updated.
+	ChangeModified
+	// ChangeRemoved means the document was deleted or no longer matches the query.
+	ChangeRemoved
+)
+
+// WatchEvent is a single document change delivered by Watch.
+type WatchEvent struct {
+	ID   string
+	Kind ChangeKind
+	// Model is a pointer to a new value of the projection type, holding the document's projected fields.
+	Model interface{}
+}
+
+// Watch listens to the documents matching queries and calls handler for every change, until ctx is done
+// or handler returns an error, which Watch then returns.
+// projection is a struct (or pointer to a struct) whose "firestore" tagged fields are the only ones streamed
+// and decoded, which saves bandwidth on collections with large documents. Pass nil to decode the whole model.
+func (db *DB) Watch(ctx context.Context, queries []Query, projection interface{}, handler func(event WatchEvent) error) (err error) {
+	defer recoverError("Watch", &err)
+	if db.GetConnection().HasTransaction() {
+		return fmt.Errorf("watch is not supported in a transaction")
+	}
+
+	q, err := db.buildQuery(ctx, queries)
+	if err != nil {
+		return err
+	}
+
+	projectionType := db.GetModelType()
+	if projection != nil {
+		projectionType = reflect.TypeOf(projection)
+		if projectionType.Kind() == reflect.Ptr {
+			projectionType = projectionType.Elem()
+		}
+		if projectionType.Kind() != reflect.Struct {
+			return fmt.Errorf("projection must be a struct or pointer to a struct")
+		}
+		fields := storedFieldNames(projectionType)
+		if len(fields) == 0 {
+			return fmt.Errorf("projection %s has no firestore fields", projectionType)
+		}
+		q = q.Select(fields...)
+	}
+
+	snapshots := q.Snapshots(ctx)
+	defer snapshots.Stop()
+	for {
+		snapshot, err := snapshots.Next()
+		if err != nil {
+			if ctx.Err() != nil || status.Code(err) == codes.Canceled {
+				return nil
+			}
+			return fmt.Errorf("failed to watch documents: %v", err)
+		}
+
+		for _, change := range snapshot.Changes {
+			event := WatchEvent{
+				ID:    change.Doc.Ref.ID,
+				Kind:  changeKind(change.Kind),
+				Model: reflect.New(projectionType).Interface(),
+			}
+			if change.Doc.Exists() {
+				if err := db.decodeDocument(ctx, change.Doc, event.Model); err != nil {
+					return fmt.Errorf("failed to decode document %s: %v", event.ID, err)
+				}
+			}
+			SetIDField(event.Model, event.ID)
+			if err := handler(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// changeKind converts a Firestore document change kind.
+func changeKind(kind firestore.DocumentChangeKind) ChangeKind {
+	switch kind {
+	case firestore.DocumentModified:
+		return ChangeModified
+	case firestore.DocumentRemoved:
+		return ChangeRemoved
+	}
+	return ChangeAdded
+}
+
+// storedFieldNames returns the Firestore field names of the struct's "firestore" tagged fields.
+func storedFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name, _ := FirestoreFieldName(t.Field(i)); name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}